@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretFlags lists flags whose values must never be printed.
+var secretFlags = map[string]bool{
+	"password":        true,
+	"publisher-token": true,
+	"room-token":      true,
+	"server-secret":   true,
+	"turn-pass":       true,
+}
+
+// loadConfigFile sets the flags not given on the command line from a YAML file
+// whose keys are flag names, e.g. "server: ws://host:8080/ws?room=home". Lists
+// set repeatable flags like turn-url once per item. Every value goes through the
+// flag's own parsing, so the file accepts exactly what the command line does.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil // Empty file
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: expected flag: value pairs", path, root.Line)
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		name := key.Value
+		if name == "config" || name == "print-config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, key.Line, name)
+		}
+		if given[name] {
+			continue // The command line wins
+		}
+
+		items := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			items = value.Content
+		}
+		for _, item := range items {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("%s:%d: %s must be a value or a list of values", path, item.Line, name)
+			}
+			if err := flag.Set(name, item.Value); err != nil {
+				return fmt.Errorf("%s:%d: invalid %s: %w", path, item.Line, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// printConfig prints the effective configuration as JSON, after all sources have
+// been applied. Repeatable flags are printed as lists, like in the config file.
+// Secrets are replaced with a placeholder when set.
+func printConfig() error {
+	config := make(map[string]any)
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "print-config" || f.Name == "config" {
+			return
+		}
+		value := f.Value.String()
+		if secretFlags[f.Name] && value != "" {
+			config[f.Name] = "[redacted]"
+		} else if list, ok := f.Value.(interface{ Values() []string }); ok {
+			config[f.Name] = list.Values()
+		} else {
+			config[f.Name] = value
+		}
+	})
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
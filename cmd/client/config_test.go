@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a config file with content and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The flags are global, so each test sets flags the others don't look at.
+
+func TestLoadConfigFilePrecedence(t *testing.T) {
+	if err := flag.CommandLine.Parse([]string{"-debounce=2s"}); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, `
+debounce: 5s
+queue-ttl: 10s
+stun:
+  - stun:a.example.com:3478
+  - stun:b.example.com:3478
+`)
+	if err := loadConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if *debounce != 2*time.Second {
+		t.Errorf("debounce is %v, want the command line's 2s", *debounce)
+	}
+	if *queueTTL != 10*time.Second {
+		t.Errorf("queue-ttl is %v, want the file's 10s", *queueTTL)
+	}
+	if got, def := heartbeat.String(), flag.Lookup("heartbeat-interval").DefValue; got != def {
+		t.Errorf("heartbeat-interval is %v, want the default %v", got, def)
+	}
+	if want := []string{"stun:a.example.com:3478", "stun:b.example.com:3478"}; !slices.Equal(stunURLs, want) {
+		t.Errorf("stun is %v, want %v", stunURLs, want)
+	}
+}
+
+func TestLoadConfigFileMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"invalid yaml", "server: [", "config.yaml"},
+		{"not a mapping", "- server", "expected flag: value pairs"},
+		{"unknown setting", "no-such-flag: 1", `unknown setting "no-such-flag"`},
+		{"nested config", "config: other.yaml", `unknown setting "config"`},
+		{"invalid value", "max-handshakes: many", "invalid max-handshakes"},
+		{"nested value", "turn-user:\n  name: alice", "must be a value or a list of values"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := loadConfigFile(writeConfig(t, tc.content))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("loadConfigFile returned %v, want an error mentioning %q", err, tc.want)
+			}
+		})
+	}
+
+	if err := loadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("loadConfigFile accepted a missing file")
+	}
+}
+
+func TestPrintConfigLists(t *testing.T) {
+	if err := flag.CommandLine.Parse([]string{"-group=laptops=laptop-*", "-group=phones=phone-*", "-turn-pass=s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = printConfig()
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]any
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	// A repeatable flag is a list, one item per use, like in the config file
+	want := []any{"laptops=laptop-*", "phones=phone-*"}
+	if got, _ := config["group"].([]any); !slices.Equal(got, want) {
+		t.Errorf("group is printed as %#v, want %#v", config["group"], want)
+	}
+	if got := config["turn-pass"]; got != "[redacted]" {
+		t.Errorf("turn-pass is printed as %#v, want it redacted", got)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/client"
+	"github.com/Pujan-khunt/clipboard-sync/internal/netdiag"
+)
+
+// runNetDiagnose implements the "net-diagnose" subcommand. It queries the STUN
+// servers the client would use (stunURLs, or the defaults when empty) and
+// reports the detected NAT type.
+func runNetDiagnose(stunURLs []string) error {
+	fmt.Println(">> Network Diagnosis:")
+
+	if len(stunURLs) == 0 {
+		stunURLs = client.DefaultSTUNServers()
+	}
+	report, err := netdiag.Diagnose(stunURLs, 3*time.Second)
+	if report != nil {
+		fmt.Printf("    Local UDP port: %d\n", report.LocalPort)
+		for _, result := range report.Results {
+			if result.Err != nil {
+				fmt.Printf("    - %s: failed (%v)\n", result.Server, result.Err)
+				continue
+			}
+			fmt.Printf("    - %s: reflexive address %s\n", result.Server, result.Mapped)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("    NAT type: %s\n", report.NAT)
+	fmt.Println("----------------------------------------------")
+	fmt.Println(report.Recommendation())
+	return nil
+}
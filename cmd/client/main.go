@@ -1,24 +1,274 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
 
+	"github.com/Pujan-khunt/clipboard-sync/internal/appfilter"
+	"github.com/Pujan-khunt/clipboard-sync/internal/audit"
 	"github.com/Pujan-khunt/clipboard-sync/internal/client"
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+	"github.com/Pujan-khunt/clipboard-sync/internal/crypto"
+	"github.com/Pujan-khunt/clipboard-sync/internal/logging"
+	"github.com/Pujan-khunt/clipboard-sync/internal/redact"
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
 )
 
 var (
-	serverAddr = flag.String("server", "ws://localhost:8080/ws?room=default", "Signaling server WebSocket URL")
-	password   = flag.String("password", "", "Password for E2E encryption (Required)")
-	peerID     = flag.String("peerID", "", "Unique peer ID (auto-generated if empty)")
+	serverAddr   = flag.String("server", "ws://localhost:8080/ws?room=default", "Signaling server WebSocket URL")
+	password     = flag.String("password", "", "Password for E2E encryption (Required unless -keyfile is set)")
+	passwordFile = flag.String("password-file", "", "Read the password from this file; re-read on SIGHUP")
+	keyFile      = flag.String("keyfile", "", "Read a raw 32-byte key (raw, hex or base64) from this file instead of using a password; re-read on SIGHUP")
+	peerID       = flag.String("peerID", "", "Unique peer ID (auto-generated if empty)")
+	selection    = flag.String("selection", "clipboard", "Which clipboard to sync: clipboard, or primary (X11/Wayland middle-click selection, needs xclip or wl-clipboard)")
+	compress     = flag.Bool("compress", false, "Gzip clipboard content before encryption when that makes it smaller")
+	compressLvl  = flag.Int("compression-level", 0, "Gzip level from 1 (fastest) to 9 (smallest), 0 = balanced default")
+	cipherName   = flag.String("cipher", "aes-gcm", "Cipher for outgoing messages: aes-gcm or chacha20-poly1305")
+
+	maxMessageSize = flag.Int64("max-message-size", signaling.DefaultMaxMessageSize, "Maximum size in bytes of a single signaling message")
+	maxIdle        = flag.Duration("max-idle", 0, "Leave the room after this long without clipboard activity and rejoin on the next copy (0 = never)")
+	syncNowGroup   = flag.String("sync-now-group", "", "Make sync now (SIGUSR2) send the clipboard only to the peers of this -group")
+	exitIfAlone    = flag.Duration("exit-if-alone", 0, "Exit if no other peer is in the room for this long (0 = never)")
+	queueTTL       = flag.Duration("queue-ttl", 30*time.Second, "Drop outgoing clipboard items not delivered to a peer within this time")
+	clipboardRetry = flag.Int("clipboard-retry", 5, "Re-initialize the clipboard up to this many times if its watcher stops (0 = give up)")
+	heartbeat      = flag.Duration("heartbeat-interval", client.DefaultHeartbeatInterval, "Ping peers this often and reconnect those that stop answering (0 = don't ping)")
+	statusEvery    = flag.Duration("status-interval", 0, "Log each peer's connection and channel state and last sync this often (0 = never)")
+	controlAddr    = flag.String("control-addr", "", "Serve the control endpoint (GET /status, POST /groups/{name}/send) on this address, e.g. 127.0.0.1:7373; unauthenticated, keep it on loopback")
+	maxSignalAge   = flag.Duration("max-signal-age", client.DefaultMaxSignalAge, "Drop signaling messages sent longer ago than this, allowing for clock differences (0 = accept any age)")
+	writeTimeout   = flag.Duration("write-timeout", client.DefaultWriteTimeout, "Drop the signaling connection when sending to the server blocks for this long (0 = never)")
+	maxHandshakes  = flag.Int("max-handshakes", 4, "Maximum number of peer handshakes in progress at once")
+	debounce       = flag.Duration("debounce", client.DefaultDebounce, "Wait until copies stop for this long and send only the last one (0 = send every copy)")
+	batchWindow    = flag.Duration("batch-window", 0, "Send the distinct copies made within this window as one batch (0 = send each copy)")
+	appFilter      = flag.String("app-filter", "", "Only sync copies from some applications: allow:<apps> or deny:<apps> (comma separated)")
+	privateMeta    = flag.Bool("private-metadata", false, "Hide the peer ID and room name from the signaling server")
+	serverSecret   = flag.String("server-secret", "", "Refuse to connect unless the signaling server proves it knows this secret")
+	publisherToken = flag.String("publisher-token", "", "Token to become the only sender of a read-only room (must match the server's)")
+	roomToken      = flag.String("room-token", "", "Token required by the signaling server to join the room (must match the server's)")
+	dcUnordered    = flag.Bool("dc-unordered", false, "Let clipboard messages arrive out of order (peers should agree, the connecting side's setting applies)")
+	dcRetransmits  = flag.Int("dc-max-retransmits", 0, "Give up on a clipboard message after this many retransmissions; lost messages drop the item (0 = fully reliable)")
+	relayThreshold = flag.Int("relay-threshold", 0, "Send payloads larger than this many bytes through the signaling server (0 = always P2P); payloads too large for one signaling message (-max-message-size and the server's limit) stay P2P")
+
+	pasteExec     = flag.String("paste-exec", "", "Pipe received content to this shell command instead of the clipboard")
+	pastePipe     = flag.String("paste-pipe", "", "Append received content to this file or named pipe instead of the clipboard")
+	maxClipBytes  = flag.Int("max-clipboard-bytes", 5<<20, "Don't sync copies larger than this many bytes (0 = no limit)")
+	clearAfter    = flag.Duration("clear-after", 0, "Clear the clipboard this long after writing content from a peer, unless it changed (0 = never)")
+	pauseIncoming = flag.Bool("pause-incoming", false, "While paused (SIGUSR1), also ignore content from peers")
+	syncImages    = flag.Bool("images", false, "Also sync copied images (PNG), not just text")
+	acceptTypes   = flag.String("accept-types", "", "Only accept these content types from peers, comma separated, e.g. text/plain,image/* (empty = all)")
+	logPreviews   = flag.Bool("log-previews", false, "Show the first characters of synced content in the log (never in the audit log)")
+	auditLog      = flag.String("audit-log", "", "Append a record of every synced item (size and hash, never content) to this file")
+	auditLogBytes = flag.Int64("audit-log-max-bytes", audit.DefaultMaxBytes, "Rotate the audit log once it grows past this size")
+
+	logLevel  = flag.String("log-level", "info", "Log events at this level and above: debug, info, warn or error")
+	logFormat = flag.String("log-format", "text", "Log as text or json")
+	quiet     = flag.Bool("quiet", false, "Only log errors (same as -log-level=error)")
+	verbose   = flag.Bool("verbose", false, "Also log every clipboard item, ICE candidate and SDP (same as -log-level=debug)")
+
+	configFile = flag.String("config", "", "Read settings from this YAML file, keyed by flag name; flags on the command line take precedence")
+	printCfg   = flag.Bool("print-config", false, "Print the effective configuration (secrets redacted) and exit")
+)
+
+// stringList is a repeatable flag collecting every value it is given.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Values returns the values given, one per use of the flag.
+func (l *stringList) Values() []string { return append([]string{}, *l...) }
+
+// groupList is the repeatable -group flag, collecting peer groups by name.
+type groupList struct {
+	specs  []string // Values as given, for printing
+	groups map[string][]string
+}
+
+func (g *groupList) String() string { return strings.Join(g.specs, " ") }
+
+func (g *groupList) Set(value string) error {
+	name, patterns, ok := strings.Cut(value, "=")
+	if !ok || name == "" || patterns == "" {
+		return fmt.Errorf("expected name=pattern,pattern, got %q", value)
+	}
+	split := strings.Split(patterns, ",")
+	for _, pattern := range split {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if g.groups == nil {
+		g.groups = make(map[string][]string)
+	}
+	g.groups[name] = append(g.groups[name], split...)
+	g.specs = append(g.specs, value)
+	return nil
+}
+
+// Values returns the values given, one per use of the flag.
+func (g *groupList) Values() []string { return append([]string{}, g.specs...) }
+
+var (
+	groups                          groupList
+	stunURLs                        stringList
+	turnURLs, turnUsers, turnPasses stringList
 )
 
+func init() {
+	flag.Var(&stunURLs, "stun", "STUN server to discover this device's public address, e.g. stun:stun.example.com:3478; repeatable, replaces the default Google servers")
+	flag.Var(&turnURLs, "turn-url", "TURN server to relay through when peers can't connect directly, e.g. turn:turn.example.com:3478; repeatable")
+	flag.Var(&turnUsers, "turn-user", "Username for the TURN servers; give it once for all, or once per -turn-url")
+	flag.Var(&turnPasses, "turn-pass", "Password for the TURN servers; give it once for all, or once per -turn-url")
+	flag.Var(&groups, "group", "Define a peer group as name=pattern,pattern (e.g. laptops=laptop-*); repeatable")
+}
+
 func main() {
-	flag.Parse()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// verbosity returns the log level of the -quiet and -verbose tiers, or level
+// when neither is set.
+func verbosity(level string, quiet, verbose bool) (string, error) {
+	switch {
+	case quiet && verbose:
+		return "", errors.New("-quiet and -verbose are mutually exclusive")
+	case quiet:
+		return "error", nil
+	case verbose:
+		return "debug", nil
+	}
+	return level, nil
+}
+
+// run is the client's main. It returns instead of exiting on errors, so the
+// deferred cleanup, like closing the audit log, always happens.
+func run() error {
+	// Subcommands come before the flags
+	args := os.Args[1:]
+	var subcommand string
+	if len(args) > 0 && (args[0] == "net-diagnose" || args[0] == "config") {
+		subcommand, args = args[0], args[1:]
+	}
+
+	flag.CommandLine.Parse(args)
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile); err != nil {
+			return err
+		}
+	}
+	switch subcommand {
+	case "net-diagnose":
+		return runNetDiagnose(stunURLs)
+	case "config":
+		*printCfg = true
+	}
+	level, err := verbosity(*logLevel, *quiet, *verbose)
+	if err != nil {
+		return err
+	}
+	if err := logging.Setup(os.Stderr, level, *logFormat); err != nil {
+		return err
+	}
+
+	if *printCfg {
+		return printConfig()
+	}
+
+	if *keyFile != "" && (*password != "" || *passwordFile != "") {
+		return errors.New("-keyfile can't be combined with -password or -password-file")
+	}
 
 	app := client.NewApp(*serverAddr, *password, *peerID)
+	app.PasswordFile = *passwordFile
+	app.KeyFile = *keyFile
+	app.MaxMessageSize = *maxMessageSize
+	app.ExitIfAlone = *exitIfAlone
+	app.MaxIdle = *maxIdle
+	app.QueueTTL = *queueTTL
+	app.PublisherToken = *publisherToken
+	app.PrivateMetadata = *privateMeta
+	app.ServerSecret = *serverSecret
+	app.RoomToken = *roomToken
+	app.HeartbeatInterval = *heartbeat
+	app.MaxSignalAge = *maxSignalAge
+	app.WriteTimeout = *writeTimeout
+	app.StatusInterval = *statusEvery
+	app.ControlAddr = *controlAddr
+	app.RelayThreshold = *relayThreshold
+	app.MaxHandshakes = *maxHandshakes
+	app.ClipboardRetry = *clipboardRetry
+	app.BatchWindow = *batchWindow
+	app.Debounce = *debounce
+	app.DataChannel = client.DataChannelConfig{Unordered: *dcUnordered, MaxRetransmits: *dcRetransmits}
+	switch *selection {
+	case "clipboard":
+	case "primary":
+		app.ClipboardBackend = clipboard.Primary
+	default:
+		return fmt.Errorf("unknown selection %q, expected clipboard or primary", *selection)
+	}
 
-	if err := app.Run(); err != nil {
-		log.Fatal(err)
+	filter, err := appfilter.Parse(*appFilter)
+	if err != nil {
+		return err
+	}
+	app.AppFilter = filter
+
+	turnServers, err := client.NewTURNServers(turnURLs, turnUsers, turnPasses)
+	if err != nil {
+		return err
+	}
+	app.TURNServers = turnServers
+	app.STUNServers = stunURLs
+
+	cipherID, err := crypto.ParseCipher(*cipherName)
+	if err != nil {
+		return err
 	}
+	app.Cipher = cipherID
+	if *compressLvl < 0 || *compressLvl > 9 {
+		return fmt.Errorf("compression level must be between 0 and 9, got %d", *compressLvl)
+	}
+	app.Compress = *compress
+	app.CompressionLevel = *compressLvl
+	app.Groups = groups.groups
+	app.SyncNowGroup = *syncNowGroup
+	app.PasteExec = *pasteExec
+	app.PastePipe = *pastePipe
+	app.SyncImages = *syncImages
+	app.PauseIncoming = *pauseIncoming
+	app.ClearAfter = *clearAfter
+	app.MaxClipboardBytes = *maxClipBytes
+	if *acceptTypes != "" {
+		for _, t := range strings.Split(*acceptTypes, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				app.AcceptTypes = append(app.AcceptTypes, t)
+			}
+		}
+	}
+	if *logPreviews {
+		app.LogPolicy = redact.Preview
+	}
+
+	if *auditLog != "" {
+		logger, err := audit.Open(*auditLog, *auditLogBytes)
+		if err != nil {
+			return err
+		}
+		defer logger.Close()
+		app.AuditLog = logger
+	}
+
+	return app.Run()
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/logging"
+)
+
+func TestVerbosity(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	for _, tc := range []struct {
+		name           string
+		level          string
+		quiet, verbose bool
+		frames, info   bool // Whether frame logs and info events appear, errors always do
+	}{
+		{"default", "info", false, false, false, true},
+		{"quiet", "info", true, false, false, false},
+		{"quiet over a debug level", "debug", true, false, false, false},
+		{"verbose", "info", false, true, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			level, err := verbosity(tc.level, tc.quiet, tc.verbose)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var logs bytes.Buffer
+			if err := logging.Setup(&logs, level, "text"); err != nil {
+				t.Fatal(err)
+			}
+			slog.Debug("Received clipboard", "peer", "peer-b", "content", "5 bytes")
+			slog.Info("Connected to peer", "peer", "peer-b")
+			slog.Error("Connection to server lost", "err", "EOF")
+
+			out := logs.String()
+			if got := strings.Contains(out, "Received clipboard"); got != tc.frames {
+				t.Errorf("frame logged: %v, want %v", got, tc.frames)
+			}
+			if got := strings.Contains(out, "Connected to peer"); got != tc.info {
+				t.Errorf("info logged: %v, want %v", got, tc.info)
+			}
+			if !strings.Contains(out, "Connection to server lost") {
+				t.Errorf("the error wasn't logged, got %q", out)
+			}
+		})
+	}
+
+	if _, err := verbosity("info", true, true); err == nil {
+		t.Fatal("accepted -quiet with -verbose")
+	}
+}
@@ -1,25 +1,176 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Pujan-khunt/clipboard-sync/internal/logging"
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
 	"github.com/Pujan-khunt/clipboard-sync/internal/utils"
 	"github.com/Pujan-khunt/clipboard-sync/internal/wsserver"
+	"golang.org/x/crypto/acme/autocert"
 )
 
-var port = flag.String("port", ":8080", "Port to listen on")
+var (
+	port            = flag.String("port", ":8080", "Port to listen on")
+	maxMessageSize  = flag.Int64("max-message-size", signaling.DefaultMaxMessageSize, "Maximum size in bytes of a single signaling message")
+	serverSecret    = flag.String("server-secret", "", "Pre-shared secret proving this server's identity to clients (empty = disabled)")
+	publisherToken  = flag.String("publisher-token", "", "Token letting a client become the only sender of its room (empty = disabled)")
+	maxPeersPerRoom = flag.Int("max-peers-per-room", 0, "Refuse peers joining a room that already has this many (0 = unlimited)")
+	connsPerMinute  = flag.Int("connections-per-minute", 0, "Refuse WebSocket upgrades from an IP beyond this many per minute, loopback excepted (0 = unlimited)")
+	allowedOrigins  = flag.String("allowed-origins", "", "Comma-separated origins (wildcards allowed, e.g. https://*.example.com) browsers may connect from (empty = any)")
+	duplicatePeers  = flag.String("duplicate-peers", string(wsserver.DuplicateReplace), "When a peer_id already connected to a room joins again: replace (close the old connection) or reject (refuse the new one)")
+	roomToken       = flag.String("room-token", "", "Token peers must present (client -room-token) to join any room (empty = rooms are open)")
+	roomTokens      = flag.String("room-tokens", "", "Per-room tokens as comma-separated room=token pairs, overriding -room-token for those rooms")
+	adminToken      = flag.String("admin-token", "", "Token required in the X-Admin-Token header to query /rooms (empty = /rooms is open)")
+	pingInterval    = flag.Duration("ping-interval", wsserver.DefaultPingInterval, "How often to ping each client to detect dead connections (0 = never)")
+	pongTimeout     = flag.Duration("pong-timeout", wsserver.DefaultPongTimeout, "Drop a client that hasn't answered a ping or sent anything for this long")
+	writeTimeout    = flag.Duration("write-timeout", wsserver.DefaultWriteTimeout, "Drop a client when relaying a message to it blocks for this long (0 = never)")
+	tlsCert         = flag.String("tls-cert", "", "Serve wss:// with this certificate file (PEM), together with -tls-key")
+	tlsKey          = flag.String("tls-key", "", "Private key file (PEM) for -tls-cert")
+	tlsAuto         = flag.String("tls-auto", "", "Serve wss:// with Let's Encrypt certificates for these comma-separated domains (listen on :443)")
+	tlsCache        = flag.String("tls-cache", "certs", "Directory where -tls-auto stores its certificates")
+	logLevel        = flag.String("log-level", "info", "Log events at this level and above: debug, info, warn or error")
+	logFormat       = flag.String("log-format", "text", "Log as text or json")
+	shutdownTimeout = flag.Duration("shutdown-timeout", 10*time.Second, "On SIGINT/SIGTERM, how long to wait for peers to disconnect before exiting")
+)
 
 func main() {
 	flag.Parse()
 
+	if err := logging.Setup(os.Stderr, *logLevel, *logFormat); err != nil {
+		log.Fatal(err)
+	}
+
+	if *pingInterval > 0 && *pongTimeout <= *pingInterval {
+		log.Fatalf("pong timeout (%s) must be longer than the ping interval (%s)", *pongTimeout, *pingInterval)
+	}
+
+	policy := wsserver.DuplicatePolicy(*duplicatePeers)
+	if policy != wsserver.DuplicateReplace && policy != wsserver.DuplicateReject {
+		log.Fatalf("invalid -duplicate-peers %q, expected replace or reject", *duplicatePeers)
+	}
+
+	if *connsPerMinute < 0 {
+		log.Fatalf("-connections-per-minute must not be negative, got %d", *connsPerMinute)
+	}
+
+	tokens, err := parseRoomTokens(*roomTokens)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scheme, err := checkTLSFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	hub := wsserver.NewHub()
+	hub.MaxMessageSize = *maxMessageSize
+	hub.PublisherToken = *publisherToken
+	hub.ServerSecret = *serverSecret
+	hub.PingInterval = *pingInterval
+	hub.PongTimeout = *pongTimeout
+	hub.WriteTimeout = *writeTimeout
+	hub.MaxPeersPerRoom = *maxPeersPerRoom
+	hub.AdminToken = *adminToken
+	hub.ConnectionsPerMinute = *connsPerMinute
+	hub.DuplicatePeers = policy
+	hub.RoomToken = *roomToken
+	hub.RoomTokens = tokens
+	if *allowedOrigins != "" {
+		hub.AllowedOrigins = strings.Split(*allowedOrigins, ",")
+	}
 
 	http.HandleFunc("/ws", hub.HandleConnections)
+	http.HandleFunc("/rooms", hub.HandleRooms)
+	server := &http.Server{Addr: *port}
+
+	// Shut down cleanly on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		slog.Info("Shutting down, waiting for peers to disconnect", "timeout", *shutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		// Stop accepting connections first; upgraded WebSockets are the hub's to close
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("HTTP shutdown failed", "err", err)
+		}
+		if err := hub.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Some peers didn't disconnect in time and were dropped", "err", err)
+		}
+	}()
 
-	utils.PrintLocalIPs(*port)
-	if err := http.ListenAndServe(*port, nil); err != nil {
+	utils.PrintLocalIPs(scheme, *port)
+	switch {
+	case *tlsAuto != "":
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(*tlsAuto, ",")...),
+			Cache:      autocert.DirCache(*tlsCache),
+		}
+		server.TLSConfig = manager.TLSConfig()
+		err = server.ListenAndServeTLS("", "")
+	case *tlsCert != "":
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	default:
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("ListenAndServe: ", err)
 	}
+	<-done
+	slog.Info("Server stopped")
+}
+
+// parseRoomTokens parses the -room-tokens flag.
+func parseRoomTokens(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	tokens := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		room, token, ok := strings.Cut(pair, "=")
+		if !ok || room == "" || token == "" {
+			return nil, fmt.Errorf("invalid -room-tokens entry %q, expected room=token", pair)
+		}
+		tokens[room] = token
+	}
+	return tokens, nil
+}
+
+// checkTLSFlags validates the TLS flags, loading the certificate up front so a
+// missing or mismatched file is reported clearly, and returns the URL scheme.
+func checkTLSFlags() (string, error) {
+	if *tlsAuto != "" {
+		if *tlsCert != "" || *tlsKey != "" {
+			return "", errors.New("-tls-auto can't be combined with -tls-cert and -tls-key")
+		}
+		return "wss", nil
+	}
+	if *tlsCert == "" && *tlsKey == "" {
+		return "ws", nil
+	}
+	if *tlsCert == "" || *tlsKey == "" {
+		return "", errors.New("-tls-cert and -tls-key must be given together")
+	}
+	if _, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey); err != nil {
+		return "", fmt.Errorf("can't load TLS certificate: %w", err)
+	}
+	return "wss", nil
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/wsserver"
+	"github.com/gorilla/websocket"
+)
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key as PEM
+// files, and returns their paths with the certificate.
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "clipboard-sync test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+// setTLSFlags sets the TLS flags until the test ends.
+func setTLSFlags(t *testing.T, cert, key, auto string) {
+	t.Helper()
+	oldCert, oldKey, oldAuto := *tlsCert, *tlsKey, *tlsAuto
+	*tlsCert, *tlsKey, *tlsAuto = cert, key, auto
+	t.Cleanup(func() { *tlsCert, *tlsKey, *tlsAuto = oldCert, oldKey, oldAuto })
+}
+
+func TestCheckTLSFlags(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t)
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	for _, tc := range []struct {
+		name            string
+		cert, key, auto string
+		scheme          string // Empty when the flags must be rejected
+	}{
+		{"plain", "", "", "", "ws"},
+		{"certificate", certFile, keyFile, "", "wss"},
+		{"autocert", "", "", "example.com", "wss"},
+		{"certificate only", certFile, "", "", ""},
+		{"key only", "", keyFile, "", ""},
+		{"missing certificate", missing, keyFile, "", ""},
+		{"mismatched files", keyFile, certFile, "", ""},
+		{"autocert and certificate", certFile, keyFile, "example.com", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setTLSFlags(t, tc.cert, tc.key, tc.auto)
+			scheme, err := checkTLSFlags()
+			if tc.scheme == "" {
+				if err == nil {
+					t.Fatalf("accepted, with scheme %q", scheme)
+				}
+				return
+			}
+			if err != nil || scheme != tc.scheme {
+				t.Fatalf("returned %q, %v; want %q", scheme, err, tc.scheme)
+			}
+		})
+	}
+}
+
+func TestTLSHandshake(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t)
+	setTLSFlags(t, certFile, keyFile, "")
+	if _, err := checkTLSFlags(); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub := wsserver.NewHub()
+	hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(hub.HandleConnections))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{pair}}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // The refused handshake below is expected
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	// A client trusting the certificate joins over wss://
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	dialer := websocket.Dialer{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	u := "wss" + strings.TrimPrefix(srv.URL, "https") + "/ws?peer_id=peer-a"
+	conn, _, err := dialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("wss handshake failed: %v", err)
+	}
+	conn.Close()
+
+	// One that doesn't is refused
+	if _, _, err := websocket.DefaultDialer.Dial(u, nil); err == nil {
+		t.Fatal("a client not trusting the self-signed certificate connected")
+	}
+}
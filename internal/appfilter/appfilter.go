@@ -0,0 +1,80 @@
+// Package appfilter restricts clipboard sync to copies made in certain applications.
+// Where the platform exposes it, the foreground application is looked up when a copy
+// is detected and checked against an allow or deny list. On platforms without
+// support every copy is allowed, so the filter degrades to a no-op.
+package appfilter
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupported is returned when the foreground application can't be determined.
+var ErrUnsupported = errors.New("active application lookup is not supported on this platform")
+
+// Filter decides whether a copy should be synced based on the application it came from.
+type Filter struct {
+	allow    bool            // true: only listed apps sync, false: listed apps never sync
+	apps     map[string]bool // lowercased application names
+	warnOnce sync.Once
+}
+
+// Parse parses a filter spec of the form "allow:app1,app2" or "deny:app1,app2".
+// Application names are matched case-insensitively. An empty spec returns a nil
+// Filter, which allows everything.
+func Parse(spec string) (*Filter, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	mode, list, ok := strings.Cut(spec, ":")
+	if !ok || (mode != "allow" && mode != "deny") {
+		return nil, fmt.Errorf("invalid app filter %q: expected allow:<apps> or deny:<apps>", spec)
+	}
+
+	f := &Filter{allow: mode == "allow", apps: make(map[string]bool)}
+	for _, app := range strings.Split(list, ",") {
+		if app = strings.TrimSpace(app); app != "" {
+			f.apps[strings.ToLower(app)] = true
+		}
+	}
+	if len(f.apps) == 0 {
+		return nil, fmt.Errorf("invalid app filter %q: no applications listed", spec)
+	}
+	return f, nil
+}
+
+// Allowed reports whether a copy made in app should be synced.
+func (f *Filter) Allowed(app string) bool {
+	if f == nil {
+		return true
+	}
+	return f.apps[strings.ToLower(app)] == f.allow
+}
+
+// Check looks up the foreground application and reports whether a copy made now
+// should be synced. If the platform doesn't support the lookup the copy is
+// allowed and a warning is logged once. Any other lookup failure blocks the
+// copy, since it may come from an application the filter excludes; app is
+// then empty.
+func (f *Filter) Check() (app string, allowed bool) {
+	if f == nil {
+		return "", true
+	}
+
+	app, err := activeApp()
+	if errors.Is(err, ErrUnsupported) {
+		f.warnOnce.Do(func() {
+			slog.Warn("App filter disabled, all copies will be synced", "err", err)
+		})
+		return "", true
+	}
+	if err != nil {
+		slog.Debug("Active application lookup failed, blocking the copy", "err", err)
+		return "", false
+	}
+	return app, f.Allowed(app)
+}
@@ -0,0 +1,18 @@
+package appfilter
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const frontmostScript = `tell application "System Events" to get name of first application process whose frontmost is true`
+
+// activeApp returns the name of the frontmost application using osascript.
+func activeApp() (string, error) {
+	out, err := exec.Command("osascript", "-e", frontmostScript).Output()
+	if err != nil {
+		return "", fmt.Errorf("osascript failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,20 @@
+package appfilter
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// activeApp returns the window class of the focused X11 window using xdotool.
+func activeApp() (string, error) {
+	if _, err := exec.LookPath("xdotool"); err != nil {
+		return "", fmt.Errorf("%w: xdotool is not installed", ErrUnsupported)
+	}
+
+	out, err := exec.Command("xdotool", "getactivewindow", "getwindowclassname").Output()
+	if err != nil {
+		return "", fmt.Errorf("xdotool failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
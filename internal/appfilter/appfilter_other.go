@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package appfilter
+
+// activeApp is not implemented on this platform.
+func activeApp() (string, error) {
+	return "", ErrUnsupported
+}
@@ -0,0 +1,213 @@
+// Package audit writes an append-only log of clipboard sync events for compliance.
+// Each record is a JSON line holding the time, direction, peer, size and an
+// HMAC-SHA256 of the synced content — never the content itself or any key material.
+// The HMAC key is a secret of the log, so short content such as a PIN can't be
+// recovered by hashing guesses. Records are chained by hash, so editing or
+// removing a line breaks the chain after it.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Directions of a sync event.
+const (
+	Sent     = "sent"
+	Received = "received"
+)
+
+// DefaultMaxBytes is the size at which the log file is rotated.
+const DefaultMaxBytes int64 = 10 << 20
+
+// maxBackups is how many rotated files (path.1 … path.N) are kept.
+const maxBackups = 3
+
+// Record is a single audit entry. It deliberately has no field that could hold
+// content, so the audit log is redact.SizeOnly by construction.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Peer      string    `json:"peer"`        // Remote peer, or "*" for a send to the whole room
+	Bytes     int       `json:"bytes"`       // Size of the content
+	HMAC      string    `json:"hmac_sha256"` // HMAC-SHA256 of the content with the log's key
+	Prev      string    `json:"prev"`        // Hash of the previous record line
+}
+
+// keySize is the length of the HMAC key stored next to the log.
+const keySize = 32
+
+// Logger appends records to a file, rotating it by size.
+type Logger struct {
+	path     string
+	maxBytes int64
+
+	key []byte // HMAC key of the content hashes
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	prev string // Hash of the last line written
+}
+
+// Open opens (or creates) the audit log at path. The file is rotated once it
+// grows past maxBytes; zero uses DefaultMaxBytes. The HMAC key is read from
+// path.key, which is created with a random key the first time; whoever holds it
+// can check whether some content matches a record.
+func Open(path string, maxBytes int64) (*Logger, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	key, err := loadKey(path + ".key")
+	if err != nil {
+		return nil, err
+	}
+	l := &Logger{path: path, maxBytes: maxBytes, key: key}
+
+	// Continue the hash chain of an existing log, from the last rotated file if
+	// the current one has no record yet
+	if line := lastLine(path); line != nil {
+		l.prev = hashLine(line)
+	} else if line := lastLine(path + ".1"); line != nil {
+		l.prev = hashLine(line)
+	}
+
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadKey reads the HMAC key at path, or creates it if it doesn't exist.
+func loadKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key = make([]byte, keySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit log key: %w", err)
+		}
+		if _, err := file.Write(key); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write audit log key: %w", err)
+		}
+		return key, file.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log key: %w", err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("invalid audit log key %s: %d bytes, expected %d", path, len(key), keySize)
+	}
+	return key, nil
+}
+
+// lastLine returns the last line of the file at path, or nil if it is empty or
+// can't be read.
+func lastLine(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	if last := lines[len(lines)-1]; len(last) > 0 {
+		return last
+	}
+	return nil
+}
+
+// Log records a sync event of content with peer. Only the size and HMAC of content are stored.
+func (l *Logger) Log(direction, peer string, content []byte) error {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write(content)
+	return l.Write(Record{
+		Time:      time.Now().UTC(),
+		Direction: direction,
+		Peer:      peer,
+		Bytes:     len(content),
+		HMAC:      hex.EncodeToString(mac.Sum(nil)),
+	})
+}
+
+// Write appends rec, filling in the hash of the previous record.
+func (l *Logger) Write(rec Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rec.Prev = l.prev
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if l.size > 0 && l.size+int64(len(line))+1 > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("audit log rotation failed: %w", err)
+		}
+	}
+
+	w := bufio.NewWriter(l.file)
+	w.Write(line)
+	w.WriteByte('\n')
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	l.size += int64(len(line)) + 1
+	l.prev = hashLine(line)
+	return nil
+}
+
+// Close closes the log file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// rotate shifts path.N-1 → path.N, …, path → path.1 and starts a new file.
+// The hash chain continues across files. Must be called with l.mu held.
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	for i := maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.openFile()
+}
+
+func (l *Logger) openFile() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file, l.size = file, info.Size()
+	return nil
+}
+
+func hashLine(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
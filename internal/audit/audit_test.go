@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readRecords returns the records of the log file at path, with their lines.
+func readRecords(t *testing.T, path string) ([]Record, [][]byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []Record
+	var lines [][]byte
+	for _, line := range bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatalf("invalid record %q: %v", line, err)
+		}
+		records, lines = append(records, rec), append(lines, line)
+	}
+	return records, lines
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []struct {
+		direction, peer string
+		content         []byte
+	}{
+		{Sent, "*", []byte("secret password")},
+		{Received, "peer-b", []byte("wifi code")},
+	}
+	for _, e := range events {
+		if err := l.Log(e.direction, e.peer, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := os.ReadFile(path + ".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, lines := readRecords(t, path)
+	if len(records) != len(events) {
+		t.Fatalf("%d records, want %d", len(records), len(events))
+	}
+	for i, e := range events {
+		if bytes.Contains(data, e.content) {
+			t.Fatalf("the log holds the content %q", e.content)
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(e.content)
+		want := Record{
+			Time:      records[i].Time,
+			Direction: e.direction,
+			Peer:      e.peer,
+			Bytes:     len(e.content),
+			HMAC:      hex.EncodeToString(mac.Sum(nil)),
+		}
+		if i > 0 {
+			want.Prev = hashLine(lines[i-1])
+		}
+		if records[i] != want {
+			t.Errorf("record %d is %+v, want %+v", i, records[i], want)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	const maxBytes = 512
+	l, err := Open(path, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 40 {
+		if err := l.Log(Sent, fmt.Sprintf("peer-%d", i), []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Oldest first: the backups, then the current file
+	files := []string{path + ".3", path + ".2", path + ".1", path}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, maxBackups+1)); err == nil {
+		t.Fatalf("more than %d backups kept", maxBackups)
+	}
+	var prev string
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > maxBytes {
+			t.Errorf("%s is %d bytes, over the limit of %d", file, info.Size(), maxBytes)
+		}
+		records, lines := readRecords(t, file)
+		for j, rec := range records {
+			// The chain continues across files, the oldest kept file starts mid-chain
+			if (i > 0 || j > 0) && rec.Prev != prev {
+				t.Fatalf("record %d of %s doesn't chain to the one before it", j, file)
+			}
+			prev = hashLine(lines[j])
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Log(Sent, "*", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	key, err := os.ReadFile(path + ".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A restart keeps the key and continues the chain
+	if l, err = Open(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Log(Sent, "*", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if again, err := os.ReadFile(path + ".key"); err != nil || !bytes.Equal(again, key) {
+		t.Fatal("reopening the log changed its key")
+	}
+	records, lines := readRecords(t, path)
+	if len(records) != 2 || records[1].Prev != hashLine(lines[0]) {
+		t.Fatal("the chain was restarted by reopening the log")
+	}
+}
+
+func TestOpenInvalidKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path+".key", []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, 0); err == nil {
+		t.Fatal("opened the log with a key of the wrong size")
+	}
+}
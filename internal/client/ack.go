@@ -0,0 +1,61 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+)
+
+// ackTimeout is how long a peer has to acknowledge an offer or answer before
+// it is reported, which usually points at the signaling path to that peer.
+const ackTimeout = 10 * time.Second
+
+// pendingAcks tracks the offers and answers awaiting an acknowledgment, by message ID.
+type pendingAcks struct {
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+}
+
+// sendAcked sends msg and reports it if its recipient doesn't acknowledge it
+// within ackWait. Peers predating acknowledgments never do.
+func (a *App) sendAcked(msg *signaling.Message) {
+	if err := a.sendSignal(msg); err != nil {
+		return
+	}
+
+	id, remotePeerID, typ := msg.ID, msg.ToPeer, msg.Type
+	a.acks.mu.Lock()
+	defer a.acks.mu.Unlock()
+	if a.acks.pending == nil {
+		a.acks.pending = make(map[string]*time.Timer)
+	}
+	a.acks.pending[id] = time.AfterFunc(a.ackWait, func() {
+		a.acks.mu.Lock()
+		_, unacked := a.acks.pending[id]
+		delete(a.acks.pending, id)
+		a.acks.mu.Unlock()
+		if unacked {
+			a.logger().Warn("Peer didn't acknowledge our message", "peer", remotePeerID, "type", typ, "within", a.ackWait)
+			a.recordPeerError(remotePeerID, "%s not acknowledged within %s", typ, a.ackWait)
+		}
+	})
+}
+
+// acknowledge tells the sender of msg that it arrived.
+func (a *App) acknowledge(msg *signaling.Message) {
+	if msg.ID == "" {
+		return
+	}
+	a.sendSignal(signaling.NewAck(a.peerID, msg.FromPeer, msg.ID))
+}
+
+// handleAck marks the message acknowledged by msg as delivered.
+func (a *App) handleAck(msg *signaling.Message) {
+	a.acks.mu.Lock()
+	defer a.acks.mu.Unlock()
+	if timer, ok := a.acks.pending[msg.Payload]; ok {
+		timer.Stop()
+		delete(a.acks.pending, msg.Payload)
+	}
+}
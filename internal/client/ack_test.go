@@ -0,0 +1,149 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+	"github.com/gorilla/websocket"
+)
+
+// rawPeer connects to the server as peerID without an App, and returns the
+// connection with a channel receiving the messages relayed to it.
+func rawPeer(t *testing.T, serverURL, peerID string) (*websocket.Conn, <-chan *signaling.Message) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(serverURL+"?peer_id="+peerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	received := make(chan *signaling.Message, 16)
+	go func() {
+		defer close(received)
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msg, err := signaling.Unmarshal(data); err == nil {
+				received <- msg
+			}
+		}
+	}()
+	return conn, received
+}
+
+// sendRaw writes msg, stamped with this build's version, to conn.
+func sendRaw(t *testing.T, conn *websocket.Conn, msg *signaling.Message) {
+	t.Helper()
+	msg.Version, msg.MinVersion = signaling.ProtocolVersion, signaling.MinProtocolVersion
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// nextOfType returns the next message of type typ from received.
+func nextOfType(t *testing.T, received <-chan *signaling.Message, typ string) *signaling.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-received:
+			if !ok {
+				t.Fatalf("connection closed waiting for a %s", typ)
+			}
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for a %s", typ)
+		}
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		id    string // ID of the answer, empty as sent by builds without acks
+		acked bool
+	}{
+		{"answer", "answer-1", true},
+		{"answer without an ID", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serverURL := newTestServer(t)
+			a, _ := startApp(t, serverURL, "peer-a", nil)
+			waitJoined(t, a)
+			conn, received := rawPeer(t, serverURL, "peer-b")
+
+			answer := signaling.NewAnswer("peer-b", "peer-a", `{"type":"answer","sdp":"v=0"}`)
+			answer.ID = tc.id
+			sendRaw(t, conn, answer)
+			// Messages are handled in order, so the ack of this one comes after
+			// any ack of the first
+			marker := signaling.NewAnswer("peer-b", "peer-a", `{"type":"answer","sdp":"v=0"}`)
+			marker.ID = "marker"
+			sendRaw(t, conn, marker)
+
+			ack := nextOfType(t, received, signaling.TypeAck)
+			if ack.FromPeer != "peer-a" || ack.ToPeer != "peer-b" {
+				t.Fatalf("ack from %q to %q, want from peer-a to peer-b", ack.FromPeer, ack.ToPeer)
+			}
+			want := "marker"
+			if tc.acked {
+				want = tc.id
+			}
+			if ack.Payload != want {
+				t.Fatalf("first ack is for %q, want %q", ack.Payload, want)
+			}
+		})
+	}
+}
+
+func TestSendAcked(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		acks     bool // Whether the peer acknowledges the offer
+		reported bool
+	}{
+		{"acknowledged", true, false},
+		{"not acknowledged", false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serverURL := newTestServer(t)
+			a, _ := startApp(t, serverURL, "peer-a", func(a *App) { a.ackWait = 200 * time.Millisecond })
+			waitJoined(t, a)
+			conn, received := rawPeer(t, serverURL, "peer-b")
+
+			a.sendAcked(signaling.NewOffer("peer-a", "peer-b", "v=0"))
+			offer := nextOfType(t, received, signaling.TypeOffer)
+			if offer.ID == "" {
+				t.Fatal("offer sent without an ID to acknowledge")
+			}
+			if tc.acks {
+				sendRaw(t, conn, signaling.NewAck("peer-b", "peer-a", offer.ID))
+			}
+
+			time.Sleep(3 * a.ackWait)
+			var lastError string
+			for _, s := range a.Status() {
+				if s.PeerID == "peer-b" {
+					lastError = s.LastError
+				}
+			}
+			if reported := strings.Contains(lastError, "not acknowledged"); reported != tc.reported {
+				t.Fatalf("reported %q, want a missing ack reported: %v", lastError, tc.reported)
+			}
+			a.acks.mu.Lock()
+			defer a.acks.mu.Unlock()
+			if n := len(a.acks.pending); n != 0 {
+				t.Fatalf("%d messages still await an ack", n)
+			}
+		})
+	}
+}
@@ -4,17 +4,34 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
+	"net"
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/Pujan-khunt/clipboard-sync/internal/appfilter"
+	"github.com/Pujan-khunt/clipboard-sync/internal/audit"
 	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
 	"github.com/Pujan-khunt/clipboard-sync/internal/crypto"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+	"github.com/Pujan-khunt/clipboard-sync/internal/redact"
 	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -26,16 +43,222 @@ type App struct {
 	ServerURL string
 	Password  string
 
+	// Cipher seals outgoing messages. Incoming messages name their own cipher, so
+	// peers may use different ones.
+	Cipher crypto.CipherID
+
+	// Compress gzips outgoing clipboard content before encryption when that makes
+	// it smaller, at CompressionLevel (1 fastest - 9 smallest, 0 default).
+	Compress         bool
+	CompressionLevel int
+
+	// PasswordFile, when set, is read for the password at startup and again on SIGHUP,
+	// allowing the password to be changed without restarting the client.
+	PasswordFile string
+
+	// KeyFile, when set, is read for a raw key (see crypto.LoadKey) instead of
+	// deriving one from a password. Like PasswordFile it is re-read on SIGHUP.
+	KeyFile string
+
+	// MaxMessageSize is the largest signaling message (in bytes) accepted from the server.
+	MaxMessageSize int64
+
+	// ExitIfAlone makes Run return once this client has been the only peer in the
+	// room for the given duration. Zero disables it.
+	ExitIfAlone time.Duration
+
+	// QueueTTL is how long an outgoing payload may wait for a peer's DataChannel
+	// to (re)open before it is dropped as stale.
+	QueueTTL time.Duration
+
+	// MaxHandshakes limits how many peer handshakes (offer/answer creation and ICE
+	// gathering) run at once. Extra peers wait their turn.
+	MaxHandshakes int
+
+	// BatchWindow, when non-zero, collects the distinct copies made within this window
+	// and sends them as one batch. Peers apply the newest and keep the rest in history.
+	BatchWindow time.Duration
+
+	// Debounce waits until copies stop for this long and sends only the last one,
+	// so a burst of copies isn't sent one by one. Text isn't debounced when
+	// BatchWindow is set, batches already coalesce it. Zero sends every copy.
+	Debounce time.Duration
+
+	// AppFilter, when set, only syncs copies made in the applications it allows.
+	AppFilter *appfilter.Filter
+
+	// RelayThreshold routes encrypted payloads larger than this many bytes through
+	// the signaling server instead of the DataChannels. Zero disables relaying.
+	// Only payloads that fit in a single signaling message are relayed, larger
+	// ones stay on the DataChannels, so the threshold must be below that size.
+	RelayThreshold int
+
+	// PublisherToken is presented to the server to become the publisher of a
+	// read-only room. A publisher only sends, clipboard from peers is ignored.
+	PublisherToken string
+
+	// PrivateMetadata hides who is syncing from the signaling server: the peer ID
+	// is random for every session and the room name is replaced by an identifier
+	// derived from the password (see crypto.RoomID). A password reload moves the
+	// client to the identifier of the new password.
+	PrivateMetadata bool
+
+	// MaxIdle, when non-zero, suspends the client after this long without local
+	// copies or received clipboard: it leaves the room and closes all connections,
+	// then rejoins on the next local copy.
+	MaxIdle time.Duration
+
+	// ClipboardRetry is how many times the clipboard is re-initialized, with
+	// backoff, when its watcher stops mid-session (e.g. the display server
+	// restarted). Zero gives up right away.
+	ClipboardRetry int
+
+	// STUNServers discover the public address of this device for direct
+	// connections, replacing Google's public servers (see DefaultSTUNServers).
+	// Empty uses the defaults.
+	STUNServers []string
+
+	// TURNServers relay the connection to peers that can't be reached directly.
+	TURNServers []TURNServer
+
+	// DataChannel sets the delivery guarantees of the clipboard DataChannel. The
+	// initiator's settings apply to both sides, so peers should agree on them.
+	DataChannel DataChannelConfig
+
+	// HeartbeatInterval is how often each peer is pinged over the control
+	// DataChannel. A peer that stops answering for a few intervals has its
+	// connection torn down and re-established, catching half-open channels.
+	// Zero disables pinging, pings from peers are still answered.
+	HeartbeatInterval time.Duration
+
+	// StatusInterval, when non-zero, logs a summary of the peers this often (see Status).
+	StatusInterval time.Duration
+
+	// ControlAddr, when set, serves ControlHandler on this address, e.g.
+	// 127.0.0.1:7373, to read the status and send to groups at runtime.
+	ControlAddr string
+
+	// MaxSignalAge drops signaling messages sent longer ago than this, or
+	// timestamped this far in the future, to blunt replays. It must allow for
+	// clock differences between devices. Zero accepts any age.
+	MaxSignalAge time.Duration
+
+	// WriteTimeout bounds how long sending a signaling message may block. A
+	// write that times out drops the signaling connection, which is then
+	// reconnected. Zero means no limit.
+	WriteTimeout time.Duration
+
+	// RoomToken is presented to the server to be let into the room, when the
+	// server requires one. It doesn't take part in encryption.
+	RoomToken string
+
+	// ServerSecret, when set, makes the client verify that the signaling server
+	// knows the same secret before joining, guarding against rogue servers.
+	ServerSecret string
+
+	// PasteExec and PastePipe redirect received content away from the clipboard:
+	// to the stdin of a shell command, and/or appended to a file or named pipe.
+	PasteExec string
+	PastePipe string
+
+	// Groups maps group names to patterns of peer IDs (path.Match syntax, e.g.
+	// "laptop-*"), so the clipboard can be sent to a subset of peers with SendToGroup.
+	// It can't be combined with PrivateMetadata, which makes peer IDs random.
+	Groups map[string][]string
+
+	// SyncNowGroup, when set, makes SyncNow send to this group of Groups only.
+	SyncNowGroup string
+
+	// ClipboardBackend is the clipboard to sync, clipboard.System when nil.
+	ClipboardBackend clipboard.Backend
+
+	// OnRemoteWrite, when set, is called after content from a peer was written
+	// to the clipboard, e.g. to show a notification. It runs on the receive path
+	// without any lock held, so it must return quickly.
+	OnRemoteWrite func(peerID string, format clipboard.Format, size int)
+
+	// ClearAfter, when positive, empties the clipboard this long after content
+	// from a peer was written to it, unless it was replaced meanwhile.
+	ClearAfter time.Duration
+
+	// PauseIncoming also drops content received from peers while paused (see
+	// TogglePause), instead of only holding back local copies.
+	PauseIncoming bool
+
+	// HistorySize is how many recent clipboard items History keeps
+	// (clipboard.DefaultHistorySize when zero).
+	HistorySize int
+
+	// MaxClipboardBytes, when positive, stops copies larger than this from being
+	// sent to peers.
+	MaxClipboardBytes int
+
+	// SyncImages sends copied images to peers as well as text. Images from peers
+	// are written to the clipboard either way, unless AcceptTypes excludes them.
+	SyncImages bool
+
+	// AcceptTypes, when set, lists the content types this device accepts from
+	// peers, e.g. "text/plain" or "image/*". Anything else is dropped.
+	AcceptTypes []string
+
+	// LogPolicy controls whether the log may show previews of synced content.
+	// The audit log never does, whatever this is set to.
+	LogPolicy redact.Policy
+
+	// AuditLog, when set, records every synced item (size and hash, never content).
+	AuditLog *audit.Logger
+
+	// Logger receives the client's log events, slog.Default() when nil. Events
+	// carry the room once it is known, and the peer they are about as "peer".
+	Logger *slog.Logger
+
 	clipboard *clipboard.Manager
-	key       []byte
+	log       atomic.Pointer[slog.Logger] // Logger with the room attached, once known
+	keys      *crypto.Keyring             // Current key, and the previous one for keyGracePeriod after a reload
+	keyMu     sync.Mutex                  // Protects keyGen
+	keyGen    uint64                      // Incremented by each password reload
+	room      string
 	conn      *websocket.Conn
+	connDone  chan struct{} // Closed once the signaling read loop of conn returns
 
 	// P2P WebRTC fields
-	peerID    string                            // Unique identifier for this peer
-	peers     map[string]*webrtc.PeerConnection // PeerConnection per remote peer
-	dataChans map[string]*webrtc.DataChannel    // DataChannel per remote peer
-	mu        sync.RWMutex                      // Protects peers and dataChans maps
-	wsMu      sync.Mutex                        // Protects WebSocket writes
+	peerID       string                            // Unique identifier for this peer
+	peers        map[string]*webrtc.PeerConnection // PeerConnection per remote peer
+	dataChans    map[string]*webrtc.DataChannel    // DataChannel per remote peer
+	outboxes     map[string]*outbox                // Ordered outgoing queue per remote peer
+	heartbeats   map[string]*heartbeat             // Control channel liveness per remote peer
+	negotiations map[string]*negotiation           // Offer/answer state per remote peer
+	mu           sync.RWMutex                      // Protects peers, dataChans, outboxes, heartbeats and negotiations maps
+	wsMu         sync.Mutex                        // Protects WebSocket writes
+
+	handshakes  chan struct{}                          // Semaphore bounding concurrent handshakes
+	openTimeout time.Duration                          // How long a DataChannel may take to open, dataChannelOpenTimeout outside tests
+	retryBase   time.Duration                          // First backoff of recoverClipboardWatch, clipboardRetryBase outside tests
+	ackWait     time.Duration                          // How long a peer has to acknowledge, ackTimeout outside tests
+	after       func(d time.Duration) <-chan time.Time // Debounce and batch timers, time.After outside tests
+
+	decryptFailures failureLog            // Throttles "Decryption failed" logs per peer
+	ignoredPayloads failureLog            // Throttles a publisher's "Ignoring clipboard" logs per peer
+	reassembly      *protocol.Reassembler // Incomplete fragmented messages from peers
+	nonces          *crypto.NonceTracker  // Recently seen nonces, to reject reuse and replays
+	status          statusBoard           // Peer statuses, readable without a.mu
+	sendSeq         atomic.Uint64         // Sequence number of the last clipboard envelope sealed
+	transferID      atomic.Uint64         // ID of the last fragmented transfer, its own space apart from sendSeq
+	clipboardDown   atomic.Bool           // Set while the clipboard watcher is being recovered
+	loops           loopBreaker           // Suspends syncing when the same content ping-pongs
+	acks            pendingAcks           // Offers and answers not acknowledged yet
+
+	serverMaxMsg atomic.Int64 // Largest message the server reads, 0 if it didn't say
+
+	// Session state for suspending on idle
+	serverURL     *url.URL           // Signaling URL with the query parameters added
+	sessionCancel context.CancelFunc // Stops the current signaling session
+	suspended     atomic.Bool        // Whether the client left the room for being idle
+	lastActivity  atomic.Int64       // Unix nanoseconds of the last copy sent or received
+	wake          chan struct{}      // Signaled on a local copy while suspended
+	dropped       chan struct{}      // Signaled when the signaling connection drops
+	rejoin        chan struct{}      // Signaled when a reload changed the opaque room ID
+	pastes        chan []byte        // Content waiting for PasteExec and PastePipe
 }
 
 // NewApp creates a new instance of the client application.
@@ -44,108 +267,742 @@ func NewApp(serverURL, password, peerID string) *App {
 		peerID = uuid.New().String()[:8] // Short UUID for readability
 	}
 	return &App{
-		ServerURL: serverURL,
-		Password:  password,
-		peerID:    peerID,
-		clipboard: clipboard.NewManager(),
-		peers:     make(map[string]*webrtc.PeerConnection),
-		dataChans: make(map[string]*webrtc.DataChannel),
+		ServerURL:         serverURL,
+		Password:          password,
+		Cipher:            crypto.CipherAESGCM,
+		MaxMessageSize:    signaling.DefaultMaxMessageSize,
+		QueueTTL:          30 * time.Second,
+		MaxHandshakes:     4,
+		ClipboardRetry:    5,
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		MaxSignalAge:      DefaultMaxSignalAge,
+		WriteTimeout:      DefaultWriteTimeout,
+		Debounce:          DefaultDebounce,
+		peerID:            peerID,
+		openTimeout:       dataChannelOpenTimeout,
+		retryBase:         clipboardRetryBase,
+		ackWait:           ackTimeout,
+		after:             time.After,
+		clipboard:         clipboard.NewManager(),
+		peers:             make(map[string]*webrtc.PeerConnection),
+		dataChans:         make(map[string]*webrtc.DataChannel),
+		outboxes:          make(map[string]*outbox),
+		heartbeats:        make(map[string]*heartbeat),
+		negotiations:      make(map[string]*negotiation),
+		reassembly:        protocol.NewReassembler(maxReassemblyTransfers, maxReassemblyBytes, reassemblyTimeout),
+		nonces:            crypto.NewNonceTracker(nonceHistory),
+		wake:              make(chan struct{}, 1),
+		dropped:           make(chan struct{}, 1),
+		rejoin:            make(chan struct{}, 1),
+		pastes:            make(chan []byte, pasteQueueSize),
+		keys:              crypto.NewKeyring(),
+	}
+}
+
+// defaultSTUNServers are Google's public STUN servers used for NAT traversal
+var defaultSTUNServers = []string{
+	"stun:stun.l.google.com:19302",
+	"stun:stun1.l.google.com:19302",
+}
+
+// DefaultSTUNServers returns the STUN server URLs used when App.STUNServers is empty.
+func DefaultSTUNServers() []string {
+	return append([]string(nil), defaultSTUNServers...)
+}
+
+// stunServers returns the STUN server URLs used in the WebRTC configuration.
+func (a *App) stunServers() []string {
+	if len(a.STUNServers) > 0 {
+		return a.STUNServers
+	}
+	return DefaultSTUNServers()
+}
+
+// validateSTUNServer checks that server is a STUN URL.
+func validateSTUNServer(server string) error {
+	if !strings.HasPrefix(server, "stun:") && !strings.HasPrefix(server, "stuns:") {
+		return fmt.Errorf("STUN server %q must start with stun: or stuns:", server)
+	}
+	return nil
+}
+
+// webRTCConfig returns the WebRTC configuration with STUN and TURN servers
+func (a *App) webRTCConfig() webrtc.Configuration {
+	var config webrtc.Configuration
+	for _, server := range a.stunServers() {
+		config.ICEServers = append(config.ICEServers, webrtc.ICEServer{URLs: []string{server}})
 	}
+	for _, server := range a.TURNServers {
+		config.ICEServers = append(config.ICEServers, webrtc.ICEServer{
+			URLs:           []string{server.URL},
+			Username:       server.Username,
+			Credential:     server.Credential,
+			CredentialType: webrtc.ICECredentialTypePassword,
+		})
+	}
+	return config
 }
 
-// getWebRTCConfig returns the WebRTC configuration with STUN servers
-func getWebRTCConfig() webrtc.Configuration {
-	return webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-			{URLs: []string{"stun:stun1.l.google.com:19302"}},
-		},
+// logger returns the logger for the client's events.
+func (a *App) logger() *slog.Logger {
+	if l := a.log.Load(); l != nil {
+		return l
 	}
+	if a.Logger != nil {
+		return a.Logger
+	}
+	return slog.Default()
 }
 
 // Run starts the main application loop. It connects to the signaling server,
-// initializes the clipboard, and manages P2P connections.
+// initializes the clipboard, and manages P2P connections until interrupted.
 func (a *App) Run() error {
+	return a.RunContext(context.Background())
+}
+
+// RunContext is like Run but also stops, leaving the room, when ctx is done.
+// Each App keeps all its state, so several can run in one process (see RunAll).
+func (a *App) RunContext(parent context.Context) error {
+	for _, server := range a.STUNServers {
+		if err := validateSTUNServer(server); err != nil {
+			return err
+		}
+	}
+	for _, server := range a.TURNServers {
+		if err := server.validate(); err != nil {
+			return err
+		}
+	}
+	if err := a.DataChannel.validate(); err != nil {
+		return err
+	}
+	if _, ok := a.Groups[a.SyncNowGroup]; a.SyncNowGroup != "" && !ok {
+		return fmt.Errorf("sync now group %q isn't defined", a.SyncNowGroup)
+	}
+	if len(a.Groups) > 0 && a.PrivateMetadata {
+		return fmt.Errorf("peer groups can't be used with private metadata, peer IDs are random then")
+	}
+	if largest := a.maxRelayed(a.MaxMessageSize); a.RelayThreshold > 0 && a.RelayThreshold >= largest {
+		return fmt.Errorf("relay threshold of %d bytes would relay nothing, a signaling message carries at most %d bytes of payload", a.RelayThreshold, largest)
+	}
+
 	// Setup crypto
-	if a.Password == "" {
-		return fmt.Errorf("password is required for encryption")
+	var keyReady <-chan []byte
+	if a.KeyFile != "" {
+		if a.Password != "" || a.PasswordFile != "" {
+			return fmt.Errorf("a key file and a password are mutually exclusive")
+		}
+		key, err := crypto.LoadKey(a.KeyFile)
+		if err != nil {
+			return err
+		}
+		ready := make(chan []byte, 1)
+		ready <- key
+		keyReady = ready
+	} else {
+		if a.PasswordFile != "" {
+			password, err := readPasswordFile(a.PasswordFile)
+			if err != nil {
+				return err
+			}
+			a.Password = password
+		}
+		if a.Password == "" {
+			return fmt.Errorf("password is required for encryption")
+		}
+		// Derive the key while the clipboard starts up
+		keyReady = deriveKey(a.Password)
 	}
-	a.key = crypto.DeriveKey(a.Password)
-	log.Println(">> Security: AES-256 Key derived.")
+
+	// Use a context for graceful cancellation
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
 
 	// Setup clipboard
+	a.clipboard.Backend = a.ClipboardBackend
+	a.clipboard.Images = a.SyncImages
+	a.clipboard.MaxBytes = a.MaxClipboardBytes
+	a.clipboard.HistorySize = a.HistorySize
+	a.clipboard.Logger = a.logger()
 	if err := a.clipboard.Init(); err != nil {
 		return fmt.Errorf("clipboard init failed: %w", err)
 	}
-	log.Println(">> Clipboard: System environment initialized.")
+	a.logger().Info("Clipboard initialized")
+
+	updates, err := a.startClipboardWatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	a.setKey(a.awaitKey(keyReady))
+	if a.KeyFile != "" {
+		a.logger().Info("Key loaded", "file", a.KeyFile, "cipher", a.Cipher.String())
+	} else {
+		a.logger().Info("Key derived", "cipher", a.Cipher.String())
+	}
 
 	// Parse server URL
-	u, err := url.Parse(a.ServerURL)
+	u, err := parseServerURL(a.ServerURL)
 	if err != nil {
 		return fmt.Errorf("invalid server URL: %w", err)
 	}
-	log.Printf(">> Network: Connecting to signaling server %s...", u.String())
+	a.logger().Info("Connecting to the signaling server", "url", u.String())
 
-	// Add peer id to query parameters
+	// Identify the room the same way the server does
 	q := u.Query()
+	a.room = q.Get("room")
+	if a.room == "" {
+		a.room = "default"
+	}
+	a.log.Store(a.logger().With("room", a.room))
+
+	if a.PrivateMetadata {
+		a.peerID = uuid.New().String()
+		q.Set("room", crypto.RoomID(a.currentKey(), a.room))
+		a.logger().Info("Using a session peer ID and an opaque room ID", "self", a.peerID)
+	}
+
+	// Add peer id to query parameters. Only RawQuery is rewritten, so the host
+	// (including a bracketed IPv6 literal) is dialed exactly as given.
 	q.Set("peer_id", a.peerID)
+	if a.PublisherToken != "" {
+		q.Set("publisher_token", a.PublisherToken)
+	}
+	if a.RoomToken != "" {
+		q.Set(signaling.RoomTokenParam, a.RoomToken)
+	}
+	u.RawQuery = q.Encode()
+	a.serverURL = u
+
+	a.handshakes = make(chan struct{}, max(a.MaxHandshakes, 1))
+
+	if a.PasteExec != "" || a.PastePipe != "" {
+		go a.runPasteTargets(ctx)
+	}
+	if a.ControlAddr != "" {
+		ln, err := net.Listen("tcp", a.ControlAddr)
+		if err != nil {
+			return fmt.Errorf("control endpoint: %w", err)
+		}
+		go a.serveControl(ctx, ln)
+	}
+
+	// Connect to the Signaling Server and start the clipboard watcher
+	if err := a.connect(ctx, false); err != nil {
+		return err
+	}
+	go a.handleOutgoingClipboard(ctx, updates)
+	if a.HeartbeatInterval > 0 {
+		go a.runHeartbeats(ctx)
+	}
+	if a.StatusInterval > 0 {
+		go a.runStatus(ctx)
+	}
+
+	// Wait for interrupt, for the caller to stop us, or for nobody to show up
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	syncNow := make(chan os.Signal, 1)
+	if len(syncNowSignals) > 0 {
+		signal.Notify(syncNow, syncNowSignals...)
+	}
+	pause := make(chan os.Signal, 1)
+	if len(pauseSignals) > 0 {
+		signal.Notify(pause, pauseSignals...)
+	}
+	alone := a.waitAlone(ctx)
+	idle := a.idleTicker()
+	var retry <-chan time.Time // Fires when the next reconnect attempt is due
+	attempt := 0
+wait:
+	for {
+		select {
+		case <-c:
+			a.logger().Info("Interrupt received, closing the connections with all peers")
+			break wait
+		case <-parent.Done():
+			a.logger().Info("Stopping, closing the connections with all peers")
+			break wait
+		case <-alone:
+			a.logger().Info("No peers in the room, exiting", "after", a.ExitIfAlone)
+			break wait
+		case <-hup:
+			go a.reloadPassword()
+		case <-syncNow:
+			a.SyncNow()
+		case <-pause:
+			a.TogglePause()
+		case <-idle:
+			if !a.suspended.Load() && a.idleFor() >= a.MaxIdle {
+				a.logger().Info("No clipboard activity, leaving the room until the next copy", "after", a.MaxIdle)
+				a.suspend()
+				retry = nil
+			}
+		case <-a.wake:
+			if a.suspended.Load() {
+				a.logger().Info("Local copy, rejoining the room")
+				if err := a.connect(ctx, false); err != nil {
+					a.logger().Error("Failed to rejoin, will retry on the next copy", "err", err)
+				}
+			}
+		case <-a.rejoin:
+			if err := a.rejoinRoom(ctx); err != nil {
+				attempt = 1
+				delay := reconnectDelay(attempt)
+				a.logger().Warn("Failed to join the room of the new key, retrying", "err", err, "in", delay.Round(100*time.Millisecond))
+				retry = time.After(delay)
+				continue
+			}
+			retry = nil
+		case <-a.dropped:
+			attempt = 1
+			delay := reconnectDelay(attempt)
+			a.logger().Warn("Lost the signaling server, reconnecting", "in", delay.Round(100*time.Millisecond))
+			retry = time.After(delay)
+		case <-retry:
+			if err := a.connect(ctx, true); err != nil {
+				attempt++
+				delay := reconnectDelay(attempt)
+				a.logger().Warn("Failed to reconnect to the signaling server", "err", err, "retry_in", delay.Round(100*time.Millisecond), "attempt", attempt)
+				retry = time.After(delay)
+				continue
+			}
+			a.logger().Info("Reconnected to the signaling server")
+			retry = nil
+		}
+	}
+
+	if !a.suspended.Load() {
+		a.suspend()
+	}
+	a.logger().Info("Connections with all peers closed")
+	a.destroyKey()
+
+	return nil
+}
+
+// readPasswordFile reads a password from a file, ignoring the trailing newline.
+func readPasswordFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("password file %s is empty", path)
+	}
+	return password, nil
+}
+
+// parseServerURL parses and validates the signaling server URL. IPv6 literals must
+// be bracketed (ws://[2001:db8::1]:8080/ws): without brackets the port can't be
+// told apart from the address and the dial would fail with a confusing error.
+func parseServerURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("scheme must be ws or wss, got %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("missing host")
+	}
+	if !strings.HasPrefix(u.Host, "[") && strings.Count(u.Host, ":") > 1 {
+		return nil, fmt.Errorf("IPv6 address %q must be enclosed in brackets, e.g. ws://[2001:db8::1]:8080/ws", u.Host)
+	}
+	return u, nil
+}
+
+// reloadPassword re-reads PasswordFile, or KeyFile, and atomically swaps in the new key.
+// The clipboard watcher and DataChannels stay up; messages sealed from now on use
+// the new key, so every peer in the room needs to be switched to the same password.
+// With PrivateMetadata the main loop then moves to the room of the new key.
+func (a *App) reloadPassword() {
+	if a.KeyFile != "" {
+		key, err := crypto.LoadKey(a.KeyFile)
+		if err != nil {
+			a.logger().Error("Key reload failed", "err", err)
+			return
+		}
+		a.keyMu.Lock()
+		a.keyGen++
+		err = a.rotateKey(key)
+		a.keyMu.Unlock()
+		if err != nil {
+			crypto.Zero(key)
+			a.logger().Error("Key reload failed, still using the previous key", "err", err)
+			return
+		}
+		a.logger().Info("Key file reloaded, new key in use")
+		a.keyChanged()
+		return
+	}
+	if a.PasswordFile == "" {
+		a.logger().Warn("SIGHUP received, but no password or key file is configured, ignoring it")
+		return
+	}
+
+	password, err := readPasswordFile(a.PasswordFile)
+	if err != nil {
+		a.logger().Error("Password reload failed", "err", err)
+		return
+	}
+
+	// Keep using the old key until the new one is ready
+	a.keyMu.Lock()
+	a.keyGen++
+	gen := a.keyGen
+	a.keyMu.Unlock()
+
+	key := a.awaitKey(deriveKey(password))
+
+	a.keyMu.Lock()
+	defer a.keyMu.Unlock()
+	if gen != a.keyGen {
+		return // A newer reload won
+	}
+	if err := a.rotateKey(key); err != nil {
+		crypto.Zero(key)
+		a.logger().Error("Password reload failed, still using the previous key", "err", err)
+		return
+	}
+	a.logger().Info("Password reloaded, new key in use")
+	a.keyChanged()
+}
+
+// keyChanged asks the main loop to move to the room of the new key when the
+// room ID is derived from it.
+func (a *App) keyChanged() {
+	if !a.PrivateMetadata {
+		return
+	}
+	select {
+	case a.rejoin <- struct{}{}:
+	default:
+	}
+}
+
+// rejoinRoom moves this peer to the opaque room of the current key. Peers that
+// reloaded the same password find it there, and DataChannels stay open as
+// after a dropped signaling connection. Peers still on the previous password
+// are left behind in the old room until they reload too.
+func (a *App) rejoinRoom(ctx context.Context) error {
+	u := *a.serverURL
+	q := u.Query()
+	q.Set("room", crypto.RoomID(a.currentKey(), a.room))
 	u.RawQuery = q.Encode()
+	a.serverURL = &u
+	if a.suspended.Load() {
+		return nil // The next connect joins the new room
+	}
 
-	// Connect to the Signaling Server
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	a.logger().Info("Key changed, moving to the room of the new key")
+	a.sessionCancel()
+	a.closeSignaling()
+	return a.connect(ctx, true)
+}
+
+// keyGracePeriod is how long the previous key still opens messages after a
+// reload, so messages in flight, and peers not reloaded yet, aren't cut off.
+const keyGracePeriod = time.Minute
+
+// rotateKey makes key the key for new messages and wipes the previous one after
+// keyGracePeriod. Key ids are short, so it refuses a key whose id is taken by a
+// different key still in the keyring rather than replacing that key early.
+// Must be called with a.keyMu held.
+func (a *App) rotateKey(key []byte) error {
+	newID := crypto.KeyID(key)
+	stored := a.keys.Key(newID)
+	if stored != nil && subtle.ConstantTimeCompare(stored, key) != 1 {
+		return fmt.Errorf("the new key has key id %d like a key still in use, choose another password or key", newID)
+	}
+
+	oldID, oldKey := a.keys.Current()
+	a.keys.Add(newID, key)
+	if stored != nil {
+		crypto.Zero(stored) // Same key reloaded, Add replaced the old copy
+	}
+	if oldKey == nil || oldID == newID {
+		return nil
+	}
+	time.AfterFunc(keyGracePeriod, func() {
+		a.keyMu.Lock()
+		defer a.keyMu.Unlock()
+		if id, _ := a.keys.Current(); id != oldID {
+			a.keys.Destroy(oldID)
+		}
+	})
+	return nil
+}
+
+// keyProgressInterval is how often awaitKey reports a key derivation still running.
+const keyProgressInterval = 2 * time.Second
+
+// deriveKey derives the key for password in the background, since a slow KDF
+// must not stall the clipboard watcher.
+func deriveKey(password string) <-chan []byte {
+	ready := make(chan []byte, 1)
+	go func() { ready <- crypto.DeriveKey(password) }()
+	return ready
+}
+
+// awaitKey waits for a key from deriveKey, logging progress while it takes long.
+func (a *App) awaitKey(ready <-chan []byte) []byte {
+	ticker := time.NewTicker(keyProgressInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	for {
+		select {
+		case key := <-ready:
+			return key
+		case <-ticker.C:
+			a.logger().Info("Still deriving the key", "elapsed", time.Since(start).Round(time.Second))
+		}
+	}
+}
+
+// setKey sets the encryption key used for all subsequent messages.
+func (a *App) setKey(key []byte) {
+	a.keys.Add(crypto.KeyID(key), key)
+}
+
+// destroyKey wipes the keys from memory at shutdown, including one still in
+// its grace period. The App can't seal or open messages afterwards.
+func (a *App) destroyKey() {
+	a.keys.Wipe()
+}
+
+// currentKey returns the encryption key in use.
+func (a *App) currentKey() []byte {
+	_, key := a.keys.Current()
+	return key
+}
+
+// connect dials the signaling server, announces this peer to the room and starts
+// handling signaling messages until the session is suspended or ctx is done.
+// resume marks a reconnection after the signaling connection dropped.
+func (a *App) connect(ctx context.Context, resume bool) error {
+	u := *a.serverURL
+	var challenge string
+	if a.ServerSecret != "" {
+		challenge = rand.Text()
+		q := u.Query()
+		q.Set(signaling.ChallengeParam, challenge)
+		u.RawQuery = q.Encode()
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
 	if err != nil {
 		return fmt.Errorf("signaling connection failed: %w", err)
 	}
+	if a.ServerSecret != "" {
+		if !signaling.VerifyServerProof(a.ServerSecret, challenge, resp.Header.Get(signaling.ServerProofHeader)) {
+			conn.Close()
+			return errors.New("signaling server failed to prove it knows the server secret, refusing to connect")
+		}
+		a.logger().Info("Signaling server identity verified")
+	}
+	a.checkServerVersion(resp.Header.Get(signaling.VersionHeader))
+	serverMaxMsg, _ := strconv.ParseInt(resp.Header.Get(signaling.MaxMessageSizeHeader), 10, 64)
+	a.serverMaxMsg.Store(serverMaxMsg)
+	if largest := a.maxRelayed(a.relayLimit()); a.RelayThreshold > 0 && a.RelayThreshold >= largest {
+		a.logger().Warn("The server's message size limit is below the relay threshold, nothing will be relayed",
+			"threshold", a.RelayThreshold, "largest", largest)
+	}
+	conn.SetReadLimit(a.MaxMessageSize)
+	done := make(chan struct{})
+	a.wsMu.Lock()
 	a.conn = conn
-	defer a.conn.Close()
-	log.Printf(">> Network: Connected to signaling server (PeerID: %s)", a.peerID)
-
-	// Announce presence to the room
-	if err := a.sendSignal(&signaling.Message{
-		Type:     signaling.TypeJoin,
-		FromPeer: a.peerID,
-	}); err != nil {
+	a.connDone = done
+	a.wsMu.Unlock()
+	a.logger().Info("Connected to the signaling server", "self", a.peerID)
+
+	// Announce presence to the room. Peers we are still connected to after a
+	// dropped signaling connection keep their DataChannels.
+	join := signaling.NewJoin(a.peerID, "", a.joinCommitment())
+	join.Resume = resume
+	if err := a.sendSignal(join); err != nil {
+		conn.Close()
 		return fmt.Errorf("failed to announce presence: %w", err)
 	}
 
-	// Use a context for graceful cancellation
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	if a.sessionCancel != nil {
+		a.sessionCancel()
+	}
+	sessionCtx, cancel := context.WithCancel(ctx)
+	a.sessionCancel = cancel
+	a.suspended.Store(false)
+	a.touch()
+
+	go func() {
+		defer close(done)
+		a.handleSignaling(sessionCtx, conn)
+	}()
+	return nil
+}
 
-	// Start signaling handler and clipboard watcher
-	go a.handleSignaling(ctx)
-	go a.handleOutgoingClipboard(ctx)
+// checkServerVersion warns when the server announces protocol versions that
+// exclude ours. Servers predating versioning announce nothing.
+func (a *App) checkServerVersion(header string) {
+	if header == "" {
+		return
+	}
+	minVersion, maxVersion, err := signaling.ParseVersionRange(header)
+	if err != nil {
+		a.logger().Warn("Signaling server sent an invalid version header", "err", err)
+		return
+	}
+	if signaling.ProtocolVersion < minVersion || signaling.ProtocolVersion > maxVersion {
+		a.logger().Warn("Signaling server doesn't support our protocol version, some messages may be dropped",
+			"server_min", minVersion, "server_max", maxVersion, "version", signaling.ProtocolVersion)
+	}
+}
 
-	// Wait for interrupt
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
-	log.Println("Interrupt received. Closing p2p connection with all peers...")
+// closeGracePeriod is how long suspend waits for the server to answer its close
+// frame before closing the signaling connection anyway.
+const closeGracePeriod = time.Second
 
+// suspend leaves the room and closes the signaling connection and all peer
+// connections. Outboxes are kept, so copies made meanwhile reach peers after the
+// next connect.
+func (a *App) suspend() {
 	// Announce departure
-	a.sendSignal(&signaling.Message{
-		Type:     signaling.TypeLeave,
-		FromPeer: a.peerID,
-	})
+	a.sendSignal(signaling.NewLeave(a.peerID))
+	a.suspended.Store(true)
+	a.sessionCancel()
+	a.closeSignaling()
 
-	log.Println("p2p connections closed successfully.")
+	a.mu.RLock()
+	peerIDs := slices.Collect(maps.Keys(a.peers))
+	a.mu.RUnlock()
+	for _, peerID := range peerIDs {
+		a.closePeerConnection(peerID)
+	}
+}
 
-	return nil
+// closeSignaling closes the WebSocket with a handshake so the server sees a
+// normal closure instead of a dropped connection. The session must be cancelled
+// first; the read loop then returns on the server's reply.
+func (a *App) closeSignaling() {
+	a.wsMu.Lock()
+	conn, done := a.conn, a.connDone
+	a.wsMu.Unlock()
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(closeGracePeriod)); err == nil {
+		select {
+		case <-done:
+		case <-time.After(closeGracePeriod):
+		}
+	}
+	conn.Close()
+}
+
+// localActivity records a local copy and wakes the client if it is suspended.
+func (a *App) localActivity() {
+	a.touch()
+	if a.suspended.Load() {
+		select {
+		case a.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// touch records clipboard activity, resetting the idle timer.
+func (a *App) touch() {
+	a.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleFor returns the time since the last clipboard activity.
+func (a *App) idleFor() time.Duration {
+	return time.Since(time.Unix(0, a.lastActivity.Load()))
+}
+
+// idleTicker returns a channel on which idleness is checked, or nil if MaxIdle is disabled.
+func (a *App) idleTicker() <-chan time.Time {
+	if a.MaxIdle <= 0 {
+		return nil
+	}
+	return time.NewTicker(min(a.MaxIdle, time.Second)).C
+}
+
+// waitAlone returns a channel that is closed once this client has had no peers
+// for ExitIfAlone. When ExitIfAlone is disabled it returns nil, which blocks forever.
+func (a *App) waitAlone(ctx context.Context) <-chan struct{} {
+	if a.ExitIfAlone <= 0 {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(min(a.ExitIfAlone, time.Second))
+		defer ticker.Stop()
+
+		aloneSince := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			a.mu.RLock()
+			n := len(a.peers)
+			a.mu.RUnlock()
+
+			// Nobody can join us while we are suspended for being idle
+			if n > 0 || a.suspended.Load() {
+				aloneSince = time.Now()
+				continue
+			}
+			if time.Since(aloneSince) >= a.ExitIfAlone {
+				close(done)
+				return
+			}
+		}
+	}()
+	return done
 }
 
 // sendSignal sends a signaling message over WebSocket
 func (a *App) sendSignal(msg *signaling.Message) error {
+	msg.Version = signaling.ProtocolVersion
+	msg.MinVersion = signaling.MinProtocolVersion
+	msg.ID = uuid.NewString()
+	msg.Timestamp = time.Now().UnixMilli()
 	data, err := msg.Marshal()
 	if err != nil {
 		return err
 	}
 	a.wsMu.Lock()
 	defer a.wsMu.Unlock()
-	return a.conn.WriteMessage(websocket.TextMessage, data)
+	if a.WriteTimeout > 0 {
+		a.conn.SetWriteDeadline(time.Now().Add(a.WriteTimeout))
+	}
+	err = a.conn.WriteMessage(websocket.TextMessage, data)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		// The connection is unusable after a failed write; closing it makes the
+		// read loop report it dropped
+		a.logger().Warn("Signaling write timed out, dropping the connection", "timeout", a.WriteTimeout)
+		a.conn.Close()
+	}
+	return err
 }
 
+// DefaultWriteTimeout is the default App.WriteTimeout.
+const DefaultWriteTimeout = 10 * time.Second
+
+// DefaultMaxSignalAge is the default App.MaxSignalAge, generous enough for
+// devices whose clocks aren't synchronized.
+const DefaultMaxSignalAge = 2 * time.Minute
+
 // handleSignaling processes incoming signaling messages from WebSocket
-func (a *App) handleSignaling(ctx context.Context) {
+func (a *App) handleSignaling(ctx context.Context, conn *websocket.Conn) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -153,15 +1010,29 @@ func (a *App) handleSignaling(ctx context.Context) {
 		default:
 		}
 
-		_, data, err := a.conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
-			log.Println("Signaling read error:", err)
+			if ctx.Err() != nil {
+				return // Suspended or shutting down
+			}
+			var closeErr *websocket.CloseError
+			if errors.Is(err, websocket.ErrReadLimit) {
+				a.logger().Error("Signaling connection closed, message too large", "limit", a.MaxMessageSize)
+			} else if errors.As(err, &closeErr) {
+				a.logger().Warn("Signaling server closed the connection", "code", closeErr.Code, "reason", closeErr.Text)
+			} else {
+				a.logger().Warn("Signaling read error", "err", err)
+			}
+			select {
+			case a.dropped <- struct{}{}:
+			default:
+			}
 			return
 		}
 
 		msg, err := signaling.Unmarshal(data)
 		if err != nil {
-			log.Println("Invalid signaling message:", err)
+			a.logger().Warn("Invalid signaling message", "err", err)
 			continue
 		}
 
@@ -170,114 +1041,275 @@ func (a *App) handleSignaling(ctx context.Context) {
 			continue
 		}
 
+		// Peers we can't talk to are reported when they join and otherwise ignored
+		version, compatible := signaling.Negotiate(msg.Version, msg.MinVersion)
+		if !compatible {
+			if msg.Type == signaling.TypeJoin {
+				if msg.Version < signaling.MinProtocolVersion {
+					a.logger().Warn("Peer runs an older release whose clipboard format we can't read, not connecting to it; update it",
+						"peer", msg.FromPeer, "version", msg.Version, "min", signaling.MinProtocolVersion)
+				} else {
+					a.logger().Warn("Peer runs a newer release we can't talk to, not connecting to it; update this client",
+						"peer", msg.FromPeer, "version", msg.Version, "max", signaling.ProtocolVersion)
+				}
+				a.recordPeerError(msg.FromPeer, "incompatible protocol version %d", msg.Version)
+			}
+			continue
+		}
+
+		// Old offers or candidates replayed by whoever captured them are useless
+		// at best, so drop them
+		if msg.Stale(time.Now(), a.MaxSignalAge) {
+			a.logger().Warn("Dropped a stale signaling message", "peer", msg.FromPeer, "type", msg.Type, "sent", time.UnixMilli(msg.Timestamp).Format(time.RFC3339))
+			continue
+		}
+
 		// Handle message based on type
 		switch msg.Type {
 		case signaling.TypeJoin:
-			log.Printf("[PEER JOIN] %s joined the room", msg.FromPeer)
-			// Initiate connection to new peer (we send offer)
-			go a.initiateConnection(msg.FromPeer)
+			// A targeted join is a peer already in the room asking us to initiate
+			a.checkJoinCommitment(msg)
+			if msg.Resume && a.channelOpen(msg.FromPeer) {
+				a.logger().Info("Peer reconnected to the server, keeping our connection", "peer", msg.FromPeer)
+				continue
+			}
+			if msg.ToPeer == "" {
+				a.logger().Info("Peer joined", "peer", msg.FromPeer)
+			}
+			if msg.Version != signaling.ProtocolVersion {
+				a.logger().Warn("Peer runs a different release, talking to it at a common version",
+					"peer", msg.FromPeer, "peer_version", msg.Version, "version", version)
+			}
+			if signaling.ShouldInitiate(a.peerID, msg.FromPeer) {
+				go a.initiateConnection(msg.FromPeer, 1)
+			} else if msg.ToPeer == "" {
+				a.sendSignal(signaling.NewJoin(a.peerID, msg.FromPeer, a.joinCommitment()))
+			}
 
 		case signaling.TypeLeave:
-			log.Printf("[PEER LEAVE] %s left the room", msg.FromPeer)
+			a.logger().Info("Peer left", "peer", msg.FromPeer)
 			a.closePeerConnection(msg.FromPeer)
+			a.mu.Lock()
+			delete(a.outboxes, msg.FromPeer)
+			delete(a.negotiations, msg.FromPeer)
+			a.mu.Unlock()
+			a.decryptFailures.forget(msg.FromPeer)
+			a.ignoredPayloads.forget(msg.FromPeer)
+			a.reassembly.Forget(msg.FromPeer)
+			a.status.remove(msg.FromPeer)
 
 		case signaling.TypeOffer:
-			log.Printf("[OFFER] from %s", msg.FromPeer)
+			a.acknowledge(msg)
 			go a.handleOffer(msg.FromPeer, msg.Payload)
 
 		case signaling.TypeAnswer:
-			log.Printf("[ANSWER] from %s", msg.FromPeer)
+			a.acknowledge(msg)
 			go a.handleAnswer(msg.FromPeer, msg.Payload)
 
+		case signaling.TypeAck:
+			a.handleAck(msg)
+
 		case signaling.TypeCandidate:
 			go a.handleCandidate(msg.FromPeer, msg.Payload)
+
+		case signaling.TypeRelay:
+			blob, err := base64.StdEncoding.DecodeString(msg.Payload)
+			if err != nil {
+				a.logger().Warn("Invalid relayed payload", "peer", msg.FromPeer, "err", err)
+				continue
+			}
+			a.handlePayload(msg.FromPeer, blob)
 		}
 	}
 }
 
-// initiateConnection creates a new PeerConnection and sends an offer
-func (a *App) initiateConnection(remotePeerID string) {
+// acquireHandshake blocks until a handshake slot is free and returns the function
+// releasing it. This smooths the CPU spike when many peers join at once.
+func (a *App) acquireHandshake() (release func()) {
+	a.handshakes <- struct{}{}
+	return func() { <-a.handshakes }
+}
+
+// DataChannel labels. Channels opened by a peer with any other label are rejected.
+const (
+	labelClipboard = "clipboard" // Encrypted clipboard data
+	labelControl   = "control"   // Control messages, e.g. heartbeats
+)
+
+// Retry policy for DataChannels that never open, a known pion edge case where the
+// PeerConnection reaches Connected but the channel's OnOpen never fires.
+const (
+	dataChannelOpenTimeout = 20 * time.Second
+	maxConnectAttempts     = 3
+)
+
+// initiateConnection creates a new PeerConnection and sends an offer.
+// attempt counts the connection attempts made for this peer, starting at 1.
+func (a *App) initiateConnection(remotePeerID string, attempt int) {
+	if !a.startOffer(remotePeerID) {
+		a.logger().Debug("Already sending an offer, not starting another", "peer", remotePeerID)
+		return
+	}
+	defer a.finishOffer(remotePeerID)
+	defer a.acquireHandshake()()
+
 	pc, err := a.createPeerConnection(remotePeerID, true)
 	if err != nil {
-		log.Printf("Failed to create PeerConnection for %s: %v", remotePeerID, err)
+		a.logger().Error("Failed to create PeerConnection", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "create connection: %v", err)
 		return
 	}
 
-	// Create DataChannel (initiator creates it)
-	// the default options (nil) ensures the UDP packets maintain ordering
-	// which is crucial for clipboard data to be consistently synced through different machines
-	dc, err := pc.CreateDataChannel("clipboard", nil)
+	// Create DataChannel (initiator creates it), the responder gets it with the same options
+	dc, err := pc.CreateDataChannel(labelClipboard, a.DataChannel.init())
 	if err != nil {
-		log.Printf("Failed to create DataChannel: %v", err)
+		a.logger().Error("Failed to create DataChannel", "peer", remotePeerID, "err", err)
 		return
 	}
-	a.setupDataChannel(remotePeerID, dc)
+	opened := a.setupDataChannel(remotePeerID, dc)
+	go a.watchDataChannelOpen(remotePeerID, pc, opened, attempt)
+
+	// The control channel carries heartbeats; peers predating it ignore it
+	ctrl, err := pc.CreateDataChannel(labelControl, nil)
+	if err != nil {
+		a.logger().Error("Failed to create control DataChannel", "peer", remotePeerID, "err", err)
+		return
+	}
+	a.setupControlChannel(remotePeerID, ctrl)
 
 	// Create and send offer
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
-		log.Printf("Failed to create offer: %v", err)
+		a.logger().Error("Failed to create offer", "peer", remotePeerID, "err", err)
 		return
 	}
 
 	if err := pc.SetLocalDescription(offer); err != nil {
-		log.Printf("Failed to set local description: %v", err)
+		a.logger().Error("Failed to set local description", "peer", remotePeerID, "err", err)
 		return
 	}
 
-	// Wait for ICE gathering to complete
-	<-webrtc.GatheringCompletePromise(pc)
+	// Wait for ICE gathering to complete. The peer may leave meanwhile, in which
+	// case sending the offer would leave a half-open connection on its side.
+	if !a.waitForGathering(remotePeerID, pc) {
+		a.logger().Info("Peer left during the handshake, not sending the offer", "peer", remotePeerID)
+		return
+	}
 
+	a.logger().Debug("Sending offer", "peer", remotePeerID, "sdp", pc.LocalDescription().SDP)
 	offerJSON, _ := json.Marshal(pc.LocalDescription())
-	a.sendSignal(&signaling.Message{
-		Type:     signaling.TypeOffer,
-		FromPeer: a.peerID,
-		ToPeer:   remotePeerID,
-		Payload:  string(offerJSON),
-	})
+	a.sendAcked(signaling.NewOffer(a.peerID, remotePeerID, string(offerJSON)))
+}
+
+// watchDataChannelOpen tears down and retries the peer connection if the DataChannel
+// hasn't opened within openTimeout, giving up after maxConnectAttempts.
+func (a *App) watchDataChannelOpen(remotePeerID string, pc *webrtc.PeerConnection, opened <-chan struct{}, attempt int) {
+	select {
+	case <-opened:
+		return
+	case <-time.After(a.openTimeout):
+	}
+
+	// The connection may have been replaced or closed in the meantime
+	if !a.isCurrentPeer(remotePeerID, pc) {
+		return
+	}
+
+	a.closePeerConnection(remotePeerID)
+	a.recordPeerError(remotePeerID, "DataChannel did not open within %s (attempt %d/%d)", a.openTimeout, attempt, maxConnectAttempts)
+	if attempt >= maxConnectAttempts {
+		a.logger().Error("DataChannel did not open, giving up", "peer", remotePeerID, "attempts", attempt)
+		return
+	}
+	a.logger().Warn("DataChannel did not open in time, retrying with a fresh connection",
+		"peer", remotePeerID, "timeout", a.openTimeout, "attempt", attempt, "max_attempts", maxConnectAttempts)
+	a.initiateConnection(remotePeerID, attempt+1)
+}
+
+// gatheringCheckInterval is how often waitForGathering checks whether the peer left.
+const gatheringCheckInterval = 250 * time.Millisecond
+
+// waitForGathering blocks until ICE gathering for pc completes. It returns false
+// as soon as pc is closed or replaced, since a closed PeerConnection never
+// finishes gathering.
+func (a *App) waitForGathering(remotePeerID string, pc *webrtc.PeerConnection) bool {
+	gathered := webrtc.GatheringCompletePromise(pc)
+	ticker := time.NewTicker(gatheringCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-gathered:
+			return a.isCurrentPeer(remotePeerID, pc)
+		case <-ticker.C:
+			if !a.isCurrentPeer(remotePeerID, pc) {
+				return false
+			}
+		}
+	}
+}
+
+// isCurrentPeer reports whether pc is still the registered connection for a peer.
+func (a *App) isCurrentPeer(remotePeerID string, pc *webrtc.PeerConnection) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.peers[remotePeerID] == pc
 }
 
 // handleOffer processes an SDP offer from a remote peer
 func (a *App) handleOffer(remotePeerID, payload string) {
 	var offer webrtc.SessionDescription
 	if err := json.Unmarshal([]byte(payload), &offer); err != nil {
-		log.Printf("Failed to parse offer: %v", err)
+		a.logger().Warn("Failed to parse offer", "peer", remotePeerID, "err", err)
+		return
+	}
+	a.logger().Debug("Offer received", "peer", remotePeerID, "sdp", offer.SDP)
+
+	accept, collision := a.acceptOffer(remotePeerID)
+	if !accept {
+		a.logger().Debug("Ignoring an offer colliding with ours", "peer", remotePeerID)
 		return
 	}
+	if collision {
+		a.logger().Debug("Offer collides with ours, answering it instead", "peer", remotePeerID)
+	}
+
+	defer a.acquireHandshake()()
 
 	pc, err := a.createPeerConnection(remotePeerID, false)
 	if err != nil {
-		log.Printf("Failed to create PeerConnection for %s: %v", remotePeerID, err)
+		a.logger().Error("Failed to create PeerConnection", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "create connection: %v", err)
 		return
 	}
 
 	if err := pc.SetRemoteDescription(offer); err != nil {
-		log.Printf("Failed to set remote description: %v", err)
+		a.logger().Warn("Failed to set remote description", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "set remote description: %v", err)
 		return
 	}
 
 	// Create and send answer
 	answer, err := pc.CreateAnswer(nil)
 	if err != nil {
-		log.Printf("Failed to create answer: %v", err)
+		a.logger().Error("Failed to create answer", "peer", remotePeerID, "err", err)
 		return
 	}
 
 	if err := pc.SetLocalDescription(answer); err != nil {
-		log.Printf("Failed to set local description: %v", err)
+		a.logger().Error("Failed to set local description", "peer", remotePeerID, "err", err)
 		return
 	}
 
 	// Wait for ICE gathering to complete
-	<-webrtc.GatheringCompletePromise(pc)
+	if !a.waitForGathering(remotePeerID, pc) {
+		a.logger().Info("Peer left during the handshake, not sending the answer", "peer", remotePeerID)
+		return
+	}
 
+	a.logger().Debug("Sending answer", "peer", remotePeerID, "sdp", pc.LocalDescription().SDP)
 	answerJSON, _ := json.Marshal(pc.LocalDescription())
-	a.sendSignal(&signaling.Message{
-		Type:     signaling.TypeAnswer,
-		FromPeer: a.peerID,
-		ToPeer:   remotePeerID,
-		Payload:  string(answerJSON),
-	})
+	a.sendAcked(signaling.NewAnswer(a.peerID, remotePeerID, string(answerJSON)))
 }
 
 // handleAnswer processes an SDP answer from a remote peer
@@ -287,18 +1319,20 @@ func (a *App) handleAnswer(remotePeerID, payload string) {
 	a.mu.RUnlock()
 
 	if !exists {
-		log.Printf("No PeerConnection for %s", remotePeerID)
+		a.logger().Warn("Answer for an unknown connection", "peer", remotePeerID)
 		return
 	}
 
 	var answer webrtc.SessionDescription
 	if err := json.Unmarshal([]byte(payload), &answer); err != nil {
-		log.Printf("Failed to parse answer: %v", err)
+		a.logger().Warn("Failed to parse answer", "peer", remotePeerID, "err", err)
 		return
 	}
+	a.logger().Debug("Answer received", "peer", remotePeerID, "sdp", answer.SDP)
 
 	if err := pc.SetRemoteDescription(answer); err != nil {
-		log.Printf("Failed to set remote description: %v", err)
+		a.logger().Warn("Failed to set remote description", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "set remote description: %v", err)
 	}
 }
 
@@ -314,39 +1348,58 @@ func (a *App) handleCandidate(remotePeerID, payload string) {
 
 	var candidate webrtc.ICECandidateInit
 	if err := json.Unmarshal([]byte(payload), &candidate); err != nil {
-		log.Printf("Failed to parse ICE candidate: %v", err)
+		a.logger().Warn("Failed to parse ICE candidate", "peer", remotePeerID, "err", err)
 		return
 	}
+	a.logger().Debug("Remote ICE candidate", "peer", remotePeerID, "candidate", candidate.Candidate)
 
 	if err := pc.AddICECandidate(candidate); err != nil {
-		log.Printf("Failed to add ICE candidate: %v", err)
+		// Candidates of an offer we ignored don't fit our connection
+		if a.ignoringOffer(remotePeerID) {
+			return
+		}
+		a.logger().Warn("Failed to add ICE candidate", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "add ICE candidate: %v", err)
 	}
 }
 
 // createPeerConnection creates and registers a new WebRTC PeerConnection
 func (a *App) createPeerConnection(remotePeerID string, isInitiator bool) (*webrtc.PeerConnection, error) {
-	pc, err := webrtc.NewPeerConnection(getWebRTCConfig())
+	pc, err := webrtc.NewPeerConnection(a.webRTCConfig())
 	if err != nil {
 		return nil, err
 	}
 
 	// Register connection state handler
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
-		log.Printf("[P2P %s] Connection state: %s", remotePeerID, state.String())
+		a.logger().Debug("Connection state changed", "peer", remotePeerID, "state", state.String())
+		if a.isCurrentPeer(remotePeerID, pc) {
+			a.status.update(remotePeerID, func(s *PeerStatus) { s.State = state.String() })
+			if state == webrtc.PeerConnectionStateFailed {
+				a.recordPeerError(remotePeerID, "connection failed")
+			}
+		}
+		// Ignore a stale connection that has already been replaced by a retry
 		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
-			a.closePeerConnection(remotePeerID)
+			// The peer is gone without a leave, drop what was queued for it too
+			a.mu.Lock()
+			current := a.peers[remotePeerID] == pc
+			if current {
+				delete(a.outboxes, remotePeerID)
+			}
+			a.mu.Unlock()
+			if current {
+				a.closePeerConnection(remotePeerID)
+			}
 		}
 		if state == webrtc.PeerConnectionStateConnected {
-			log.Printf(">> P2P: Direct connection established with %s", remotePeerID)
+			a.logger().Info("Direct connection established", "peer", remotePeerID)
 		}
 	})
 
 	// Handle incoming DataChannel (for non-initiator)
 	if !isInitiator {
-		pc.OnDataChannel(func(dc *webrtc.DataChannel) {
-			log.Printf("[P2P %s] DataChannel '%s' received", remotePeerID, dc.Label())
-			a.setupDataChannel(remotePeerID, dc)
-		})
+		pc.OnDataChannel(func(dc *webrtc.DataChannel) { a.routeDataChannel(remotePeerID, dc) })
 	}
 
 	// Handle ICE candidates
@@ -354,51 +1407,302 @@ func (a *App) createPeerConnection(remotePeerID string, isInitiator bool) (*webr
 		if c == nil {
 			return
 		}
+		a.logger().Debug("Local ICE candidate", "peer", remotePeerID, "candidate", c.String())
 		candidateJSON, _ := json.Marshal(c.ToJSON())
-		a.sendSignal(&signaling.Message{
-			Type:     signaling.TypeCandidate,
-			FromPeer: a.peerID,
-			ToPeer:   remotePeerID,
-			Payload:  string(candidateJSON),
-		})
+		a.sendSignal(signaling.NewCandidate(a.peerID, remotePeerID, string(candidateJSON)))
 	})
 
 	a.mu.Lock()
+	previous := a.peers[remotePeerID]
 	a.peers[remotePeerID] = pc
+	if _, exists := a.outboxes[remotePeerID]; !exists {
+		a.outboxes[remotePeerID] = &outbox{}
+	}
 	a.mu.Unlock()
+	a.status.update(remotePeerID, func(s *PeerStatus) {
+		s.State = webrtc.PeerConnectionStateNew.String()
+		s.ChannelOpen = false
+	})
+
+	// A renegotiation from the peer replaces any connection we still hold for it
+	if previous != nil {
+		previous.Close()
+	}
 
 	return pc, nil
 }
 
-// setupDataChannel configures event handlers for a DataChannel
-func (a *App) setupDataChannel(remotePeerID string, dc *webrtc.DataChannel) {
+// routeDataChannel sets up a DataChannel opened by the peer according to its
+// label. Channels with any other label are closed, so they are never mistaken
+// for clipboard data.
+func (a *App) routeDataChannel(remotePeerID string, dc *webrtc.DataChannel) {
+	a.logger().Debug("DataChannel received", "peer", remotePeerID, "label", dc.Label())
+	switch dc.Label() {
+	case labelClipboard:
+		if got := describeDataChannel(dc); got != a.DataChannel {
+			a.logger().Warn("Peer opened the DataChannel with other options, using theirs", "peer", remotePeerID, "theirs", got.String(), "ours", a.DataChannel.String())
+		}
+		a.setupDataChannel(remotePeerID, dc)
+	case labelControl:
+		// Never routed as clipboard data
+		a.setupControlChannel(remotePeerID, dc)
+	default:
+		a.logger().Warn("Peer opened a DataChannel with an unexpected label, closing it", "peer", remotePeerID, "label", dc.Label())
+		dc.Close()
+	}
+}
+
+// setupDataChannel configures event handlers for a DataChannel. The returned
+// channel is closed once the DataChannel opens.
+func (a *App) setupDataChannel(remotePeerID string, dc *webrtc.DataChannel) <-chan struct{} {
+	opened := make(chan struct{})
+	var openOnce sync.Once
+
 	dc.OnOpen(func() {
-		log.Printf(">> DataChannel: Connected to %s", remotePeerID)
+		openOnce.Do(func() { close(opened) })
+		a.logger().Info("DataChannel open", "peer", remotePeerID)
 		a.mu.Lock()
 		a.dataChans[remotePeerID] = dc
 		a.mu.Unlock()
+		a.status.update(remotePeerID, func(s *PeerStatus) { s.ChannelOpen = true })
+
+		// Deliver anything queued while the channel was down before newer copies.
+		a.flushOutbox(remotePeerID)
 	})
 
 	dc.OnClose(func() {
-		log.Printf(">> DataChannel: Closed with %s", remotePeerID)
+		a.logger().Info("DataChannel closed", "peer", remotePeerID)
 		a.mu.Lock()
-		delete(a.dataChans, remotePeerID)
+		current := a.dataChans[remotePeerID] == dc
+		if current {
+			delete(a.dataChans, remotePeerID)
+		}
 		a.mu.Unlock()
+		if current {
+			a.status.update(remotePeerID, func(s *PeerStatus) { s.ChannelOpen = false })
+		}
 	})
 
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		// Received encrypted clipboard data from peer
-		decrypted, err := crypto.Decrypt(msg.Data, a.key)
-		if err != nil {
-			log.Printf("Decryption failed (Wrong Password?): %v", err)
+		a.handlePayload(remotePeerID, msg.Data)
+	})
+
+	// Resume a flush paused for the send buffer; the callback runs on the SCTP
+	// read loop, which mustn't wait for the outbox
+	dc.SetBufferedAmountLowThreshold(bufferedAmountLow)
+	dc.OnBufferedAmountLow(func() { go a.flushOutbox(remotePeerID) })
+
+	return opened
+}
+
+// nonceHistory is how many recent message nonces are remembered to detect reuse.
+const nonceHistory = 4096
+
+// maxDataChannelMessage is the largest message sent in one DataChannel send,
+// larger ones are fragmented. 16KB is delivered by every WebRTC stack.
+const maxDataChannelMessage = 16 << 10
+
+// Limits on the fragmented messages being reassembled, across all peers.
+const (
+	maxReassemblyTransfers = 16
+	maxReassemblyBytes     = 32 << 20
+	reassemblyTimeout      = 30 * time.Second
+)
+
+// reassemble adds a fragment to its message and returns the inner envelope once
+// all fragments have arrived, or nil while the message is still incomplete.
+func (a *App) reassemble(remotePeerID string, env *protocol.Envelope) (*protocol.Envelope, error) {
+	frag, err := protocol.UnmarshalFragment(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	data, err := a.reassembly.Add(remotePeerID, frag)
+	if data == nil {
+		return nil, err
+	}
+
+	inner, err := protocol.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if inner.Flags&protocol.FlagFragment != 0 {
+		return nil, errors.New("nested fragment")
+	}
+	return inner, nil
+}
+
+// handlePayload decrypts clipboard data received from a peer (directly or relayed)
+// and writes it to the local clipboard.
+func (a *App) handlePayload(remotePeerID string, data []byte) {
+	if a.PublisherToken != "" {
+		if ok, suppressed := a.ignoredPayloads.record(remotePeerID, time.Now()); ok {
+			a.logger().Info("Ignoring clipboard from a peer, this peer only sends", "peer", remotePeerID, "suppressed", suppressed)
+		}
+		return
+	}
+
+	env, err := protocol.Unmarshal(data)
+	if err != nil {
+		a.logger().Warn("Invalid message", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "invalid message: %v", err)
+		return
+	}
+
+	if env.Flags&protocol.FlagFragment != 0 {
+		env, err = a.reassemble(remotePeerID, env)
+		if env == nil {
+			if err != nil {
+				a.logger().Warn("Dropped a fragmented message", "peer", remotePeerID, "err", err)
+				a.recordPeerError(remotePeerID, "fragmented message dropped: %v", err)
+			}
 			return
 		}
-		log.Printf("[REMOTE PASTE] Received %d bytes from %s. Updating Clipboard.", len(decrypted), remotePeerID)
-		a.clipboard.WriteSafely(decrypted)
-	})
+	}
+
+	body, err := a.openPayload(remotePeerID, env)
+	if errors.Is(err, crypto.ErrNonceReuse) {
+		a.recordPeerError(remotePeerID, "nonce reuse (replayed message?)")
+		a.logger().Warn("Dropped a message reusing a recent nonce (replayed message?)", "peer", remotePeerID)
+		return
+	}
+	if err != nil {
+		// An authentication failure means the peer uses another key or room,
+		// anything else is a malformed frame
+		hint := "malformed message"
+		if errors.Is(err, crypto.ErrDecryptAuth) {
+			hint = "wrong password or room?"
+		}
+		a.recordPeerError(remotePeerID, "decryption failed (%s): %v", hint, err)
+		if ok, suppressed := a.decryptFailures.record(remotePeerID, time.Now()); ok {
+			a.logger().Warn("Decryption failed", "peer", remotePeerID, "hint", hint, "err", err, "suppressed", suppressed)
+		}
+		return
+	}
+
+	a.touch()
+	a.markSynced(remotePeerID)
+	if a.PauseIncoming && a.clipboard.Paused() {
+		a.logger().Info("Paused, dropped content from a peer", "peer", remotePeerID)
+		return
+	}
+	if mime := protocol.MIMEType(env.Format, body); !a.accepts(mime) {
+		a.logger().Info("Dropped content that isn't an accepted type", "peer", remotePeerID, "type", mime)
+		return
+	}
+
+	switch env.Format {
+	case protocol.FormatText, protocol.FormatImage:
+	case protocol.FormatOpaque:
+		// The clipboard library can only write text and images, so formats passed
+		// through verbatim can't be reconstructed here yet.
+		if name, data, err := protocol.DecodeOpaque(body); err == nil {
+			a.logger().Info("Ignoring a format not supported on this device", "peer", remotePeerID, "format", name, "bytes", len(data))
+		} else {
+			a.logger().Warn("Invalid opaque format", "peer", remotePeerID, "err", err)
+		}
+		return
+	default:
+		a.logger().Warn("Unsupported clipboard format", "peer", remotePeerID, "format", env.Format)
+		return
+	}
+
+	if !a.allowSync(body) {
+		return
+	}
+
+	if env.Flags&protocol.FlagBatch == 0 {
+		if env.Format == protocol.FormatImage {
+			a.logger().Debug("Received an image", "peer", remotePeerID, "bytes", len(body))
+		} else {
+			a.logger().Debug("Received clipboard", "peer", remotePeerID, "content", a.LogPolicy.Describe(body))
+		}
+		a.paste(remotePeerID, env.Format, body)
+		a.audit(audit.Received, remotePeerID, body)
+		return
+	}
+
+	entries, err := protocol.DecodeBatch(body)
+	if err != nil {
+		a.logger().Warn("Invalid batch", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "invalid batch: %v", err)
+		return
+	}
+	// Only the newest entry goes to the clipboard, the others are kept in history
+	last := len(entries) - 1
+	for _, entry := range entries[:last] {
+		a.clipboard.Remember(clipboardFormat(env.Format), entry)
+	}
+	a.logger().Debug("Received a batch", "peer", remotePeerID, "entries", len(entries))
+	a.paste(remotePeerID, env.Format, entries[last])
+	a.audit(audit.Received, remotePeerID, entries...)
+}
+
+// allowSync runs content through the loop circuit breaker.
+func (a *App) allowSync(content []byte) bool {
+	ok, tripped := a.loops.allow(content, time.Now())
+	if tripped {
+		a.logger().Warn("The same content keeps being synced, which looks like a sync loop "+
+			"(is another clipboard tool rewriting the clipboard?); suspending syncing",
+			"times", loopThreshold, "within", loopWindow, "suspended_for", loopCooldown)
+	}
+	return ok
+}
+
+// accepts reports whether content of the given MIME type may be received.
+func (a *App) accepts(mime string) bool {
+	if len(a.AcceptTypes) == 0 {
+		return true
+	}
+	for _, pattern := range a.AcceptTypes {
+		if pattern == mime || pattern == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mime, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// audit records synced items in the audit log, if one is configured.
+func (a *App) audit(direction, peer string, items ...[]byte) {
+	if a.AuditLog == nil {
+		return
+	}
+	for _, item := range items {
+		if err := a.AuditLog.Log(direction, peer, item); err != nil {
+			a.logger().Error("Failed to write the audit log", "err", err)
+			return
+		}
+	}
+}
+
+// flushOutbox sends the queued payloads for a peer if its DataChannel is open.
+func (a *App) flushOutbox(remotePeerID string) {
+	a.mu.RLock()
+	dc := a.dataChans[remotePeerID]
+	ob := a.outboxes[remotePeerID]
+	a.mu.RUnlock()
+
+	if dc == nil || ob == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	sent, dropped, err := ob.flush(dc, a.QueueTTL)
+	if sent > 0 {
+		a.markSynced(remotePeerID)
+	}
+	if dropped > 0 {
+		a.logger().Warn("Dropped stale queued items", "peer", remotePeerID, "count", dropped)
+	}
+	if err != nil {
+		a.logger().Warn("Failed to send", "peer", remotePeerID, "err", err)
+		a.recordPeerError(remotePeerID, "send: %v", err)
+	}
 }
 
-// closePeerConnection cleans up a peer connection
+// closePeerConnection cleans up a peer connection. The peer's outbox is kept so
+// queued payloads can be delivered if the connection is re-established.
 func (a *App) closePeerConnection(remotePeerID string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -407,6 +1711,12 @@ func (a *App) closePeerConnection(remotePeerID string) {
 	if dc, exists := a.dataChans[remotePeerID]; exists {
 		dc.Close()
 		delete(a.dataChans, remotePeerID)
+		a.status.update(remotePeerID, func(s *PeerStatus) { s.ChannelOpen = false })
+	}
+
+	if hb, exists := a.heartbeats[remotePeerID]; exists {
+		hb.dc.Close()
+		delete(a.heartbeats, remotePeerID)
 	}
 
 	// Close and delete the peer connection for the peer requesting it.
@@ -416,33 +1726,356 @@ func (a *App) closePeerConnection(remotePeerID string) {
 	}
 }
 
-// handleOutgoingClipboard watches for clipboard changes and broadcasts to all peers
-func (a *App) handleOutgoingClipboard(ctx context.Context) {
-	updates := a.clipboard.Watch(ctx)
-	log.Println(">> Clipboard: Clipboard watcher started.")
+// watchProbe is how long the clipboard watcher has to stay open at startup to be
+// considered healthy.
+const watchProbe = 500 * time.Millisecond
+
+// startClipboardWatch starts the clipboard watcher and makes sure it doesn't close
+// right away, which happens on some misconfigured clipboard backends. Init is retried
+// once before giving up, so sync never runs "connected but dead".
+func (a *App) startClipboardWatch(ctx context.Context) (<-chan clipboard.Update, error) {
+	for attempt := 1; ; attempt++ {
+		updates, ok := probeWatch(ctx, a.clipboard.Watch(ctx))
+		if ok {
+			a.logger().Info("Clipboard watcher started")
+			return updates, nil
+		}
+		if attempt == 2 {
+			return nil, fmt.Errorf("clipboard watcher stopped immediately: the clipboard backend is not working " +
+				"(on Linux, make sure DISPLAY is set and an X11 or XWayland server is reachable)")
+		}
 
-	for data := range updates {
-		if a.clipboard.ShouldIgnore(data) {
-			continue
+		a.logger().Warn("Clipboard watcher stopped immediately, re-initializing the clipboard")
+		if err := a.clipboard.Init(); err != nil {
+			return nil, fmt.Errorf("clipboard init failed: %w", err)
 		}
+	}
+}
 
-		log.Printf("[LOCAL COPY] %d bytes. Encrypting & sending to peers...", len(data))
+// Backoff between attempts to recover a clipboard watcher that stopped.
+const (
+	clipboardRetryBase = time.Second
+	clipboardRetryMax  = 30 * time.Second
+)
 
-		encrypted, err := crypto.Encrypt(data, a.key)
-		if err != nil {
-			log.Printf("Encryption error: %v", err)
+// recoverClipboardWatch re-initializes the clipboard after its watcher stopped,
+// backing off between attempts. It returns nil once ClipboardRetry attempts failed
+// or ctx is done.
+func (a *App) recoverClipboardWatch(ctx context.Context) <-chan clipboard.Update {
+	a.clipboardDown.Store(true)
+	delay := a.retryBase
+	for attempt := 1; attempt <= a.ClipboardRetry; attempt++ {
+		a.logger().Warn("Clipboard watcher stopped, re-initializing", "in", delay, "attempt", attempt, "max_attempts", a.ClipboardRetry)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, clipboardRetryMax)
+
+		if err := a.clipboard.Init(); err != nil {
+			a.logger().Error("Clipboard init failed", "err", err)
 			continue
 		}
+		if updates, ok := probeWatch(ctx, a.clipboard.Watch(ctx)); ok {
+			a.logger().Info("Clipboard watcher recovered, local copies are synced again")
+			a.clipboardDown.Store(false)
+			return updates
+		}
+	}
+	return nil
+}
+
+// History returns the recent clipboard items, copied locally or received from
+// peers, oldest first.
+func (a *App) History() []clipboard.HistoryEntry {
+	return a.clipboard.History()
+}
+
+// ClipboardHealthy reports whether local copies are currently being watched.
+func (a *App) ClipboardHealthy() bool {
+	return !a.clipboardDown.Load()
+}
 
-		// Broadcast to all connected peers via DataChannels
-		a.mu.RLock()
-		for peerID, dc := range a.dataChans {
-			if dc.ReadyState() == webrtc.DataChannelStateOpen {
-				if err := dc.Send(encrypted); err != nil {
-					log.Printf("Failed to send to %s: %v", peerID, err)
+// probeWatch waits briefly to see whether updates is closed immediately. An update
+// that arrives during the probe is not lost: it is replayed on the returned channel.
+func probeWatch(ctx context.Context, updates <-chan clipboard.Update) (<-chan clipboard.Update, bool) {
+	select {
+	case first, ok := <-updates:
+		if !ok {
+			return nil, false
+		}
+		out := make(chan clipboard.Update)
+		go func() {
+			defer close(out)
+			for update := first; ; {
+				select {
+				case out <- update:
+				case <-ctx.Done():
+					return
 				}
+				if update, ok = <-updates; !ok {
+					return
+				}
+			}
+		}()
+		return out, true
+	case <-time.After(watchProbe):
+		return updates, true
+	}
+}
+
+// DefaultDebounce is the default App.Debounce, short enough not to be noticed.
+const DefaultDebounce = 150 * time.Millisecond
+
+// handleOutgoingClipboard reads clipboard changes and broadcasts them to all peers
+func (a *App) handleOutgoingClipboard(ctx context.Context, updates <-chan clipboard.Update) {
+	defer func() {
+		if ctx.Err() == nil {
+			a.logger().Error("Clipboard watcher stopped unexpectedly, local copies are no longer synced")
+		}
+	}()
+
+	var batch [][]byte
+	var flush <-chan time.Time // Fires when the batch window closes
+
+	var pending clipboard.Update // Latest copy waiting for the debounce interval
+	var skipped int              // Copies replaced by a newer one while waiting
+	var settle <-chan time.Time  // Fires once copies stopped for the debounce interval
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				if ctx.Err() != nil {
+					return
+				}
+				if updates = a.recoverClipboardWatch(ctx); updates == nil {
+					return
+				}
+				continue
+			}
+			data := update.Content
+			if a.clipboard.ShouldIgnore(data) {
+				continue
+			}
+
+			if app, allowed := a.AppFilter.Check(); !allowed {
+				if app == "" {
+					a.logger().Info("Copy not synced, the app filter couldn't tell which application it came from")
+				} else {
+					a.logger().Info("Copy not synced, the application is excluded by the app filter", "app", app)
+				}
+				continue
+			}
+
+			if !a.allowSync(data) {
+				continue
+			}
+			a.localActivity()
+
+			// Images are never batched, a batch holds text entries
+			if update.Format == clipboard.FmtImage || a.BatchWindow <= 0 {
+				if a.Debounce <= 0 {
+					a.sendCopy(update)
+					continue
+				}
+				if settle != nil {
+					skipped++
+				}
+				pending, settle = update, a.after(a.Debounce)
+				continue
+			}
+
+			// Keep distinct entries in copy order; a repeated copy moves to the end
+			batch = slices.DeleteFunc(batch, func(entry []byte) bool { return bytes.Equal(entry, data) })
+			batch = append(batch, data)
+			if flush == nil {
+				flush = a.after(a.BatchWindow)
+			}
+
+		case <-flush:
+			if len(batch) == 1 {
+				a.logger().Debug("Sending a local copy", "content", a.LogPolicy.Describe(batch[0]))
+				a.sendClipboard(0, protocol.FormatText, batch[0])
+			} else {
+				a.logger().Debug("Sending a batch of local copies", "entries", len(batch))
+				a.sendClipboard(protocol.FlagBatch, protocol.FormatText, protocol.EncodeBatch(batch))
+			}
+			a.audit(audit.Sent, "*", batch...)
+			batch, flush = nil, nil
+
+		case <-settle:
+			if skipped > 0 {
+				a.logger().Debug("Skipped copies made in quick succession, sending the last one", "skipped", skipped)
+			}
+			a.sendCopy(pending)
+			pending, skipped, settle = clipboard.Update{}, 0, nil
+		}
+	}
+}
+
+// sendCopy sends a local copy to all peers.
+func (a *App) sendCopy(update clipboard.Update) {
+	if update.Format == clipboard.FmtImage {
+		a.logger().Debug("Sending a copied image", "bytes", len(update.Content))
+		a.sendClipboard(0, protocol.FormatImage, update.Content)
+	} else {
+		a.logger().Debug("Sending a local copy", "content", a.LogPolicy.Describe(update.Content))
+		a.sendClipboard(0, protocol.FormatText, update.Content)
+	}
+	a.audit(audit.Sent, "*", update.Content)
+}
+
+// TogglePause pauses syncing local copies, or resumes it if paused. While
+// paused, content from peers is still written unless PauseIncoming is set.
+func (a *App) TogglePause() {
+	if a.clipboard.Paused() {
+		a.clipboard.Resume()
+		a.logger().Info("Resumed, local copies are synced again")
+		return
+	}
+	a.clipboard.Pause()
+	if a.PauseIncoming {
+		a.logger().Info("Paused, local copies and content from peers are not synced until resumed")
+	} else {
+		a.logger().Info("Paused, local copies are not synced until resumed")
+	}
+}
+
+// SyncNow re-sends the current clipboard to all peers, or to SyncNowGroup if
+// set, even if it was already sent, to recover from a sync that seems stuck.
+// Nothing is sent while sync is paused.
+func (a *App) SyncNow() {
+	if a.clipboard.Paused() {
+		a.logger().Info("Sync now: not synced, sync is paused")
+		return
+	}
+	data := a.clipboard.Read()
+	if len(data) == 0 {
+		a.logger().Info("Sync now: the clipboard is empty, nothing to send")
+		return
+	}
+	if a.clipboard.TooLarge(data) {
+		a.logger().Warn("Sync now: not synced, the clipboard is over the size limit", "bytes", len(data), "limit", a.MaxClipboardBytes)
+		return
+	}
+	if app, allowed := a.AppFilter.Check(); !allowed {
+		if app == "" {
+			a.logger().Info("Sync now: not synced, the app filter couldn't tell which application is focused")
+		} else {
+			a.logger().Info("Sync now: not synced, the focused application is excluded by the app filter", "app", app)
+		}
+		return
+	}
+
+	if a.SyncNowGroup != "" {
+		if err := a.SendToGroup(a.SyncNowGroup); err != nil {
+			a.logger().Info("Sync now: nothing sent", "group", a.SyncNowGroup, "err", err)
+		}
+		return
+	}
+
+	a.localActivity()
+	a.logger().Info("Sync now: sending the clipboard", "content", a.LogPolicy.Describe(data))
+	a.sendClipboard(0, protocol.FormatText, data)
+	a.audit(audit.Sent, "*", data)
+}
+
+// sendClipboard encrypts clipboard content and sends it to all peers.
+func (a *App) sendClipboard(flags protocol.Flags, format protocol.Format, body []byte) {
+	encrypted, err := a.sealPayload(flags, format, body)
+	if err != nil {
+		a.logger().Error("Encryption failed", "err", err)
+		return
+	}
+
+	// Large payloads go through the relay when configured, small ones stay P2P
+	if a.shouldRelay(encrypted) {
+		err := a.sendRelay(encrypted)
+		if err == nil {
+			return
+		}
+		a.logger().Warn("Relay failed, falling back to DataChannels", "err", err)
+	}
+	a.broadcast(encrypted)
+}
+
+// broadcast queues an encrypted payload for every known peer, then sends it over
+// the open DataChannels. Peers that are reconnecting get it when their channel reopens.
+func (a *App) broadcast(encrypted []byte) {
+	a.mu.RLock()
+	peerIDs := slices.Collect(maps.Keys(a.outboxes))
+	a.mu.RUnlock()
+
+	a.deliver(peerIDs, encrypted)
+}
+
+// deliver queues an encrypted payload for the given peers and sends it over their
+// open DataChannels, in fragments if it is too large for a single send.
+func (a *App) deliver(peerIDs []string, encrypted []byte) {
+	parts, err := protocol.Split(encrypted, a.transferID.Add(1), maxDataChannelMessage)
+	if err != nil {
+		a.logger().Error("Can't send to peers", "bytes", len(encrypted), "err", err)
+		return
+	}
+
+	a.mu.RLock()
+	for _, peerID := range peerIDs {
+		if ob := a.outboxes[peerID]; ob != nil {
+			if n := ob.push(parts); n > 0 {
+				a.logger().Debug("Peer is behind, skipped older clipboard items for the latest", "peer", peerID, "skipped", n)
 			}
 		}
-		a.mu.RUnlock()
 	}
+	a.mu.RUnlock()
+
+	for _, peerID := range peerIDs {
+		a.flushOutbox(peerID)
+	}
+}
+
+// relayHeadroom is kept free below the message size limit when relaying. It
+// covers the fields sendSignal adds (version, ID, timestamp) with room to spare.
+const relayHeadroom = 1 << 10
+
+// shouldRelay reports whether an encrypted payload is large enough to be sent
+// through the signaling server. Payloads whose relay message could exceed the
+// server's limit, or the MaxMessageSize peers read with, always stay on the
+// DataChannels: the server disconnects clients sending larger messages.
+func (a *App) shouldRelay(encrypted []byte) bool {
+	if a.RelayThreshold <= 0 || len(encrypted) <= a.RelayThreshold {
+		return false
+	}
+	return len(encrypted) <= a.maxRelayed(a.relayLimit())
+}
+
+// relayLimit returns the size limit of relay messages: the MaxMessageSize peers
+// read with, or the server's limit when it is lower.
+func (a *App) relayLimit() int64 {
+	limit := a.MaxMessageSize
+	if serverMax := a.serverMaxMsg.Load(); serverMax > 0 {
+		limit = min(limit, serverMax)
+	}
+	return limit
+}
+
+// maxRelayed returns the largest encrypted payload a relay message of at most
+// limit bytes can carry.
+func (a *App) maxRelayed(limit int64) int {
+	envelope, err := signaling.NewRelay(a.peerID, "").Marshal()
+	if err != nil {
+		return 0
+	}
+	room := limit - int64(len(envelope)) - relayHeadroom
+	if room <= 0 {
+		return 0
+	}
+	return int(room / 4 * 3) // Base64 of n bytes takes 4 bytes per 3, rounded up
+}
+
+// sendRelay broadcasts an encrypted payload to the room through the signaling server.
+func (a *App) sendRelay(encrypted []byte) error {
+	a.logger().Debug("Sending through the signaling server", "bytes", len(encrypted))
+	return a.sendSignal(signaling.NewRelay(a.peerID, base64.StdEncoding.EncodeToString(encrypted)))
 }
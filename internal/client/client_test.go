@@ -0,0 +1,1392 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+	"github.com/Pujan-khunt/clipboard-sync/internal/crypto"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+	"github.com/Pujan-khunt/clipboard-sync/internal/redact"
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+	"github.com/Pujan-khunt/clipboard-sync/internal/wsserver"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v3"
+)
+
+// newTestApp returns an App on an in-memory clipboard, with a key and an outbox
+// for each of peerIDs as if they were in the room. Nothing is connected, so
+// sent payloads stay queued in the outboxes.
+func newTestApp(t testing.TB, peerIDs ...string) (*App, *clipboard.MemoryBackend) {
+	t.Helper()
+	a := NewApp("ws://127.0.0.1:0/ws", "password", "peer-a")
+	a.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	backend := clipboard.NewMemoryBackend()
+	a.clipboard.Backend = backend
+	a.setKey(crypto.DeriveKey("password"))
+	for _, peerID := range peerIDs {
+		a.outboxes[peerID] = &outbox{}
+	}
+	return a, backend
+}
+
+// queued returns how many payloads wait in the outbox of peerID.
+func queued(a *App, peerID string) int {
+	ob := a.outboxes[peerID]
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return len(ob.items)
+}
+
+// newTestServer starts a signaling hub and returns its URL, for Apps to join.
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	hub := wsserver.NewHub()
+	hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(http.HandlerFunc(hub.HandleConnections))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+}
+
+// startApp runs an App for peerID on an in-memory clipboard until the test
+// ends, and returns it with a channel receiving RunContext's result.
+func startApp(t *testing.T, serverURL, peerID string, configure func(*App)) (*App, <-chan error) {
+	t.Helper()
+	a := NewApp(serverURL, "password", peerID)
+	a.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	a.ClipboardBackend = clipboard.NewMemoryBackend()
+	if configure != nil {
+		configure(a)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result <- a.RunContext(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return a, result
+}
+
+// waitJoined waits until a has joined the room. Starting the next peer only
+// then keeps the two from joining at the same instant, whose handshakes can
+// cross.
+func waitJoined(t *testing.T, a *App) {
+	t.Helper()
+	waitFor(t, "the App to join the room", func() bool {
+		a.wsMu.Lock()
+		defer a.wsMu.Unlock()
+		return a.conn != nil
+	})
+	time.Sleep(100 * time.Millisecond) // Let the hub relay its join
+}
+
+func TestExitIfAlone(t *testing.T) {
+	serverURL := newTestServer(t)
+	_, result := startApp(t, serverURL, "peer-a", func(a *App) { a.ExitIfAlone = 200 * time.Millisecond })
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("RunContext returned %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("still running with no peer in the room")
+	}
+}
+
+func TestExitIfAloneWithPeer(t *testing.T) {
+	serverURL := newTestServer(t)
+	a, result := startApp(t, serverURL, "peer-a", func(a *App) { a.ExitIfAlone = 2 * time.Second })
+	waitJoined(t, a)
+	startApp(t, serverURL, "peer-b", nil)
+
+	select {
+	case err := <-result:
+		t.Fatalf("exited with another peer in the room, RunContext returned %v", err)
+	case <-time.After(4 * time.Second):
+	}
+}
+
+func TestPublisherIgnoresPayloadsQuietly(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.PublisherToken = "token"
+	var logs bytes.Buffer
+	a.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	for range 100 {
+		a.handlePayload("peer-b", []byte("payload"))
+	}
+	if n := strings.Count(logs.String(), "Ignoring clipboard"); n != 1 {
+		t.Fatalf("logged %d lines for 100 ignored payloads, want 1:\n%s", n, logs.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for an App to log to while a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestShouldRelay(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		threshold int
+		clientMax int64 // MaxMessageSize, the default when zero
+		serverMax int64 // Announced by the server, none when zero
+		size      int
+		wantRelay bool
+	}{
+		{"disabled", 0, 0, 0, 64 << 10, false},
+		{"below the threshold", 4 << 10, 0, 0, 1 << 10, false},
+		{"at the threshold", 4 << 10, 0, 0, 4 << 10, false},
+		{"above the threshold", 4 << 10, 0, 0, 64 << 10, true},
+		{"over the client's message limit", 4 << 10, 64 << 10, 0, 64 << 10, false},
+		{"over the server's message limit", 4 << 10, 0, 64 << 10, 64 << 10, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := newTestApp(t)
+			a.RelayThreshold = tc.threshold
+			if tc.clientMax > 0 {
+				a.MaxMessageSize = tc.clientMax
+			}
+			a.serverMaxMsg.Store(tc.serverMax)
+			if got := a.shouldRelay(make([]byte, tc.size)); got != tc.wantRelay {
+				t.Fatalf("shouldRelay returned %v, want %v", got, tc.wantRelay)
+			}
+		})
+	}
+}
+
+func TestRelayThresholdTooLarge(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.RelayThreshold = int(a.MaxMessageSize)
+	if err := a.RunContext(t.Context()); err == nil || !strings.Contains(err.Error(), "relay threshold") {
+		t.Fatalf("RunContext returned %v, want the relay threshold rejected", err)
+	}
+
+	// Just below the largest relayed payload is accepted, and that payload relayed
+	largest := a.maxRelayed(a.MaxMessageSize)
+	a.RelayThreshold = largest - 1
+	if !a.shouldRelay(make([]byte, largest)) || a.shouldRelay(make([]byte, largest+1)) {
+		t.Fatalf("the largest relayed payload isn't %d bytes", largest)
+	}
+}
+
+func TestRelayThreshold(t *testing.T) {
+	serverURL := newTestServer(t)
+	a, _ := startApp(t, serverURL, "peer-a", func(a *App) { a.RelayThreshold = 4 << 10 })
+	waitJoined(t, a)
+
+	// peer-b listens on the signaling connection without starting a WebRTC connection
+	conn, _, err := websocket.DefaultDialer.Dial(serverURL+"?peer_id=peer-b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	time.Sleep(100 * time.Millisecond) // Let the hub register it
+	relays := make(chan []byte, 1)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msg, err := signaling.Unmarshal(data); err == nil && msg.Type == signaling.TypeRelay {
+				payload, _ := base64.StdEncoding.DecodeString(msg.Payload)
+				relays <- payload
+			}
+		}
+	}()
+	relayed := func() []byte {
+		select {
+		case payload := <-relays:
+			return payload
+		case <-time.After(200 * time.Millisecond):
+			return nil
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content []byte
+		relay   bool
+	}{
+		{"small text stays on the DataChannel", []byte("small"), false},
+		{"large payload goes through the relay", bytes.Repeat([]byte{0xa5}, 16<<10), true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a.mu.Lock()
+			a.outboxes["peer-b"] = &outbox{}
+			a.mu.Unlock()
+
+			a.sendClipboard(0, protocol.FormatText, tc.content)
+			payload := relayed()
+			a.mu.RLock()
+			n := queued(a, "peer-b")
+			a.mu.RUnlock()
+			if tc.relay != (payload != nil) || tc.relay != (n == 0) {
+				t.Fatalf("relayed %v with %d payloads queued for the DataChannel, want relayed %v", payload != nil, n, tc.relay)
+			}
+			if !tc.relay {
+				return
+			}
+
+			b, received := newTestApp(t)
+			b.room = "default"
+			b.handlePayload("peer-a", payload)
+			if got := received.Read(clipboard.FmtText); !bytes.Equal(got, tc.content) {
+				t.Fatalf("the relayed payload holds %d bytes, want %d", len(got), len(tc.content))
+			}
+		})
+	}
+}
+
+func TestMaxHandshakes(t *testing.T) {
+	for _, limit := range []int{1, 4} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			a, _ := startApp(t, newTestServer(t), "peer-a", func(a *App) { a.MaxHandshakes = limit })
+			waitJoined(t, a)
+
+			// Many peers join at once, each starting a handshake
+			var active, peak atomic.Int32
+			var wg sync.WaitGroup
+			for range 20 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer a.acquireHandshake()()
+					n := active.Add(1)
+					for p := peak.Load(); n > p; p = peak.Load() {
+						if peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					time.Sleep(5 * time.Millisecond)
+					active.Add(-1)
+				}()
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("queued handshakes never ran")
+			}
+			if got := peak.Load(); got != int32(limit) {
+				t.Fatalf("%d handshakes ran at once, want %d", got, limit)
+			}
+		})
+	}
+}
+
+func TestDataChannelOpenRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opened   bool // The DataChannel opens in time
+		replaced bool // Another connection replaced the one being watched
+		attempt  int
+		retries  int // Fresh connections started
+		gaveUp   bool
+	}{
+		{"opened", true, false, 1, 0, false},
+		{"replaced", false, true, 1, 0, false},
+		{"stalled", false, false, 1, maxConnectAttempts - 1, true},
+		{"stalled on the last attempt", false, false, maxConnectAttempts, 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs syncBuffer
+			a, _ := startApp(t, newTestServer(t), "peer-a", func(a *App) {
+				a.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+				a.openTimeout = 50 * time.Millisecond
+			})
+			waitJoined(t, a) // Offers to peer-b are sent, but nobody answers them
+
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+			current := pc
+			if tc.replaced {
+				if current, err = webrtc.NewPeerConnection(webrtc.Configuration{}); err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { current.Close() })
+			}
+			a.mu.Lock()
+			a.peers["peer-b"] = current
+			a.mu.Unlock()
+			opened := make(chan struct{})
+			if tc.opened {
+				close(opened)
+			}
+
+			a.watchDataChannelOpen("peer-b", pc, opened, tc.attempt)
+			if tc.gaveUp {
+				waitFor(t, "the retries to give up", func() bool { return strings.Contains(logs.String(), "giving up") })
+			}
+			if got := strings.Count(logs.String(), "retrying with a fresh connection"); got != tc.retries {
+				t.Fatalf("%d fresh connections, want %d", got, tc.retries)
+			}
+			a.mu.RLock()
+			registered := a.peers["peer-b"]
+			a.mu.RUnlock()
+			want := current
+			if tc.gaveUp {
+				want = nil // The last fresh connection was torn down too
+			}
+			if registered != want {
+				t.Fatalf("the registered connection is %p, want %p", registered, want)
+			}
+		})
+	}
+}
+
+func TestRouteDataChannel(t *testing.T) {
+	for _, tc := range []struct {
+		label    string
+		rejected bool
+	}{
+		{labelClipboard, false},
+		{labelControl, false},
+		{"clipboard2", true},
+		{"", true},
+	} {
+		t.Run(fmt.Sprintf("%q", tc.label), func(t *testing.T) {
+			a, _ := newTestApp(t)
+			var logs syncBuffer
+			a.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+			dc, err := pc.CreateDataChannel(tc.label, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a.routeDataChannel("peer-b", dc)
+			state := dc.ReadyState()
+			closed := state == webrtc.DataChannelStateClosing || state == webrtc.DataChannelStateClosed
+			if closed != tc.rejected {
+				t.Fatalf("the channel is %v, want it closed: %v", state, tc.rejected)
+			}
+			if warned := strings.Contains(logs.String(), "unexpected label"); warned != tc.rejected {
+				t.Fatalf("warned about the label: %v, want %v", warned, tc.rejected)
+			}
+		})
+	}
+}
+
+func TestWaitForGathering(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		offer   bool // Start gathering with a local description
+		leave   bool // The peer leaves while gathering
+		replace bool // The connection is replaced while gathering
+		want    bool
+	}{
+		{"gathered", true, false, false, true},
+		{"left during gathering", false, true, false, false},
+		{"replaced during gathering", false, false, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := newTestApp(t)
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+			if tc.offer {
+				if _, err := pc.CreateDataChannel(labelClipboard, nil); err != nil {
+					t.Fatal(err)
+				}
+				offer, err := pc.CreateOffer(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := pc.SetLocalDescription(offer); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a.mu.Lock()
+			a.peers["peer-b"] = pc
+			a.mu.Unlock()
+
+			result := make(chan bool, 1)
+			go func() { result <- a.waitForGathering("peer-b", pc) }()
+			time.Sleep(50 * time.Millisecond)
+			if tc.leave {
+				a.closePeerConnection("peer-b")
+			}
+			if tc.replace {
+				other, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { other.Close() })
+				a.mu.Lock()
+				a.peers["peer-b"] = other
+				a.mu.Unlock()
+			}
+			select {
+			case got := <-result:
+				if got != tc.want {
+					t.Fatalf("waitForGathering returned %v, want %v", got, tc.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitForGathering didn't return")
+			}
+		})
+	}
+}
+
+func TestParseServerURL(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		host string // Empty when the URL must be rejected
+	}{
+		{"ws://127.0.0.1:8080/ws", "127.0.0.1:8080"},
+		{"ws://[2001:db8::1]:8080/ws", "[2001:db8::1]:8080"},
+		{"wss://[::1]/ws?room=a", "[::1]"},
+		{"ws://[fe80::1%25eth0]:8080/ws", "[fe80::1%eth0]:8080"},
+		{"ws://2001:db8::1:8080/ws", ""},
+		{"http://127.0.0.1:8080/ws", ""},
+		{"ws:///ws", ""},
+	} {
+		t.Run(tc.raw, func(t *testing.T) {
+			u, err := parseServerURL(tc.raw)
+			if tc.host == "" {
+				if err == nil {
+					t.Fatalf("accepted, with host %q", u.Host)
+				}
+				return
+			}
+			if err != nil || u.Host != tc.host {
+				t.Fatalf("returned %v, %v; want host %q", u, err, tc.host)
+			}
+		})
+	}
+}
+
+func TestIPv6ServerURL(t *testing.T) {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	hub := wsserver.NewHub()
+	hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(hub.HandleConnections))
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	serverURL := "ws://" + ln.Addr().String() + "/ws?room=v6"
+	a, _ := startApp(t, serverURL, "peer-a", nil)
+	waitJoined(t, a)
+	// The query was rewritten without touching the bracketed host
+	if a.serverURL.Host != ln.Addr().String() || a.serverURL.Query().Get("peer_id") != "peer-a" {
+		t.Fatalf("dialed %s", a.serverURL)
+	}
+	if a.room != "v6" {
+		t.Fatalf("joined room %q, want %q", a.room, "v6")
+	}
+}
+
+func TestIncompleteTransfersBounded(t *testing.T) {
+	const maxTransfers, maxBytes = 4, 256 << 10
+	sender, _ := newTestApp(t)
+	receiver, received := newTestApp(t)
+	receiver.reassembly = protocol.NewReassembler(maxTransfers, maxBytes, time.Minute)
+	split := func(body []byte) [][]byte {
+		t.Helper()
+		sealed, err := sender.sealPayload(0, protocol.FormatText, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts, err := protocol.Split(sealed, sender.transferID.Add(1), maxDataChannelMessage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parts
+	}
+
+	// A peer starts many large transfers and never finishes them
+	body := bytes.Repeat([]byte("x"), 100<<10)
+	for range 50 {
+		parts := split(body)
+		for _, part := range parts[:len(parts)-1] {
+			receiver.handlePayload("peer-a", part)
+			if transfers, buffered := receiver.reassembly.Pending(); transfers > maxTransfers || buffered > maxBytes {
+				t.Fatalf("%d transfers holding %d bytes, over the limits of %d and %d", transfers, buffered, maxTransfers, maxBytes)
+			}
+		}
+	}
+
+	// Or announces the most fragments and sends only empty ones, whose slots
+	// alone are over the budget: they're refused without evicting anything
+	transfers, buffered := receiver.reassembly.Pending()
+	for id := range uint64(50) {
+		id += 1 << 32 // Apart from the sender's transfer IDs
+		frag := protocol.Fragment{ID: id, Count: math.MaxUint16}
+		env := protocol.Envelope{Version: protocol.Version, Flags: protocol.FlagFragment, Seq: id, Payload: frag.Marshal()}
+		part, err := env.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		receiver.handlePayload("peer-a", part)
+	}
+	if nowTransfers, nowBuffered := receiver.reassembly.Pending(); nowTransfers != transfers || nowBuffered != buffered {
+		t.Fatalf("empty fragments left %d transfers holding %d bytes, want the %d holding %d from before", nowTransfers, nowBuffered, transfers, buffered)
+	}
+
+	// A complete fragmented message still gets through
+	complete := bytes.Repeat([]byte("y"), 40<<10)
+	for _, part := range split(complete) {
+		receiver.handlePayload("peer-a", part)
+	}
+	if got := received.Read(clipboard.FmtText); !bytes.Equal(got, complete) {
+		t.Fatalf("received %d bytes, want the %d of the complete message", len(got), len(complete))
+	}
+}
+
+func TestMaxIdle(t *testing.T) {
+	hub := wsserver.NewHub()
+	hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.HandleConnections)
+	mux.HandleFunc("/rooms", hub.HandleRooms)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	inRoom := func() bool { return len(roomIDs(t, srv.URL+"/rooms")) == 1 }
+
+	backend := clipboard.NewMemoryBackend()
+	a, _ := startApp(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "peer-a", func(a *App) {
+		a.MaxIdle = 500 * time.Millisecond
+		a.ClipboardBackend = backend
+	})
+	waitJoined(t, a)
+	a.mu.Lock()
+	a.outboxes["peer-b"] = &outbox{}
+	a.mu.Unlock()
+
+	// Without clipboard activity the client leaves the room
+	waitFor(t, "the idle client to leave", func() bool { return a.suspended.Load() && !inRoom() })
+
+	// The next copy brings it back, and is sent once it is there
+	backend.Copy(clipboard.FmtText, []byte("wake up"))
+	waitFor(t, "the client to rejoin", func() bool { return !a.suspended.Load() && inRoom() })
+	waitFor(t, "the copy to be sent", func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return queued(a, "peer-b") == 1
+	})
+
+	// Activity keeps it in the room
+	for range 8 {
+		a.touch()
+		time.Sleep(100 * time.Millisecond)
+	}
+	if a.suspended.Load() {
+		t.Fatal("suspended although the clipboard was active")
+	}
+}
+
+func TestServerSecret(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		server, client string
+		connects       bool
+	}{
+		{"matching secrets", "server secret", "server secret", true},
+		{"mismatching secrets", "server secret", "other secret", false},
+		{"server without a secret", "", "server secret", false},
+		{"client not verifying", "server secret", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := wsserver.NewHub()
+			hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			hub.ServerSecret = tc.server
+			srv := httptest.NewServer(http.HandlerFunc(hub.HandleConnections))
+			t.Cleanup(srv.Close)
+
+			a, result := startApp(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "peer-a", func(a *App) {
+				a.ServerSecret = tc.client
+			})
+			if tc.connects {
+				waitJoined(t, a)
+				return
+			}
+			select {
+			case err := <-result:
+				if err == nil || !strings.Contains(err.Error(), "server secret") {
+					t.Fatalf("RunContext returned %v, want a server secret error", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the client connected to a server that can't prove the secret")
+			}
+		})
+	}
+}
+
+// flakyBackend is a MemoryBackend whose watchers stop on restart, like on a
+// display server restart, and whose next failInits calls to Init fail.
+type flakyBackend struct {
+	*clipboard.MemoryBackend
+	mu        sync.Mutex
+	failInits int
+	inits     int
+	stops     []context.CancelFunc
+}
+
+func (b *flakyBackend) Init() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inits++
+	if b.failInits > 0 {
+		b.failInits--
+		return errors.New("display unavailable")
+	}
+	return nil
+}
+
+func (b *flakyBackend) Watch(ctx context.Context, format clipboard.Format) <-chan []byte {
+	ctx, stop := context.WithCancel(ctx)
+	b.mu.Lock()
+	b.stops = append(b.stops, stop)
+	b.mu.Unlock()
+	return b.MemoryBackend.Watch(ctx, format)
+}
+
+// restart stops the watchers started so far.
+func (b *flakyBackend) restart() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, stop := range b.stops {
+		stop()
+	}
+	b.stops = nil
+}
+
+func TestClipboardRetry(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		retry     int
+		failInits int
+		recovers  bool
+	}{
+		{"recovers", 3, 0, true},
+		{"recovers after failed inits", 3, 2, true},
+		{"gives up", 3, 3, false},
+		{"disabled", 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, memory := newTestApp(t, "peer-b")
+			backend := &flakyBackend{MemoryBackend: memory}
+			a.clipboard.Backend = backend
+			a.ClipboardRetry = tc.retry
+			a.Debounce = 0
+			a.retryBase = 10 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			updates := a.clipboard.Watch(ctx)
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				a.handleOutgoingClipboard(ctx, updates)
+			}()
+
+			backend.mu.Lock()
+			backend.failInits = tc.failInits
+			backend.mu.Unlock()
+			backend.restart()
+
+			if !tc.recovers {
+				select {
+				case <-stopped:
+				case <-time.After(5 * time.Second):
+					t.Fatal("the clipboard watcher is still running after giving up")
+				}
+				backend.mu.Lock()
+				defer backend.mu.Unlock()
+				if backend.inits != tc.retry {
+					t.Fatalf("initialized the clipboard %d times, want %d", backend.inits, tc.retry)
+				}
+				return
+			}
+
+			waitFor(t, "the clipboard watcher to recover", func() bool {
+				backend.mu.Lock()
+				defer backend.mu.Unlock()
+				return backend.inits == tc.failInits+1 && a.ClipboardHealthy()
+			})
+
+			// Copies made after the recovery are synced again
+			memory.Copy(clipboard.FmtText, []byte("after the restart"))
+			waitFor(t, "the copy to be sent", func() bool {
+				a.mu.Lock()
+				defer a.mu.Unlock()
+				return queued(a, "peer-b") == 1
+			})
+		})
+	}
+}
+
+func TestSyncNow(t *testing.T) {
+	hello := []byte("hello")
+	for _, tc := range []struct {
+		name    string
+		prepare func(a *App, backend *clipboard.MemoryBackend)
+		sent    int
+	}{
+		{"local copy", func(a *App, backend *clipboard.MemoryBackend) {
+			backend.Copy(clipboard.FmtText, hello)
+		}, 1},
+		{"in the dedup cache", func(a *App, backend *clipboard.MemoryBackend) {
+			a.clipboard.WriteSafely(clipboard.FmtText, hello)
+		}, 1},
+		{"suspended as a sync loop", func(a *App, backend *clipboard.MemoryBackend) {
+			backend.Copy(clipboard.FmtText, hello)
+			for range loopThreshold + 1 {
+				a.allowSync(hello)
+			}
+		}, 1},
+		{"over the size limit", func(a *App, backend *clipboard.MemoryBackend) {
+			a.clipboard.MaxBytes = len(hello) - 1
+			backend.Copy(clipboard.FmtText, hello)
+		}, 0},
+		{"empty clipboard", func(a *App, backend *clipboard.MemoryBackend) {}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, backend := newTestApp(t, "peer-b")
+			tc.prepare(a, backend)
+
+			a.SyncNow()
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if n := queued(a, "peer-b"); n != tc.sent {
+				t.Fatalf("queued %d payloads, want %d", n, tc.sent)
+			}
+		})
+	}
+}
+
+func TestSyncNowPaused(t *testing.T) {
+	a, backend := newTestApp(t, "peer-b")
+	backend.Copy(clipboard.FmtText, []byte("password"))
+
+	a.clipboard.Pause()
+	a.SyncNow()
+	if n := queued(a, "peer-b"); n != 0 {
+		t.Fatalf("queued %d payloads while paused, want 0", n)
+	}
+
+	a.clipboard.Resume()
+	a.SyncNow()
+	if n := queued(a, "peer-b"); n != 1 {
+		t.Fatalf("queued %d payloads after resume, want 1", n)
+	}
+}
+
+func TestLogPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  redact.Policy
+		preview bool
+	}{
+		{"default", redact.SizeOnly, false},
+		{"preview", redact.Preview, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, backend := newTestApp(t, "peer-b")
+			var logs bytes.Buffer
+			a.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			a.LogPolicy = tc.policy
+
+			a.sendCopy(clipboard.Update{Format: clipboard.FmtText, Content: []byte("hunter2")})
+			backend.Copy(clipboard.FmtText, []byte("hunter2"))
+			a.SyncNow()
+
+			if got := strings.Contains(logs.String(), "hunter2"); got != tc.preview {
+				t.Fatalf("content in the logs: %v, want %v\n%s", got, tc.preview, logs.String())
+			}
+			if !strings.Contains(logs.String(), "7 bytes") {
+				t.Fatalf("the size is missing from the logs\n%s", logs.String())
+			}
+		})
+	}
+}
+
+func TestStaleSignal(t *testing.T) {
+	const maxAge = time.Minute
+	for _, tc := range []struct {
+		name     string
+		sent     time.Duration // Offset of the timestamp from now
+		stamped  bool          // Whether the message carries a timestamp
+		accepted bool
+	}{
+		{"fresh", -time.Second, true, true},
+		{"stale", -2 * maxAge, true, false},
+		{"from the future", 2 * maxAge, true, false},
+		{"without a timestamp", 0, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serverURL := newTestServer(t)
+			backend := clipboard.NewMemoryBackend()
+			a, _ := startApp(t, serverURL, "peer-b", func(a *App) {
+				a.ClipboardBackend = backend
+				a.MaxSignalAge = maxAge
+			})
+			waitJoined(t, a)
+
+			// peer-a relays a copy through the server, as a replayed message would be
+			sender, _ := newTestPeer(t, "default", "password", nil)
+			sealed, err := sender.sealPayload(0, protocol.FormatText, []byte("relayed"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, _, err := websocket.DefaultDialer.Dial(serverURL+"?peer_id="+sender.peerID, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			msg := signaling.NewRelay(sender.peerID, base64.StdEncoding.EncodeToString(sealed))
+			msg.Version, msg.MinVersion = signaling.ProtocolVersion, signaling.MinProtocolVersion
+			if tc.stamped {
+				msg.Timestamp = time.Now().Add(tc.sent).UnixMilli()
+			}
+			data, err := msg.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				t.Fatal(err)
+			}
+
+			if tc.accepted {
+				waitFor(t, "the relayed copy", func() bool { return string(backend.Read(clipboard.FmtText)) == "relayed" })
+				return
+			}
+			time.Sleep(300 * time.Millisecond)
+			if got := backend.Read(clipboard.FmtText); got != nil {
+				t.Fatalf("a stale message reached the clipboard: %q", got)
+			}
+		})
+	}
+}
+
+// fakeTimers replaces App.after with timers that fire only when advanced.
+type fakeTimers struct {
+	mu      sync.Mutex
+	now     time.Duration
+	created int
+	pending []fakeAfter
+}
+
+type fakeAfter struct {
+	at time.Duration
+	c  chan time.Time
+}
+
+// install makes a use f to time its debounce and batch windows.
+func (f *fakeTimers) install(a *App) {
+	a.after = func(d time.Duration) <-chan time.Time {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		c := make(chan time.Time, 1)
+		f.pending = append(f.pending, fakeAfter{f.now + d, c})
+		f.created++
+		return c
+	}
+}
+
+// Advance moves the clock forward by d and fires the timers due by then.
+func (f *fakeTimers) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now += d
+	pending := f.pending[:0]
+	for _, timer := range f.pending {
+		if timer.at <= f.now {
+			timer.c <- time.Now()
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+	f.pending = pending
+}
+
+// Created returns how many timers were started.
+func (f *fakeTimers) Created() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.created
+}
+
+func TestDebounce(t *testing.T) {
+	const debounce = 100 * time.Millisecond
+	// A step either copies its text or, if empty, advances the clock by wait
+	type step struct {
+		copy string
+		wait time.Duration
+	}
+	for _, tc := range []struct {
+		name  string
+		steps []step
+		sent  []string
+	}{
+		{"burst", []step{{copy: "one"}, {copy: "two"}, {copy: "three"}, {wait: debounce}}, []string{"three"}},
+		{"spaced out", []step{{copy: "one"}, {wait: debounce}, {copy: "two"}, {wait: debounce}}, []string{"one", "two"}},
+		{"still copying", []step{{copy: "one"}, {wait: debounce / 2}, {copy: "two"}, {wait: debounce / 2}, {wait: debounce / 2}}, []string{"two"}},
+		{"window still open", []step{{copy: "one"}, {wait: debounce / 2}}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, backend := newTestApp(t, "peer-b")
+			a.Debounce = debounce
+			var clock fakeTimers
+			clock.install(a)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			updates := a.clipboard.Watch(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				a.handleOutgoingClipboard(ctx, updates)
+			}()
+			t.Cleanup(func() {
+				cancel()
+				<-done
+			})
+
+			copies := 0
+			for _, s := range tc.steps {
+				if s.copy == "" {
+					clock.Advance(s.wait)
+					continue
+				}
+				backend.Copy(clipboard.FmtText, []byte(s.copy))
+				copies++
+				waitFor(t, "the copy to start the debounce window", func() bool { return clock.Created() == copies })
+			}
+			queuedForB := func() int {
+				a.mu.RLock()
+				defer a.mu.RUnlock()
+				return queued(a, "peer-b")
+			}
+			waitFor(t, "the copies to be sent", func() bool { return queuedForB() == len(tc.sent) })
+			time.Sleep(50 * time.Millisecond) // Nothing more is sent
+			if n := queuedForB(); n != len(tc.sent) {
+				t.Fatalf("sent %d copies, want %d", n, len(tc.sent))
+			}
+
+			a.mu.RLock()
+			ob := a.outboxes["peer-b"]
+			a.mu.RUnlock()
+			dc := &fakeChannel{}
+			if _, _, err := ob.flush(dc, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+			receiver, received := newTestApp(t)
+			for _, payload := range dc.sent {
+				receiver.handlePayload(a.peerID, []byte(payload))
+			}
+			var got []string
+			for _, w := range received.Writes() {
+				got = append(got, string(w.Content))
+			}
+			if !slices.Equal(got, tc.sent) {
+				t.Fatalf("sent %q, want %q", got, tc.sent)
+			}
+		})
+	}
+}
+
+func TestSTUNServers(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		configured []string
+		want       []string // Servers in the WebRTC configuration, nil if RunContext refuses them
+	}{
+		{"defaults", nil, DefaultSTUNServers()},
+		{"replaced", []string{"stun:stun.example:3478"}, []string{"stun:stun.example:3478"}},
+		{"several", []string{"stun:a.example:3478", "stuns:b.example:5349"}, []string{"stun:a.example:3478", "stuns:b.example:5349"}},
+		{"TURN URL", []string{"turn:turn.example:3478"}, nil},
+		{"no scheme", []string{"stun.example:3478"}, nil},
+		{"one invalid among several", []string{"stun:a.example:3478", "http://b.example"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := newTestApp(t)
+			a.STUNServers = tc.configured
+			if tc.want == nil {
+				err := a.RunContext(context.Background())
+				if err == nil || !strings.Contains(err.Error(), "must start with stun: or stuns:") {
+					t.Fatalf("RunContext returned %v, want an invalid STUN server error", err)
+				}
+				return
+			}
+
+			var got []string
+			for _, server := range a.webRTCConfig().ICEServers {
+				got = append(got, server.URLs...)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("ICE servers %q, want exactly %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// collidingKeys returns two different keys with the same key id.
+func collidingKeys(t *testing.T) (a, b []byte) {
+	t.Helper()
+	seen := make(map[byte][]byte)
+	for {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		id := crypto.KeyID(key)
+		if other, ok := seen[id]; ok {
+			return other, key
+		}
+		seen[id] = key
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	a, _ := newTestApp(t)
+	oldKey := bytes.Clone(a.currentKey())
+	sealed, err := a.keys.Encrypt([]byte("in flight"), crypto.EncryptOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey := crypto.DeriveKey("new password")
+	a.keyMu.Lock()
+	err = a.rotateKey(newKey)
+	a.keyMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.currentKey(), newKey) {
+		t.Fatal("the new key isn't current after the rotation")
+	}
+	// The previous key is kept for its grace period
+	if _, err := a.keys.Decrypt(sealed, crypto.DecryptOptions{}); err != nil {
+		t.Fatalf("message sealed with the previous key: %v", err)
+	}
+	if !bytes.Equal(a.keys.Key(crypto.KeyID(oldKey)), oldKey) {
+		t.Fatal("the previous key was changed during its grace period")
+	}
+}
+
+func TestRotateKeySameKey(t *testing.T) {
+	a, _ := newTestApp(t)
+	stored := a.currentKey()
+
+	a.keyMu.Lock()
+	err := a.rotateKey(crypto.DeriveKey("password"))
+	a.keyMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, make([]byte, len(stored))) {
+		t.Fatal("the replaced copy of the key wasn't wiped")
+	}
+}
+
+func TestRotateKeyIDCollision(t *testing.T) {
+	keyA, keyB := collidingKeys(t)
+	a, _ := newTestApp(t)
+	a.setKey(bytes.Clone(keyA))
+	sealed, err := a.keys.Encrypt([]byte("in flight"), crypto.EncryptOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.keyMu.Lock()
+	err = a.rotateKey(bytes.Clone(keyB))
+	a.keyMu.Unlock()
+	if err == nil {
+		t.Fatal("rotating to a key with the id of the current key succeeded")
+	}
+	if !bytes.Equal(a.currentKey(), keyA) {
+		t.Fatal("the current key changed after a refused rotation")
+	}
+	if _, err := a.keys.Decrypt(sealed, crypto.DecryptOptions{}); err != nil {
+		t.Fatalf("message sealed with the current key: %v", err)
+	}
+
+	// Rotating away and back keeps refusing keyB while keyA is in its grace period
+	a.keyMu.Lock()
+	err = a.rotateKey(crypto.DeriveKey("other password"))
+	if err == nil {
+		err = a.rotateKey(bytes.Clone(keyB))
+	}
+	a.keyMu.Unlock()
+	if err == nil {
+		t.Fatal("rotating to a key with the id of a key in its grace period succeeded")
+	}
+	if _, err := a.keys.Decrypt(sealed, crypto.DecryptOptions{}); err != nil {
+		t.Fatalf("message sealed with the previous key: %v", err)
+	}
+}
+
+// joinAs joins the room of serverURL with a bare connection, announcing
+// version and minVersion.
+func joinAs(t *testing.T, serverURL, peerID string, version, minVersion int) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(serverURL+"?peer_id="+peerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	join := signaling.NewJoin(peerID, "", "commitment")
+	join.Version, join.MinVersion = version, minVersion
+	data, err := join.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOldPeerRejected(t *testing.T) {
+	serverURL := newTestServer(t)
+	a, _ := startApp(t, serverURL, "peer-a", nil)
+	waitJoined(t, a)
+
+	// A release from before version 3 joins without a version, or with 2
+	for _, version := range []int{0, 2} {
+		peerID := fmt.Sprintf("old-peer-%d", version)
+		joinAs(t, serverURL, peerID, version, 0)
+
+		waitFor(t, peerID+" to be reported", func() bool {
+			for _, status := range a.Status() {
+				if status.PeerID == peerID && strings.Contains(status.LastError, "incompatible protocol version") {
+					return true
+				}
+			}
+			return false
+		})
+		a.mu.RLock()
+		_, connected := a.peers[peerID]
+		a.mu.RUnlock()
+		if connected {
+			t.Fatalf("a connection was started with %s", peerID)
+		}
+	}
+}
+
+func TestLeaveClosesNormally(t *testing.T) {
+	// A bare server that only reports how the client closed
+	codes := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					codes <- closeErr.Code
+				} else {
+					codes <- -1
+				}
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// Alone in the room, the App leaves on its own
+	serverURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	startApp(t, serverURL, "peer-a", func(a *App) { a.ExitIfAlone = 200 * time.Millisecond })
+
+	select {
+	case code := <-codes:
+		if code != websocket.CloseNormalClosure {
+			t.Fatalf("server saw close code %d, want %d (normal closure)", code, websocket.CloseNormalClosure)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the client never closed the connection")
+	}
+}
+
+func TestNewerPeer(t *testing.T) {
+	serverURL := newTestServer(t)
+	var logs syncBuffer
+	a, _ := startApp(t, serverURL, "peer-a", func(a *App) {
+		a.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	})
+	waitJoined(t, a)
+
+	// A newer release that still speaks our version is talked to, with a warning
+	joinAs(t, serverURL, "peer-newer", signaling.ProtocolVersion+1, signaling.ProtocolVersion)
+	waitFor(t, "a connection with peer-newer", func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		_, ok := a.peers["peer-newer"]
+		return ok
+	})
+	if !strings.Contains(logs.String(), "Peer runs a different release") {
+		t.Fatalf("no warning about the version difference:\n%s", logs.String())
+	}
+
+	// One that dropped our version is rejected
+	joinAs(t, serverURL, "peer-newest", signaling.ProtocolVersion+2, signaling.ProtocolVersion+1)
+	waitFor(t, "peer-newest to be reported", func() bool {
+		for _, status := range a.Status() {
+			if status.PeerID == "peer-newest" && strings.Contains(status.LastError, "incompatible protocol version") {
+				return true
+			}
+		}
+		return false
+	})
+	a.mu.RLock()
+	_, connected := a.peers["peer-newest"]
+	a.mu.RUnlock()
+	if connected {
+		t.Fatal("a connection was started with peer-newest")
+	}
+}
+
+// roomIDs returns the rooms of the hub serving /rooms at roomsURL.
+func roomIDs(t *testing.T, roomsURL string) []string {
+	t.Helper()
+	resp, err := http.Get(roomsURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var rooms wsserver.RoomsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, room := range rooms.Rooms {
+		ids = append(ids, room.Room)
+	}
+	return ids
+}
+
+func TestReloadPasswordMidSession(t *testing.T) {
+	hub := wsserver.NewHub()
+	hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.HandleConnections)
+	mux.HandleFunc("/rooms", hub.HandleRooms)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	backend := clipboard.NewMemoryBackend()
+	a, _ := startApp(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", "peer-a", func(a *App) {
+		a.Password, a.PasswordFile = "", passwordFile
+		a.PrivateMetadata = true
+		a.ClipboardBackend = backend
+	})
+	waitJoined(t, a)
+	oldKey, newKey := crypto.DeriveKey("password"), crypto.DeriveKey("new password")
+	if rooms := roomIDs(t, srv.URL+"/rooms"); !slices.Equal(rooms, []string{crypto.RoomID(oldKey, "default")}) {
+		t.Fatalf("rooms are %q, want the room of the password", rooms)
+	}
+	// A peer we are connected to but can't send to yet, to catch what is sent
+	a.mu.Lock()
+	a.outboxes["peer-b"] = &outbox{}
+	a.mu.Unlock()
+
+	if err := os.WriteFile(passwordFile, []byte("new password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a.reloadPassword()
+
+	// The client moves to the room of the new password, where restarted peers go
+	waitFor(t, "the move to the room of the new password", func() bool {
+		return slices.Equal(roomIDs(t, srv.URL+"/rooms"), []string{crypto.RoomID(newKey, "default")})
+	})
+
+	// The same watcher keeps running, and what it sends is sealed with the new key
+	backend.Copy(clipboard.FmtText, []byte("after reload"))
+	waitFor(t, "the copy to be sent", func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		return queued(a, "peer-b") == 1
+	})
+	a.mu.RLock()
+	ob := a.outboxes["peer-b"]
+	a.mu.RUnlock()
+	ob.mu.Lock()
+	sent := ob.items[0].parts
+	ob.mu.Unlock()
+	if len(sent) != 1 {
+		t.Fatalf("the copy was sent in %d parts, want 1", len(sent))
+	}
+	for _, tc := range []struct {
+		name string
+		key  []byte
+		want string
+	}{
+		{"new key", newKey, "after reload"},
+		{"old key", oldKey, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, received := newTestApp(t)
+			b.keys = crypto.NewKeyring()
+			b.setKey(bytes.Clone(tc.key))
+			b.room = "default"
+			b.handlePayload(a.peerID, sent[0]) // A session ID, with private metadata
+			if got := string(received.Read(clipboard.FmtText)); got != tc.want {
+				t.Fatalf("received %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ControlHandler returns the handler of the control endpoint:
+//
+//	GET  /status              the peer statuses (see Status) as JSON
+//	POST /groups/{name}/send  sends the current clipboard to the peers of a group
+//
+// It has no authentication, so it should only be served on a loopback address.
+func (a *App) ControlHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Status())
+	})
+	mux.HandleFunc("POST /groups/{name}/send", func(w http.ResponseWriter, r *http.Request) {
+		err := a.SendToGroup(r.PathValue("name"))
+		switch {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, errUnknownGroup):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			// Paused, empty clipboard, nobody of the group in the room...
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+	})
+	return mux
+}
+
+// serveControl serves the control endpoint on ln until ctx is done.
+func (a *App) serveControl(ctx context.Context, ln net.Listener) {
+	srv := &http.Server{Handler: a.ControlHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	a.logger().Info("Serving the control endpoint", "addr", ln.Addr().String())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		a.logger().Error("Control endpoint stopped", "err", err)
+	}
+}
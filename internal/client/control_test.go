@@ -0,0 +1,70 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+)
+
+func TestControlSendToGroup(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		group  string
+		paused bool
+		status int
+		queued int // For laptop-1
+	}{
+		{"sent", "laptops", false, http.StatusNoContent, 1},
+		{"unknown group", "tablets", false, http.StatusNotFound, 0},
+		{"paused", "laptops", true, http.StatusConflict, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, backend := newTestApp(t, "laptop-1", "phone")
+			a.Groups = map[string][]string{"laptops": {"laptop-*"}}
+			backend.Copy(clipboard.FmtText, []byte("hello"))
+			if tc.paused {
+				a.clipboard.Pause()
+			}
+			srv := httptest.NewServer(a.ControlHandler())
+			t.Cleanup(srv.Close)
+
+			resp, err := http.Post(srv.URL+"/groups/"+tc.group+"/send", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("returned status %d, want %d", resp.StatusCode, tc.status)
+			}
+			if n := queued(a, "laptop-1"); n != tc.queued {
+				t.Fatalf("queued %d payloads for laptop-1, want %d", n, tc.queued)
+			}
+			if n := queued(a, "phone"); n != 0 {
+				t.Fatalf("queued %d payloads for a peer outside the group", n)
+			}
+		})
+	}
+}
+
+func TestControlStatus(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.status.update("peer-b", func(s *PeerStatus) { s.State = "connected" })
+	srv := httptest.NewServer(a.ControlHandler())
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var statuses []PeerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].PeerID != "peer-b" || statuses[0].State != "connected" {
+		t.Fatalf("returned %+v, want peer-b connected", statuses)
+	}
+}
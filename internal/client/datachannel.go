@@ -0,0 +1,56 @@
+package client
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// DataChannelConfig sets the delivery guarantees of the clipboard DataChannel.
+// The zero value is reliable, ordered delivery, which is what clipboard text
+// needs: a lost or reordered fragment drops the whole item.
+type DataChannelConfig struct {
+	Unordered      bool // Let messages arrive out of order
+	MaxRetransmits int  // Give up on a message after this many retransmissions (0 = never give up)
+}
+
+// validate checks that the retransmission limit fits the protocol.
+func (c DataChannelConfig) validate() error {
+	if c.MaxRetransmits < 0 || c.MaxRetransmits > math.MaxUint16 {
+		return fmt.Errorf("DataChannel max retransmits must be between 0 and %d, got %d", math.MaxUint16, c.MaxRetransmits)
+	}
+	return nil
+}
+
+// init returns the options the initiator creates the channel with. The
+// responder gets the channel as announced by the initiator.
+func (c DataChannelConfig) init() *webrtc.DataChannelInit {
+	ordered := !c.Unordered
+	init := &webrtc.DataChannelInit{Ordered: &ordered}
+	if c.MaxRetransmits > 0 {
+		maxRetransmits := uint16(c.MaxRetransmits)
+		init.MaxRetransmits = &maxRetransmits
+	}
+	return init
+}
+
+func (c DataChannelConfig) String() string {
+	order := "ordered"
+	if c.Unordered {
+		order = "unordered"
+	}
+	if c.MaxRetransmits == 0 {
+		return order + ", reliable"
+	}
+	return fmt.Sprintf("%s, up to %d retransmits", order, c.MaxRetransmits)
+}
+
+// describeDataChannel returns the options dc was opened with, as a DataChannelConfig.
+func describeDataChannel(dc *webrtc.DataChannel) DataChannelConfig {
+	c := DataChannelConfig{Unordered: !dc.Ordered()}
+	if dc.MaxRetransmits() != nil {
+		c.MaxRetransmits = int(*dc.MaxRetransmits())
+	}
+	return c
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestDataChannelConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		config  DataChannelConfig
+		str     string
+		invalid bool
+	}{
+		{"default", DataChannelConfig{}, "ordered, reliable", false},
+		{"unordered", DataChannelConfig{Unordered: true}, "unordered, reliable", false},
+		{"retransmits", DataChannelConfig{MaxRetransmits: 3}, "ordered, up to 3 retransmits", false},
+		{"unordered with retransmits", DataChannelConfig{Unordered: true, MaxRetransmits: 5}, "unordered, up to 5 retransmits", false},
+		{"largest retransmits", DataChannelConfig{MaxRetransmits: math.MaxUint16}, "ordered, up to 65535 retransmits", false},
+		{"negative retransmits", DataChannelConfig{MaxRetransmits: -1}, "", true},
+		{"too many retransmits", DataChannelConfig{MaxRetransmits: math.MaxUint16 + 1}, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.validate(); (err != nil) != tc.invalid {
+				t.Fatalf("validate returned %v, want an error: %v", err, tc.invalid)
+			}
+			if tc.invalid {
+				return
+			}
+			if got := tc.config.String(); got != tc.str {
+				t.Fatalf("String returned %q, want %q", got, tc.str)
+			}
+
+			// The channel is created with the requested parameters
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+			dc, err := pc.CreateDataChannel(labelClipboard, tc.config.init())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeDataChannel(dc); got != tc.config {
+				t.Fatalf("channel created as %+v, want %+v", got, tc.config)
+			}
+		})
+	}
+}
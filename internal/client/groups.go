@@ -0,0 +1,76 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/audit"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+// groupMembers returns the connected or queued peers belonging to the named group.
+func (a *App) groupMembers(name string) ([]string, error) {
+	patterns, ok := a.Groups[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", errUnknownGroup, name)
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var members []string
+	for peerID := range a.outboxes {
+		if slices.ContainsFunc(patterns, func(pattern string) bool {
+			matched, _ := path.Match(pattern, peerID)
+			return matched
+		}) {
+			members = append(members, peerID)
+		}
+	}
+	slices.Sort(members)
+	return members, nil
+}
+
+// Errors of SendToGroup
+var (
+	errUnknownGroup = errors.New("unknown group")
+	errPaused       = errors.New("sync is paused")
+)
+
+// SendToGroup sends the current clipboard only to the peers of the named group.
+// Nothing is sent while sync is paused.
+func (a *App) SendToGroup(name string) error {
+	if a.clipboard.Paused() {
+		a.logger().Info("Paused, not sending the clipboard to a group", "group", name)
+		return errPaused
+	}
+	members, err := a.groupMembers(name)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return fmt.Errorf("no peer of group %q is in the room", name)
+	}
+
+	data := a.clipboard.Read()
+	if len(data) == 0 {
+		return fmt.Errorf("clipboard is empty")
+	}
+	if a.clipboard.TooLarge(data) {
+		return fmt.Errorf("clipboard is over the size limit (%d bytes > %d)", len(data), a.MaxClipboardBytes)
+	}
+	encrypted, err := a.sealPayload(0, protocol.FormatText, data)
+	if err != nil {
+		return fmt.Errorf("encryption error: %w", err)
+	}
+
+	a.logger().Info("Sending the clipboard to a group", "group", name, "content", a.LogPolicy.Describe(data), "peers", len(members))
+	a.localActivity()
+	a.deliver(members, encrypted)
+	for _, peerID := range members {
+		a.audit(audit.Sent, peerID, data)
+	}
+	return nil
+}
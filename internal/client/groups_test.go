@@ -0,0 +1,74 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+)
+
+func TestSendToGroup(t *testing.T) {
+	a, backend := newTestApp(t, "laptop-1", "laptop-2", "phone")
+	a.Groups = map[string][]string{"laptops": {"laptop-*"}}
+	backend.Copy(clipboard.FmtText, []byte("hello"))
+
+	if err := a.SendToGroup("laptops"); err != nil {
+		t.Fatal(err)
+	}
+	for peerID, want := range map[string]int{"laptop-1": 1, "laptop-2": 1, "phone": 0} {
+		if n := queued(a, peerID); n != want {
+			t.Errorf("queued %d payloads for %s, want %d", n, peerID, want)
+		}
+	}
+}
+
+func TestSendToGroupTooLarge(t *testing.T) {
+	a, backend := newTestApp(t, "laptop-1")
+	a.Groups = map[string][]string{"laptops": {"laptop-*"}}
+	a.clipboard.MaxBytes = 4
+	backend.Copy(clipboard.FmtText, []byte("hello"))
+
+	if err := a.SendToGroup("laptops"); err == nil {
+		t.Fatal("SendToGroup sent content over the size limit")
+	}
+	if n := queued(a, "laptop-1"); n != 0 {
+		t.Fatalf("queued %d payloads over the size limit", n)
+	}
+}
+
+func TestSendToGroupPaused(t *testing.T) {
+	a, backend := newTestApp(t, "laptop-1")
+	a.Groups = map[string][]string{"laptops": {"laptop-*"}}
+	backend.Copy(clipboard.FmtText, []byte("password"))
+
+	a.clipboard.Pause()
+	if err := a.SendToGroup("laptops"); !errors.Is(err, errPaused) {
+		t.Fatalf("SendToGroup while paused returned %v, want %v", err, errPaused)
+	}
+	if n := queued(a, "laptop-1"); n != 0 {
+		t.Fatalf("queued %d payloads while paused, want 0", n)
+	}
+}
+
+func TestSyncNowGroupPaused(t *testing.T) {
+	a, backend := newTestApp(t, "laptop-1")
+	a.Groups = map[string][]string{"laptops": {"laptop-*"}}
+	a.SyncNowGroup = "laptops"
+	backend.Copy(clipboard.FmtText, []byte("password"))
+
+	a.clipboard.Pause()
+	a.SyncNow()
+	if n := queued(a, "laptop-1"); n != 0 {
+		t.Fatalf("queued %d payloads while paused, want 0", n)
+	}
+}
+
+func TestGroupsRejectPrivateMetadata(t *testing.T) {
+	a := NewApp("ws://127.0.0.1:0/ws", "password", "peer-a")
+	a.Groups = map[string][]string{"laptops": {"laptop-*"}}
+	a.PrivateMetadata = true
+
+	if err := a.RunContext(t.Context()); err == nil {
+		t.Fatal("RunContext accepted groups with private metadata")
+	}
+}
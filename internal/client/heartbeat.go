@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+	"github.com/pion/webrtc/v3"
+)
+
+// DefaultHeartbeatInterval is the default App.HeartbeatInterval.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// heartbeatMisses is how many heartbeat intervals a peer may go without answering
+// before its connection is considered dead.
+const heartbeatMisses = 3
+
+// heartbeat is the liveness state of one peer's control channel.
+type heartbeat struct {
+	dc       *webrtc.DataChannel
+	lastPong time.Time // Zero until the peer first answers, builds without heartbeats never do
+}
+
+// setupControlChannel answers pings from the peer on dc and records its pongs.
+// Control messages are signaling messages, so they are never mistaken for
+// clipboard envelopes.
+func (a *App) setupControlChannel(remotePeerID string, dc *webrtc.DataChannel) {
+	dc.OnOpen(func() {
+		a.mu.Lock()
+		a.heartbeats[remotePeerID] = &heartbeat{dc: dc}
+		a.mu.Unlock()
+	})
+
+	dc.OnClose(func() {
+		a.mu.Lock()
+		if hb := a.heartbeats[remotePeerID]; hb != nil && hb.dc == dc {
+			delete(a.heartbeats, remotePeerID)
+		}
+		a.mu.Unlock()
+	})
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		ctrl, err := signaling.Unmarshal(msg.Data)
+		if err != nil {
+			a.logger().Warn("Invalid control message", "peer", remotePeerID, "err", err)
+			return
+		}
+		switch ctrl.Type {
+		case signaling.TypePing:
+			a.sendControl(dc, signaling.NewPong(a.peerID, ctrl.Payload))
+		case signaling.TypePong:
+			a.handlePong(remotePeerID, dc, ctrl.Payload)
+		}
+	})
+}
+
+// sendControl sends a control message on dc.
+func (a *App) sendControl(dc *webrtc.DataChannel, msg *signaling.Message) {
+	msg.Version = signaling.ProtocolVersion
+	msg.MinVersion = signaling.MinProtocolVersion
+	data, err := msg.Marshal()
+	if err != nil {
+		return
+	}
+	dc.Send(data)
+}
+
+// handlePong records a pong echoing the send time of our ping.
+func (a *App) handlePong(remotePeerID string, dc *webrtc.DataChannel, payload string) {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := time.Since(time.Unix(0, sent))
+
+	a.mu.Lock()
+	hb := a.heartbeats[remotePeerID]
+	first := hb != nil && hb.dc == dc && hb.lastPong.IsZero()
+	if hb != nil && hb.dc == dc {
+		hb.lastPong = time.Now()
+	}
+	a.mu.Unlock()
+
+	// Only the first measurement is logged, the status keeps the latest
+	if first {
+		a.logger().Debug("Heartbeat round trip measured", "peer", remotePeerID, "rtt", rtt.Round(100*time.Microsecond))
+	}
+	a.status.update(remotePeerID, func(s *PeerStatus) { s.RTT = rtt })
+}
+
+// runHeartbeats pings every peer each HeartbeatInterval until ctx is done, and
+// reconnects the peers that stopped answering.
+func (a *App) runHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(a.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			a.checkHeartbeats(now)
+		}
+	}
+}
+
+// checkHeartbeats sends a ping to each live peer and reconnects the others.
+func (a *App) checkHeartbeats(now time.Time) {
+	var dead []string
+	var alive []*webrtc.DataChannel
+	a.mu.RLock()
+	for peerID, hb := range a.heartbeats {
+		if !hb.lastPong.IsZero() && now.Sub(hb.lastPong) > heartbeatMisses*a.HeartbeatInterval {
+			dead = append(dead, peerID)
+		} else {
+			alive = append(alive, hb.dc)
+		}
+	}
+	a.mu.RUnlock()
+
+	for _, dc := range alive {
+		a.sendControl(dc, signaling.NewPing(a.peerID, strconv.FormatInt(now.UnixNano(), 10)))
+	}
+	for _, peerID := range dead {
+		a.logger().Warn("Peer missed heartbeats, reconnecting", "peer", peerID, "missed", heartbeatMisses)
+		a.recordPeerError(peerID, "missed %d heartbeats", heartbeatMisses)
+		a.closePeerConnection(peerID)
+		a.reconnectPeer(peerID)
+	}
+}
+
+// reconnectPeer starts a fresh connection with a peer: the initiator sends a new
+// offer, the other side asks the peer to send one.
+func (a *App) reconnectPeer(remotePeerID string) {
+	if signaling.ShouldInitiate(a.peerID, remotePeerID) {
+		go a.initiateConnection(remotePeerID, 1)
+		return
+	}
+	a.sendSignal(signaling.NewJoin(a.peerID, remotePeerID, a.joinCommitment()))
+}
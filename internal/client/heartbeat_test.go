@@ -0,0 +1,121 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// controlChannel returns a control DataChannel that never opens, so sends on
+// it fail quietly.
+func controlChannel(t *testing.T) *webrtc.DataChannel {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	dc, err := pc.CreateDataChannel(labelControl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dc
+}
+
+func TestHandlePong(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		stale    bool // The pong comes on a channel that was replaced
+		recorded bool
+	}{
+		{"pong", "", false, true},
+		{"stale channel", "", true, false},
+		{"invalid payload", "not a time", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := newTestApp(t)
+			dc := controlChannel(t)
+			a.heartbeats["peer-b"] = &heartbeat{dc: dc}
+			from := dc
+			if tc.stale {
+				from = controlChannel(t)
+			}
+			payload := tc.payload
+			if payload == "" {
+				payload = strconv.FormatInt(time.Now().Add(-50*time.Millisecond).UnixNano(), 10)
+			}
+
+			a.handlePong("peer-b", from, payload)
+
+			if recorded := !a.heartbeats["peer-b"].lastPong.IsZero(); recorded != tc.recorded {
+				t.Fatalf("pong recorded: %v, want %v", recorded, tc.recorded)
+			}
+			var rtt time.Duration
+			for _, s := range a.Status() {
+				if s.PeerID == "peer-b" {
+					rtt = s.RTT
+				}
+			}
+			if tc.recorded && (rtt < 50*time.Millisecond || rtt > 5*time.Second) {
+				t.Fatalf("round trip of %s, want about 50ms", rtt)
+			}
+		})
+	}
+}
+
+func TestCheckHeartbeats(t *testing.T) {
+	const interval = time.Second
+	for _, tc := range []struct {
+		name     string
+		lastPong time.Duration // Before the check, zero if the peer never answered
+		torn     bool          // Whether the connection is torn down
+	}{
+		{"answering", interval, false},
+		{"late but within the misses", heartbeatMisses * interval, false},
+		{"missed heartbeats", (heartbeatMisses + 1) * interval, true},
+		{"never answered", 0, false}, // An older build without heartbeats
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// peer-a waits for peer-0 to offer, so reconnecting only signals it
+			a, _ := startApp(t, newTestServer(t), "peer-a", func(a *App) { a.HeartbeatInterval = interval })
+			waitJoined(t, a)
+			pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Close() })
+
+			now := time.Now()
+			hb := &heartbeat{dc: controlChannel(t)}
+			if tc.lastPong > 0 {
+				hb.lastPong = now.Add(-tc.lastPong)
+			}
+			a.mu.Lock()
+			a.peers["peer-0"] = pc
+			a.heartbeats["peer-0"] = hb
+			a.mu.Unlock()
+
+			a.checkHeartbeats(now)
+
+			a.mu.RLock()
+			_, kept := a.peers["peer-0"]
+			a.mu.RUnlock()
+			if kept == tc.torn {
+				t.Fatalf("connection kept: %v, want %v", kept, !tc.torn)
+			}
+			var lastError string
+			for _, s := range a.Status() {
+				if s.PeerID == "peer-0" {
+					lastError = s.LastError
+				}
+			}
+			if reported := strings.Contains(lastError, "missed"); reported != tc.torn {
+				t.Fatalf("reported %q, want a missed heartbeats error: %v", lastError, tc.torn)
+			}
+		})
+	}
+}
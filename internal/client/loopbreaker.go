@@ -0,0 +1,59 @@
+package client
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// A sync loop is assumed once the same content is sent or received more than
+// loopThreshold times within loopWindow. Syncing then stops for loopCooldown.
+const (
+	loopThreshold = 6
+	loopWindow    = 2 * time.Second
+	loopCooldown  = 30 * time.Second
+)
+
+// loopBreaker is a circuit breaker against sync loops. If echo cancellation fails
+// (e.g. another clipboard manager rewrites every change), the same content can
+// ping-pong between peers as fast as the network allows. The breaker spots the
+// repeated content hash and suspends syncing until the cooldown passes.
+type loopBreaker struct {
+	mu          sync.Mutex
+	seen        map[[sha256.Size]byte][]time.Time // Recent sync times per content hash
+	openedUntil time.Time                         // Syncing is suspended until then
+}
+
+// allow records a sync of content and reports whether it may proceed. tripped is
+// true only for the event that opened the breaker, so the caller warns once.
+func (b *loopBreaker) allow(content []byte, now time.Time) (ok, tripped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Before(b.openedUntil) {
+		return false, false
+	}
+
+	if b.seen == nil {
+		b.seen = make(map[[sha256.Size]byte][]time.Time)
+	}
+	for hash, times := range b.seen {
+		for len(times) > 0 && now.Sub(times[0]) > loopWindow {
+			times = times[1:]
+		}
+		if len(times) == 0 {
+			delete(b.seen, hash)
+		} else {
+			b.seen[hash] = times
+		}
+	}
+
+	hash := sha256.Sum256(content)
+	b.seen[hash] = append(b.seen[hash], now)
+	if len(b.seen[hash]) > loopThreshold {
+		b.openedUntil = now.Add(loopCooldown)
+		clear(b.seen)
+		return false, true
+	}
+	return true, false
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+// event is a sync of content, at an offset from the start of the test.
+type event struct {
+	content string
+	at      time.Duration
+}
+
+func TestLoopBreaker(t *testing.T) {
+	start := time.Now()
+	repeat := func(content string, n int, every time.Duration) []event {
+		events := make([]event, n)
+		for i := range events {
+			events[i] = event{content, time.Duration(i) * every}
+		}
+		return events
+	}
+	for _, tc := range []struct {
+		name    string
+		events  []event
+		allowed int  // Events allowed before the breaker trips
+		tripped bool // Whether the last event tripped it
+	}{
+		{"under the threshold", repeat("same", loopThreshold, 10*time.Millisecond), loopThreshold, false},
+		{"loop", repeat("same", loopThreshold+1, 10*time.Millisecond), loopThreshold, true},
+		{"slower than the window", repeat("same", 3*loopThreshold, loopWindow/2), 3 * loopThreshold, false},
+		{"distinct content", func() []event {
+			var events []event
+			for i := range 2 * loopThreshold {
+				events = append(events, event{strings.Repeat("x", i+1), time.Duration(i) * time.Millisecond})
+			}
+			return events
+		}(), 2 * loopThreshold, false},
+		{"suspended during the cooldown", append(repeat("same", loopThreshold+1, time.Millisecond),
+			event{"other", loopCooldown / 2}), loopThreshold, false},
+		{"resumed after the cooldown", append(repeat("same", loopThreshold+1, time.Millisecond),
+			event{"same", loopCooldown + time.Second}), loopThreshold + 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b loopBreaker
+			allowed := 0
+			var tripped bool
+			for _, e := range tc.events {
+				var ok bool
+				ok, tripped = b.allow([]byte(e.content), start.Add(e.at))
+				if ok {
+					allowed++
+				}
+			}
+			if allowed != tc.allowed || tripped != tc.tripped {
+				t.Fatalf("allowed %d events, tripped %v; want %d, %v", allowed, tripped, tc.allowed, tc.tripped)
+			}
+		})
+	}
+}
+
+func TestLoopBreakerTripsOnReceivedLoop(t *testing.T) {
+	sender, _ := newTestPeer(t, "room-a", "password", nil)
+	var logs bytes.Buffer
+	receiver, received := newTestPeer(t, "room-a", "password", &logs)
+
+	// A peer bouncing the same content back as fast as it can
+	for range 2 * loopThreshold {
+		sealed, err := sender.sealPayload(0, protocol.FormatText, []byte("ping-pong"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		receiver.handlePayload(sender.peerID, sealed)
+	}
+
+	if n := len(received.Writes()); n != loopThreshold {
+		t.Fatalf("wrote %d times, want the breaker to stop after %d", n, loopThreshold)
+	}
+	if strings.Count(logs.String(), "sync loop") != 1 {
+		t.Fatalf("want one warning about the sync loop, got %q", logs.String())
+	}
+}
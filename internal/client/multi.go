@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// RunAll runs several apps in one process, e.g. to bridge two rooms: a copy
+// received in one room lands on the shared system clipboard and is picked up by
+// the apps of the other rooms. The system clipboard backend is initialized once
+// and shared, while echo cancellation stays per app. RunAll returns once every
+// app has stopped; the first failure stops the others and is returned.
+func RunAll(ctx context.Context, apps ...*App) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, app := range apps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := app.RunContext(ctx); err != nil {
+				once.Do(func() { firstErr = err })
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+)
+
+func TestRunAllBridge(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to string // Rooms of the peers copying and receiving
+	}{
+		{"room-a to room-b", "room-a", "room-b"},
+		{"room-b to room-a", "room-b", "room-a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serverURL := newTestServer(t)
+			relay := func(a *App) { a.RelayThreshold = 1 } // Deliver through the hub, without DataChannels
+
+			// The bridge joins both rooms, its apps sharing one clipboard
+			shared := clipboard.NewMemoryBackend()
+			var bridge []*App
+			for _, room := range []string{"room-a", "room-b"} {
+				a := NewApp(serverURL+"?room="+room, "password", "bridge-"+room)
+				a.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+				a.ClipboardBackend = shared
+				relay(a)
+				bridge = append(bridge, a)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- RunAll(ctx, bridge...) }()
+			t.Cleanup(func() {
+				cancel()
+				if err := <-done; err != nil {
+					t.Errorf("RunAll returned %v", err)
+				}
+			})
+			for _, a := range bridge {
+				waitJoined(t, a)
+			}
+
+			sender, _ := startApp(t, serverURL+"?room="+tc.from, "sender", relay)
+			waitJoined(t, sender)
+			receiverBackend := clipboard.NewMemoryBackend()
+			receiver, _ := startApp(t, serverURL+"?room="+tc.to, "receiver", func(a *App) {
+				relay(a)
+				a.ClipboardBackend = receiverBackend
+			})
+			waitJoined(t, receiver)
+
+			sender.ClipboardBackend.(*clipboard.MemoryBackend).Copy(clipboard.FmtText, []byte("across rooms"))
+			waitFor(t, "the copy to cross the bridge", func() bool {
+				return string(receiverBackend.Read(clipboard.FmtText)) == "across rooms"
+			})
+		})
+	}
+}
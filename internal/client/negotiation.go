@@ -0,0 +1,72 @@
+package client
+
+import (
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+	"github.com/pion/webrtc/v3"
+)
+
+// negotiation is the perfect negotiation state for one peer. Offers can collide
+// ("glare") when both sides start one at once, e.g. on simultaneous joins or
+// reconnects. The impolite side then ignores the peer's offer, the polite side
+// abandons its own and answers the peer's.
+type negotiation struct {
+	makingOffer bool // An offer is being prepared, until it is sent
+	ignoreOffer bool // The peer's last offer was ignored, errors on its candidates are expected
+}
+
+// polite reports whether we yield to remotePeerID when offers collide. The
+// initiator chosen by signaling.ShouldInitiate is impolite, so both sides agree.
+func (a *App) polite(remotePeerID string) bool {
+	return !signaling.ShouldInitiate(a.peerID, remotePeerID)
+}
+
+// negotiationFor returns the state for remotePeerID. Must be called with a.mu held.
+func (a *App) negotiationFor(remotePeerID string) *negotiation {
+	n := a.negotiations[remotePeerID]
+	if n == nil {
+		n = &negotiation{}
+		a.negotiations[remotePeerID] = n
+	}
+	return n
+}
+
+// startOffer marks an offer to remotePeerID in progress. It returns false if
+// one already is, so a duplicate join doesn't start a second handshake.
+func (a *App) startOffer(remotePeerID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.negotiationFor(remotePeerID)
+	if n.makingOffer {
+		return false
+	}
+	n.makingOffer = true
+	return true
+}
+
+// finishOffer clears the mark set by startOffer.
+func (a *App) finishOffer(remotePeerID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.negotiationFor(remotePeerID).makingOffer = false
+}
+
+// acceptOffer decides whether to answer an offer from remotePeerID. An offer
+// collides with ours while we prepare one or wait for its answer; only the
+// polite side answers it then, replacing its own connection attempt.
+func (a *App) acceptOffer(remotePeerID string) (accept, collision bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.negotiationFor(remotePeerID)
+	pc := a.peers[remotePeerID]
+	collision = n.makingOffer || (pc != nil && pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer)
+	n.ignoreOffer = collision && !a.polite(remotePeerID)
+	return !n.ignoreOffer, collision
+}
+
+// ignoringOffer reports whether the last offer from remotePeerID was ignored.
+func (a *App) ignoringOffer(remotePeerID string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	n := a.negotiations[remotePeerID]
+	return n != nil && n.ignoreOffer
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// haveLocalOffer returns a PeerConnection that sent an offer and awaits the answer.
+func haveLocalOffer(t *testing.T) *webrtc.PeerConnection {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.CreateDataChannel(labelClipboard, nil); err != nil {
+		t.Fatal(err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	return pc
+}
+
+func TestPerfectNegotiation(t *testing.T) {
+	// peer-a initiates with peer-b, so peer-a is impolite and peer-b polite
+	type side struct {
+		making  bool // Preparing an offer
+		waiting bool // Sent an offer, awaiting the answer
+	}
+	for _, tc := range []struct {
+		name      string
+		a, b      side
+		aAccepts  bool // Whether peer-a answers peer-b's offer
+		bAccepts  bool // Whether peer-b answers peer-a's offer
+		collision bool
+	}{
+		{"simultaneous joins", side{making: true}, side{making: true}, false, true, true},
+		{"offers crossing in flight", side{waiting: true}, side{waiting: true}, false, true, true},
+		{"one side preparing, the other waiting", side{making: true}, side{waiting: true}, false, true, true},
+		{"only peer-a offers", side{making: true}, side{}, false, true, false},
+		{"only peer-b offers", side{}, side{making: true}, true, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _ := newTestApp(t)
+			b, _ := newTestApp(t)
+			a.peerID, b.peerID = "peer-a", "peer-b"
+			apps := map[*App]side{a: tc.a, b: tc.b}
+			remote := map[*App]string{a: "peer-b", b: "peer-a"}
+			for app, s := range apps {
+				if s.making && !app.startOffer(remote[app]) {
+					t.Fatal("an offer was already in progress")
+				}
+				if s.waiting {
+					app.peers[remote[app]] = haveLocalOffer(t)
+				}
+			}
+
+			// Each side receives the offer of the other, if it made one
+			for _, c := range []struct {
+				app     *App
+				offered bool // Whether the remote made an offer
+				accepts bool
+			}{
+				{a, tc.b.making || tc.b.waiting, tc.aAccepts},
+				{b, tc.a.making || tc.a.waiting, tc.bAccepts},
+			} {
+				if !c.offered {
+					continue
+				}
+				accept, collision := c.app.acceptOffer(remote[c.app])
+				if accept != c.accepts || collision != tc.collision {
+					t.Fatalf("%s accepted %v with collision %v, want %v and %v", c.app.peerID, accept, collision, c.accepts, tc.collision)
+				}
+				if ignoring := c.app.ignoringOffer(remote[c.app]); ignoring == c.accepts {
+					t.Fatalf("%s ignoring the offer: %v, want %v", c.app.peerID, ignoring, !c.accepts)
+				}
+			}
+			// Exactly one handshake survives a collision: the impolite side's
+			if tc.collision && tc.aAccepts == tc.bAccepts {
+				t.Fatal("both or neither side answered the colliding offers")
+			}
+		})
+	}
+}
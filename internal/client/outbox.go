@@ -0,0 +1,102 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// maxOutboxItems bounds how many payloads are held for a peer whose DataChannel is not open.
+const maxOutboxItems = 32
+
+// Backpressure on a DataChannel: sending pauses once more than maxBufferedAmount
+// bytes wait in its send buffer, and resumes when they drain to bufferedAmountLow.
+const (
+	maxBufferedAmount = 1 << 20
+	bufferedAmountLow = 256 << 10
+)
+
+// channel is the part of a DataChannel the outbox sends through.
+type channel interface {
+	Send(data []byte) error
+	BufferedAmount() uint64
+}
+
+// outbox is the single ordered queue of outgoing clipboard payloads for one peer.
+// Payloads survive a DataChannel reconnect and are flushed in copy order once the
+// channel reopens, so queued items are never overtaken by newer copies.
+//
+// While the channel is congested, a new copy replaces the queued ones that haven't
+// started sending: the peer only needs the latest clipboard, not every state in
+// between.
+type outbox struct {
+	mu        sync.Mutex // Held for the whole flush so pushes can't interleave with sends.
+	items     []outboxItem
+	congested bool    // The last flush paused for the send buffer to drain
+	dc        channel // The channel the first item was partly sent on
+}
+
+type outboxItem struct {
+	parts    [][]byte // The payload, or its fragments when too large for one send
+	next     int      // Index of the next part to send
+	queuedAt time.Time
+}
+
+// push appends a payload to the queue, evicting the oldest item when the queue is
+// full. It returns how many queued items were replaced for congestion.
+func (o *outbox) push(parts [][]byte) (coalesced int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.congested {
+		keep := 0
+		if len(o.items) > 0 && o.items[0].next > 0 {
+			keep = 1 // Partly sent, finish it so the peer isn't left with half a message
+		}
+		coalesced = len(o.items) - keep
+		o.items = o.items[:keep]
+	}
+	if len(o.items) >= maxOutboxItems {
+		o.items = o.items[1:]
+	}
+	o.items = append(o.items, outboxItem{parts: parts, queuedAt: time.Now()})
+	return coalesced
+}
+
+// flush sends queued items over dc in order, dropping those older than ttl. It
+// pauses, leaving the rest queued, once dc buffers more than maxBufferedAmount;
+// the caller flushes again when the buffer drains. It stops at the first send
+// failure too. An item cut short resumes where it stopped on the same channel,
+// and is sent again whole on another one.
+func (o *outbox) flush(dc channel, ttl time.Duration) (sent, dropped int, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if dc != o.dc && len(o.items) > 0 {
+		o.items[0].next = 0
+	}
+	o.dc = dc
+	o.congested = false
+
+	for len(o.items) > 0 {
+		item := &o.items[0]
+		if item.next == 0 && ttl > 0 && time.Since(item.queuedAt) > ttl {
+			o.items = o.items[1:]
+			dropped++
+			continue
+		}
+		for item.next < len(item.parts) {
+			if dc.BufferedAmount() > maxBufferedAmount {
+				o.congested = true
+				return sent, dropped, nil
+			}
+			if err := dc.Send(item.parts[item.next]); err != nil {
+				item.next = 0
+				return sent, dropped, err
+			}
+			item.next++
+		}
+		o.items = o.items[1:]
+		sent++
+	}
+	return sent, dropped, nil
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+)
+
+// fakeChannel records what is sent through it, and fails once it has sent
+// failAfter messages when failAfter is positive.
+type fakeChannel struct {
+	sent      []string
+	failAfter int
+	buffered  uint64
+}
+
+func (c *fakeChannel) Send(data []byte) error {
+	if c.failAfter > 0 && len(c.sent) >= c.failAfter {
+		return errors.New("channel closed")
+	}
+	c.sent = append(c.sent, string(data))
+	return nil
+}
+
+func (c *fakeChannel) BufferedAmount() uint64 { return c.buffered }
+
+// payload returns a queued item made of parts.
+func payload(parts ...string) [][]byte {
+	var out [][]byte
+	for _, part := range parts {
+		out = append(out, []byte(part))
+	}
+	return out
+}
+
+func TestOutboxOrderAcrossReconnect(t *testing.T) {
+	var ob outbox
+	ob.push(payload("copy 1"))
+	ob.push(payload("copy 2a", "copy 2b"))
+
+	// The channel drops in the middle of copy 2
+	first := &fakeChannel{failAfter: 2}
+	if sent, _, err := ob.flush(first, time.Minute); err == nil || sent != 1 {
+		t.Fatalf("flush sent %d items with error %v, want 1 and an error", sent, err)
+	}
+
+	// Copies made while reconnecting queue behind the unsent ones
+	ob.push(payload("copy 3"))
+	ob.push(payload("copy 4"))
+
+	second := &fakeChannel{}
+	if sent, dropped, err := ob.flush(second, time.Minute); err != nil || sent != 3 || dropped != 0 {
+		t.Fatalf("flush after reconnect: sent %d, dropped %d, err %v; want 3, 0, nil", sent, dropped, err)
+	}
+	// Copy 2 is sent whole again on the new channel, then the newer copies
+	want := []string{"copy 2a", "copy 2b", "copy 3", "copy 4"}
+	if !slices.Equal(second.sent, want) {
+		t.Fatalf("sent %q after reconnect, want %q", second.sent, want)
+	}
+}
+
+func TestOutboxDropsStaleItems(t *testing.T) {
+	var ob outbox
+	ob.push(payload("stale"))
+	ob.items[0].queuedAt = time.Now().Add(-time.Hour)
+	ob.push(payload("fresh"))
+
+	dc := &fakeChannel{}
+	sent, dropped, err := ob.flush(dc, time.Minute)
+	if err != nil || sent != 1 || dropped != 1 {
+		t.Fatalf("flush: sent %d, dropped %d, err %v; want 1, 1, nil", sent, dropped, err)
+	}
+	if !slices.Equal(dc.sent, []string{"fresh"}) {
+		t.Fatalf("sent %q, want only the fresh item", dc.sent)
+	}
+}
+
+func TestOutboxBounded(t *testing.T) {
+	var ob outbox
+	for i := range maxOutboxItems + 5 {
+		ob.push(payload(fmt.Sprintf("copy %d", i)))
+	}
+	dc := &fakeChannel{}
+	ob.flush(dc, 0)
+	if len(dc.sent) != maxOutboxItems || dc.sent[0] != "copy 5" {
+		t.Fatalf("sent %d items starting with %q, want the newest %d", len(dc.sent), dc.sent[0], maxOutboxItems)
+	}
+}
+
+// fillingChannel is a fakeChannel whose send buffer grows by perSend bytes with
+// every message, and only drains when the test says so.
+type fillingChannel struct {
+	fakeChannel
+	perSend uint64
+}
+
+func (c *fillingChannel) Send(data []byte) error {
+	c.buffered += c.perSend
+	return c.fakeChannel.Send(data)
+}
+
+func TestOutboxBackpressure(t *testing.T) {
+	var ob outbox
+	ob.push(payload("copy 1a", "copy 1b", "copy 1c"))
+
+	// The buffer is over the limit after two fragments, so the flush pauses
+	dc := &fillingChannel{perSend: maxBufferedAmount}
+	if sent, _, err := ob.flush(dc, time.Minute); err != nil || sent != 0 {
+		t.Fatalf("congested flush: sent %d, err %v; want 0, nil", sent, err)
+	}
+	if want := []string{"copy 1a", "copy 1b"}; !slices.Equal(dc.sent, want) {
+		t.Fatalf("sent %q before pausing, want %q", dc.sent, want)
+	}
+
+	// Copies made meanwhile replace each other, but not the partly sent one
+	if n := ob.push(payload("copy 2")); n != 0 {
+		t.Fatalf("first push while congested replaced %d items, want 0", n)
+	}
+	if n := ob.push(payload("copy 3")); n != 1 {
+		t.Fatalf("second push while congested replaced %d items, want 1", n)
+	}
+
+	// Once the buffer drains, copy 1 resumes at its next fragment
+	dc.buffered = 0
+	if sent, _, err := ob.flush(dc, time.Minute); err != nil || sent != 2 {
+		t.Fatalf("flush after draining: sent %d, err %v; want 2, nil", sent, err)
+	}
+	want := []string{"copy 1a", "copy 1b", "copy 1c", "copy 3"}
+	if !slices.Equal(dc.sent, want) {
+		t.Fatalf("sent %q, want %q", dc.sent, want)
+	}
+}
+
+func TestOutboxPausedItemRestartsOnNewChannel(t *testing.T) {
+	var ob outbox
+	ob.push(payload("copy 1a", "copy 1b"))
+	ob.flush(&fillingChannel{perSend: maxBufferedAmount + 1}, time.Minute)
+
+	// The congested channel closes before draining; the new one gets all of copy 1
+	dc := &fakeChannel{}
+	if sent, _, err := ob.flush(dc, time.Minute); err != nil || sent != 1 {
+		t.Fatalf("flush on the new channel: sent %d, err %v; want 1, nil", sent, err)
+	}
+	if want := []string{"copy 1a", "copy 1b"}; !slices.Equal(dc.sent, want) {
+		t.Fatalf("sent %q on the new channel, want %q", dc.sent, want)
+	}
+}
+
+func TestOutboxRemovedWhenConnectionCloses(t *testing.T) {
+	serverURL := newTestServer(t)
+	a, _ := startApp(t, serverURL, "peer-a", nil)
+	waitJoined(t, a)
+	startApp(t, serverURL, "peer-b", nil)
+
+	waitFor(t, "the DataChannel to open", func() bool { return a.channelOpen("peer-b") })
+
+	// The connection goes away without the peer leaving the room
+	a.mu.RLock()
+	pc := a.peers["peer-b"]
+	a.mu.RUnlock()
+	pc.Close()
+
+	waitFor(t, "the outbox to be removed", func() bool {
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+		_, ok := a.outboxes["peer-b"]
+		return !ok
+	})
+}
+
+func TestOutboxResentAfterSignalingReconnect(t *testing.T) {
+	serverURL := newTestServer(t)
+	backend := clipboard.NewMemoryBackend()
+	a, _ := startApp(t, serverURL, "peer-a", func(a *App) { a.ClipboardBackend = backend })
+	waitJoined(t, a)
+	// A peer whose DataChannel is down, so what is sent to it stays queued
+	a.mu.Lock()
+	a.outboxes["peer-b"] = &outbox{}
+	a.mu.Unlock()
+	queuedForB := func(n int) func() bool {
+		return func() bool {
+			a.mu.RLock()
+			defer a.mu.RUnlock()
+			return queued(a, "peer-b") == n
+		}
+	}
+
+	backend.Copy(clipboard.FmtText, []byte("before the outage"))
+	waitFor(t, "the first copy to be queued", queuedForB(1))
+
+	// The signaling connection drops, and the user copies again meanwhile
+	a.wsMu.Lock()
+	lost := a.conn
+	a.wsMu.Unlock()
+	lost.NetConn().Close()
+	backend.Copy(clipboard.FmtText, []byte("during the outage"))
+	waitFor(t, "the reconnect", func() bool {
+		a.wsMu.Lock()
+		defer a.wsMu.Unlock()
+		return a.conn != nil && a.conn != lost
+	})
+
+	waitFor(t, "the second copy to be queued", queuedForB(2))
+
+	// Both copies are still queued, and go out in order once the channel reopens
+	a.mu.RLock()
+	ob := a.outboxes["peer-b"]
+	a.mu.RUnlock()
+	if ob == nil {
+		t.Fatal("the outbox was dropped by the reconnect")
+	}
+	dc := &fakeChannel{}
+	if sent, dropped, err := ob.flush(dc, time.Minute); err != nil || sent != 2 || dropped != 0 {
+		t.Fatalf("flush after reconnect: sent %d, dropped %d, err %v; want 2, 0, nil", sent, dropped, err)
+	}
+	b, received := newTestApp(t)
+	b.room = "default"
+	for _, payload := range dc.sent {
+		b.handlePayload("peer-a", []byte(payload))
+	}
+	if got := string(received.Read(clipboard.FmtText)); got != "during the outage" {
+		t.Fatalf("the peer ends up with %q, want the latest copy", got)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after 10 seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
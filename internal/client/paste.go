@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+// pasteTimeout bounds how long a paste command may run.
+const pasteTimeout = 30 * time.Second
+
+// pasteQueueSize is how many received items may wait for slow paste targets
+// before new ones are dropped.
+const pasteQueueSize = 16
+
+// paste delivers content received from remotePeerID to the configured paste
+// targets, or to the system clipboard when none is configured. Paste targets
+// run on their own goroutine, so a slow paste command doesn't hold up the
+// signaling or DataChannel receive path it is called from.
+func (a *App) paste(remotePeerID string, format protocol.Format, content []byte) {
+	if a.PasteExec == "" && a.PastePipe == "" {
+		a.clipboard.WriteSafelyWithTTL(clipboardFormat(format), content, a.ClearAfter)
+		if a.OnRemoteWrite != nil {
+			a.OnRemoteWrite(remotePeerID, clipboardFormat(format), len(content))
+		}
+		return
+	}
+
+	select {
+	case a.pastes <- content:
+	default:
+		a.logger().Warn("Paste targets are falling behind, dropped content from a peer", "peer", remotePeerID, "queued", pasteQueueSize)
+	}
+}
+
+// runPasteTargets delivers queued content to the paste targets, in the order it
+// was received, until ctx is done.
+func (a *App) runPasteTargets(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case content := <-a.pastes:
+			a.pasteTargets(content)
+		}
+	}
+}
+
+// pasteTargets runs PasteExec and writes PastePipe with content.
+func (a *App) pasteTargets(content []byte) {
+	if a.PasteExec != "" {
+		if err := pasteExec(a.PasteExec, content); err != nil {
+			a.logger().Error("Paste command failed", "err", err)
+		}
+	}
+	if a.PastePipe != "" {
+		if err := pastePipe(a.PastePipe, content); err != nil {
+			a.logger().Error("Writing to the paste pipe failed", "err", err)
+		}
+	}
+}
+
+// clipboardFormat returns the clipboard format to write an envelope format as.
+func clipboardFormat(format protocol.Format) clipboard.Format {
+	if format == protocol.FormatImage {
+		return clipboard.FmtImage
+	}
+	return clipboard.FmtText
+}
+
+// pasteExec runs command through the shell with content on its stdin.
+func pasteExec(command string, content []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pasteTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(content)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// pastePipe appends content to a file or named pipe. A pipe is opened without
+// blocking, so a missing reader is reported instead of stalling the receive path.
+func pastePipe(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(content)
+	return err
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+func TestPasteExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub commands need a POSIX shell")
+	}
+	for _, tc := range []struct {
+		name    string
+		command string // Run with the path of an output file as $OUT
+		output  string // Written to $OUT
+		err     string // Substring of the error, empty if the command succeeds
+	}{
+		{"stdin", `cat > "$OUT"`, "received", ""},
+		{"failing command", `echo broken >&2; exit 3`, "", "broken"},
+		{"missing command", `no-such-command-for-clipboard-sync`, "", "not found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			t.Setenv("OUT", out)
+
+			err := pasteExec(tc.command, []byte("received"))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("returned %v, want an error containing %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(out); string(got) != tc.output {
+				t.Fatalf("the command received %q, want %q", got, tc.output)
+			}
+		})
+	}
+}
+
+func TestPastePipe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are POSIX only")
+	}
+	for _, tc := range []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		want    string // Content of the file afterwards, empty if the write fails
+	}{
+		{"empty file", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, "received"},
+		{"appended", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte("earlier "), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}, "earlier received"},
+		{"missing", func(t *testing.T, path string) {}, ""},
+		{"pipe without a reader", func(t *testing.T, path string) {
+			if err := syscall.Mkfifo(path, 0o600); err != nil {
+				t.Skip(err)
+			}
+		}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "paste")
+			tc.prepare(t, path)
+
+			err := pastePipe(path, []byte("received"))
+			if tc.want == "" {
+				if err == nil {
+					t.Fatal("wrote to a target that can't take it")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != tc.want {
+				t.Fatalf("the file holds %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPasteTargets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the stub commands need a POSIX shell")
+	}
+	for _, tc := range []struct {
+		name    string
+		command string
+		logged  string // Logged error, empty if the command succeeds
+	}{
+		{"command", `cat > "$OUT"`, ""},
+		{"failing command", `exit 1`, "Paste command failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			t.Setenv("OUT", out)
+			sender, _ := newTestPeer(t, "room-a", "password", nil)
+			var logs syncBuffer
+			receiver, received := newTestPeer(t, "room-a", "password", nil)
+			receiver.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+			receiver.PasteExec = tc.command
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				receiver.runPasteTargets(ctx)
+			}()
+			t.Cleanup(func() {
+				cancel()
+				<-done
+			})
+
+			sealed, err := sender.sealPayload(0, protocol.FormatText, []byte("received"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver.handlePayload(sender.peerID, sealed)
+
+			if tc.logged != "" {
+				waitFor(t, "the failure to be logged", func() bool { return strings.Contains(logs.String(), tc.logged) })
+			} else {
+				waitFor(t, "the command to run", func() bool {
+					got, _ := os.ReadFile(out)
+					return bytes.Equal(got, []byte("received"))
+				})
+			}
+			if n := len(received.Writes()); n != 0 {
+				t.Fatalf("wrote %d times to the clipboard, want the paste target only", n)
+			}
+		})
+	}
+}
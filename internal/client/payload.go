@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/hex"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/crypto"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+)
+
+// messageAAD returns the associated data binding a message to this room and to
+// the peer that sent it. A message captured in one room, or sent by another peer,
+// fails authentication instead of being accepted.
+func (a *App) messageAAD(senderID string) []byte {
+	return []byte("clipboard-sync/message/" + a.room + "\x00" + senderID)
+}
+
+// payloadAAD returns the associated data of the payload of env: messageAAD
+// followed by the envelope header, so a relay can't turn a message into a batch
+// or change its format without failing authentication.
+func (a *App) payloadAAD(senderID string, env *protocol.Envelope) []byte {
+	return append(a.messageAAD(senderID), env.AuthenticatedHeader()...)
+}
+
+// sealPayload encrypts a clipboard body and wraps it in an envelope ready to be
+// sent to peers.
+func (a *App) sealPayload(flags protocol.Flags, format protocol.Format, body []byte) ([]byte, error) {
+	env := protocol.Envelope{
+		Version: protocol.Version,
+		Flags:   flags,
+		Format:  format,
+		Seq:     a.sendSeq.Add(1),
+	}
+	ciphertext, err := a.keys.Encrypt(body, crypto.EncryptOptions{
+		Cipher:           a.Cipher,
+		Compress:         a.Compress,
+		CompressionLevel: a.CompressionLevel,
+		AAD:              a.payloadAAD(a.peerID, &env),
+	})
+	if err != nil {
+		return nil, err
+	}
+	env.Payload = ciphertext
+	return env.Marshal()
+}
+
+// openPayload decrypts the payload of an envelope sent by remotePeerID in this room.
+func (a *App) openPayload(remotePeerID string, env *protocol.Envelope) ([]byte, error) {
+	return a.keys.Decrypt(env.Payload, crypto.DecryptOptions{
+		Nonces: a.nonces,
+		AAD:    a.payloadAAD(remotePeerID, env),
+	})
+}
+
+// joinCommitment returns the payload of this peer's join messages: a commitment
+// to the key, so peers can tell up front that they don't share the password.
+func (a *App) joinCommitment() string {
+	return hex.EncodeToString(crypto.KeyCommitment(a.currentKey(), a.messageAAD(a.peerID)))
+}
+
+// checkJoinCommitment warns if the peer that sent a join uses another password
+// or room. Joins without a commitment are accepted silently.
+func (a *App) checkJoinCommitment(msg *signaling.Message) {
+	if msg.Payload == "" {
+		return
+	}
+	commitment, err := hex.DecodeString(msg.Payload)
+	if err == nil && crypto.VerifyKeyCommitment(a.currentKey(), a.messageAAD(msg.FromPeer), commitment) {
+		return
+	}
+	a.recordPeerError(msg.FromPeer, "key commitment mismatch (wrong password or room?)")
+	a.logger().Warn("Peer uses a different password or room, its clipboard won't be synced", "peer", msg.FromPeer)
+}
@@ -0,0 +1,194 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/clipboard"
+	"github.com/Pujan-khunt/clipboard-sync/internal/crypto"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+// newTestPeer returns an App in room with the key of password, logging to logs.
+func newTestPeer(t *testing.T, room, password string, logs *bytes.Buffer) (*App, *clipboard.MemoryBackend) {
+	t.Helper()
+	a, backend := newTestApp(t)
+	a.keys = crypto.NewKeyring()
+	a.setKey(crypto.DeriveKey(password))
+	a.room = room
+	if logs != nil {
+		a.Logger = slog.New(slog.NewTextHandler(logs, nil))
+	}
+	return a, backend
+}
+
+func TestCrossRoomMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		room     string // Of the sender, the receiver is in room-a
+		password string
+		warning  string // Logged when the message is dropped, empty if it is accepted
+	}{
+		{"same room", "room-a", "password", ""},
+		{"other room, shared password", "room-b", "password", "wrong password or room?"},
+		{"other password", "room-a", "other", "Decryption failed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, _ := newTestPeer(t, tc.room, tc.password, nil)
+			var logs bytes.Buffer
+			receiver, received := newTestPeer(t, "room-a", "password", &logs)
+
+			sealed, err := sender.sealPayload(0, protocol.FormatText, []byte("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver.handlePayload(sender.peerID, sealed)
+
+			got := string(received.Read(clipboard.FmtText))
+			if tc.warning == "" {
+				if got != "hello" {
+					t.Fatalf("received %q, want %q", got, "hello")
+				}
+				return
+			}
+			if got != "" {
+				t.Fatalf("a foreign message reached the clipboard: %q", got)
+			}
+			if !strings.Contains(logs.String(), tc.warning) {
+				t.Fatalf("no %q warning about the foreign message, got %q", tc.warning, logs.String())
+			}
+		})
+	}
+}
+
+func TestAcceptTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		accept   []string
+		format   protocol.Format
+		accepted bool
+	}{
+		{"all by default", nil, protocol.FormatImage, true},
+		{"exact type", []string{"text/plain"}, protocol.FormatText, true},
+		{"other type", []string{"text/plain"}, protocol.FormatImage, false},
+		{"wildcard subtype", []string{"image/*"}, protocol.FormatImage, true},
+		{"wildcard of another type", []string{"image/*"}, protocol.FormatText, false},
+		{"wildcard prefix only", []string{"text/plai*"}, protocol.FormatText, false},
+		{"any type", []string{"*/*"}, protocol.FormatImage, true},
+		{"one of several", []string{"application/pdf", "text/*"}, protocol.FormatText, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, _ := newTestPeer(t, "room-a", "password", nil)
+			var logs bytes.Buffer
+			receiver, received := newTestPeer(t, "room-a", "password", &logs)
+			receiver.AcceptTypes = tc.accept
+
+			sealed, err := sender.sealPayload(0, tc.format, []byte("content"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver.handlePayload(sender.peerID, sealed)
+
+			written := len(received.Writes()) > 0
+			if written != tc.accepted {
+				t.Fatalf("written to the clipboard: %v, want %v", written, tc.accepted)
+			}
+			if dropped := strings.Contains(logs.String(), "isn't an accepted type"); dropped == tc.accepted {
+				t.Fatalf("logged the drop: %v, want %v", dropped, !tc.accepted)
+			}
+		})
+	}
+}
+
+func TestOnRemoteWrite(t *testing.T) {
+	type write struct {
+		peerID string
+		format clipboard.Format
+		size   int
+	}
+	for _, tc := range []struct {
+		name    string
+		format  protocol.Format
+		content string
+		accept  []string
+		want    []write
+	}{
+		{"text", protocol.FormatText, "hello", nil, []write{{"peer-a", clipboard.FmtText, 5}}},
+		{"image", protocol.FormatImage, "not really a PNG", nil, []write{{"peer-a", clipboard.FmtImage, 16}}},
+		{"dropped", protocol.FormatImage, "not really a PNG", []string{"text/plain"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sender, _ := newTestPeer(t, "room-a", "password", nil)
+			receiver, _ := newTestPeer(t, "room-a", "password", nil)
+			receiver.AcceptTypes = tc.accept
+			var got []write
+			receiver.OnRemoteWrite = func(peerID string, format clipboard.Format, size int) {
+				// The hook may use the clipboard, no lock of the manager is held
+				receiver.History()
+				got = append(got, write{peerID, format, size})
+			}
+
+			sealed, err := sender.sealPayload(0, tc.format, []byte(tc.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver.handlePayload(sender.peerID, sealed)
+
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("the hook was called with %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecryptionFailureEvent(t *testing.T) {
+	sender, _ := newTestPeer(t, "room-b", "password", nil)
+	var logs bytes.Buffer
+	receiver, _ := newTestPeer(t, "room-a", "password", nil)
+	receiver.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+
+	sealed, err := sender.sealPayload(0, protocol.FormatText, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver.handlePayload("peer-b", sealed)
+
+	var event struct {
+		Level string
+		Msg   string
+		Peer  string
+		Hint  string
+		Err   string
+	}
+	if err := json.Unmarshal(logs.Bytes(), &event); err != nil {
+		t.Fatalf("invalid JSON event %q: %v", logs.String(), err)
+	}
+	if event.Level != "WARN" || event.Msg != "Decryption failed" || event.Peer != "peer-b" ||
+		event.Hint != "wrong password or room?" || event.Err == "" {
+		t.Fatalf("logged %+v, want a warning with the peer, hint and error", event)
+	}
+}
+
+func TestSealPayloadSeq(t *testing.T) {
+	a, _ := newTestApp(t, "peer-b")
+	var seqs []uint64
+	for _, size := range []int{5, 3 * maxDataChannelMessage, 5} {
+		sealed, err := a.sealPayload(0, protocol.FormatText, bytes.Repeat([]byte("x"), size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := protocol.Unmarshal(sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, env.Seq)
+		a.deliver([]string{"peer-b"}, sealed) // The large one is fragmented
+	}
+	if !slices.Equal(seqs, []uint64{1, 2, 3}) {
+		t.Fatalf("envelopes sealed with sequence numbers %v, want 1, 2, 3", seqs)
+	}
+}
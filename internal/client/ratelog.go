@@ -0,0 +1,53 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// failureLogInterval is how often repeated failures from one peer are logged.
+const failureLogInterval = 30 * time.Second
+
+// failureLog throttles log lines for failures that repeat for the same peer, such
+// as every message from a peer with the wrong password failing to decrypt. The
+// first failure is logged, then at most one summary per failureLogInterval.
+type failureLog struct {
+	mu    sync.Mutex
+	peers map[string]*failureState
+}
+
+type failureState struct {
+	lastLogged time.Time
+	suppressed int // Failures not logged since lastLogged
+}
+
+// record notes a failure from peerID and reports whether it should be logged. When
+// it should, suppressed is the number of failures skipped since the last log line.
+func (f *failureLog) record(peerID string, now time.Time) (shouldLog bool, suppressed int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.peers == nil {
+		f.peers = make(map[string]*failureState)
+	}
+	state, exists := f.peers[peerID]
+	if !exists {
+		f.peers[peerID] = &failureState{lastLogged: now}
+		return true, 0
+	}
+
+	if now.Sub(state.lastLogged) < failureLogInterval {
+		state.suppressed++
+		return false, 0
+	}
+	suppressed = state.suppressed
+	state.lastLogged, state.suppressed = now, 0
+	return true, suppressed
+}
+
+// forget drops the state kept for a peer.
+func (f *failureLog) forget(peerID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.peers, peerID)
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/crypto"
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+func TestFailureLog(t *testing.T) {
+	start := time.Now()
+	var f failureLog
+	for _, tc := range []struct {
+		name       string
+		peer       string
+		after      time.Duration // Since start
+		log        bool
+		suppressed int
+	}{
+		{"first failure", "peer-a", 0, true, 0},
+		{"repeated", "peer-a", time.Second, false, 0},
+		{"repeated again", "peer-a", 2 * time.Second, false, 0},
+		{"another peer", "peer-b", 2 * time.Second, true, 0},
+		{"summary after the interval", "peer-a", failureLogInterval, true, 2},
+		{"quiet again", "peer-a", failureLogInterval + time.Second, false, 0},
+	} {
+		log, suppressed := f.record(tc.peer, start.Add(tc.after))
+		if log != tc.log || suppressed != tc.suppressed {
+			t.Fatalf("%s: record returned %v, %d; want %v, %d", tc.name, log, suppressed, tc.log, tc.suppressed)
+		}
+	}
+
+	f.forget("peer-a")
+	if log, _ := f.record("peer-a", start.Add(failureLogInterval+2*time.Second)); !log {
+		t.Fatal("a forgotten peer's next failure wasn't logged")
+	}
+}
+
+func TestDecryptionFailuresThrottled(t *testing.T) {
+	sender, _ := newTestApp(t)
+	sender.keys = crypto.NewKeyring()
+	sender.setKey(crypto.DeriveKey("wrong password"))
+	receiver, _ := newTestApp(t)
+	var logs syncBuffer
+	receiver.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	for range 100 {
+		sealed, err := sender.sealPayload(0, protocol.FormatText, []byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		receiver.handlePayload("peer-b", sealed)
+	}
+	if n := strings.Count(logs.String(), "Decryption failed"); n != 1 {
+		t.Fatalf("logged %d decryption failures for 100 messages, want 1", n)
+	}
+}
@@ -0,0 +1,28 @@
+package client
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff between attempts to reconnect to the signaling server.
+const (
+	signalingRetryBase = time.Second
+	signalingRetryMax  = 30 * time.Second
+)
+
+// reconnectDelay is the wait before reconnect attempt n (from 1): exponential
+// backoff, with jitter so that clients dropped together by a server restart
+// don't all reconnect at the same instant.
+func reconnectDelay(attempt int) time.Duration {
+	delay := min(signalingRetryBase<<min(attempt-1, 5), signalingRetryMax)
+	return delay/2 + rand.N(delay/2)
+}
+
+// channelOpen reports whether the clipboard DataChannel with a peer is open.
+func (a *App) channelOpen(remotePeerID string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, open := a.dataChans[remotePeerID]
+	return open
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration // Before jitter, which takes off up to half
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 16 * time.Second},
+		{6, signalingRetryMax},
+		{7, signalingRetryMax},
+		{100, signalingRetryMax},
+	} {
+		t.Run(fmt.Sprintf("attempt %d", tc.attempt), func(t *testing.T) {
+			seen := make(map[time.Duration]bool)
+			for range 100 {
+				delay := reconnectDelay(tc.attempt)
+				if delay < tc.max/2 || delay >= tc.max {
+					t.Fatalf("attempt %d waits %s, want [%s, %s)", tc.attempt, delay, tc.max/2, tc.max)
+				}
+				seen[delay] = true
+			}
+			if len(seen) < 2 {
+				t.Fatalf("attempt %d always waits the same, want jitter", tc.attempt)
+			}
+		})
+	}
+}
+
+func TestReconnectResendsJoin(t *testing.T) {
+	serverURL := newTestServer(t)
+	a, _ := startApp(t, serverURL, "peer-a", nil)
+	waitJoined(t, a)
+	_, received := rawPeer(t, serverURL, "peer-b")
+
+	a.wsMu.Lock()
+	lost := a.conn
+	a.wsMu.Unlock()
+	lost.NetConn().Close()
+
+	join := nextOfType(t, received, signaling.TypeJoin)
+	if join.FromPeer != "peer-a" || join.ToPeer != "" {
+		t.Fatalf("join from %q to %q, want a broadcast from peer-a", join.FromPeer, join.ToPeer)
+	}
+	if !join.Resume {
+		t.Fatal("the join after a reconnect isn't marked as resuming")
+	}
+}
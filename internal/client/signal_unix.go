@@ -0,0 +1,14 @@
+//go:build !windows
+
+package client
+
+import (
+	"os"
+	"syscall"
+)
+
+// syncNowSignals trigger SyncNow, e.g. `kill -USR2 <pid>`.
+var syncNowSignals = []os.Signal{syscall.SIGUSR2}
+
+// pauseSignals toggle pausing the sync of local copies, e.g. `kill -USR1 <pid>`.
+var pauseSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,9 @@
+package client
+
+import "os"
+
+// syncNowSignals is empty on Windows, which has no user-defined signals.
+var syncNowSignals []os.Signal
+
+// pauseSignals is empty on Windows, which has no user-defined signals.
+var pauseSignals []os.Signal
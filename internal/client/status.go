@@ -0,0 +1,134 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PeerStatus describes the connection to one remote peer.
+type PeerStatus struct {
+	PeerID      string
+	State       string        // WebRTC connection state, e.g. "connected"
+	ChannelOpen bool          // Whether the clipboard DataChannel is open
+	RTT         time.Duration // Latest heartbeat round trip, zero until measured
+	LastSync    time.Time     // When clipboard content was last sent to or received from the peer
+
+	LastError   string    // Most recent error with this peer, if any
+	LastErrorAt time.Time // When LastError happened
+}
+
+// statusBoard keeps a snapshot of the peer statuses for observers. Writers update
+// it when a connection changes, readers load the snapshot without taking any lock,
+// so polling the status never contends with the send path on App.mu.
+type statusBoard struct {
+	mu       sync.Mutex // Serializes writers
+	peers    map[string]PeerStatus
+	snapshot atomic.Pointer[[]PeerStatus]
+}
+
+// update applies fn to the status of peerID, creating it if needed, and
+// publishes a new snapshot.
+func (b *statusBoard) update(peerID string, fn func(*PeerStatus)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.peers == nil {
+		b.peers = make(map[string]PeerStatus)
+	}
+	status, ok := b.peers[peerID]
+	if !ok {
+		status.PeerID = peerID
+	}
+	fn(&status)
+	b.peers[peerID] = status
+	b.publish()
+}
+
+// remove drops peerID from the board.
+func (b *statusBoard) remove(peerID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.peers[peerID]; ok {
+		delete(b.peers, peerID)
+		b.publish()
+	}
+}
+
+// publish stores a sorted copy of the peers as the new snapshot. Must be called with b.mu held.
+func (b *statusBoard) publish() {
+	snapshot := make([]PeerStatus, 0, len(b.peers))
+	for _, status := range b.peers {
+		snapshot = append(snapshot, status)
+	}
+	slices.SortFunc(snapshot, func(x, y PeerStatus) int { return strings.Compare(x.PeerID, y.PeerID) })
+	b.snapshot.Store(&snapshot)
+}
+
+// load returns the latest snapshot. Callers must not modify it.
+func (b *statusBoard) load() []PeerStatus {
+	if snapshot := b.snapshot.Load(); snapshot != nil {
+		return *snapshot
+	}
+	return nil
+}
+
+// recordPeerError stores an error as the most recent one for a peer.
+func (a *App) recordPeerError(remotePeerID, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	a.status.update(remotePeerID, func(s *PeerStatus) {
+		s.LastError = msg
+		s.LastErrorAt = time.Now()
+	})
+}
+
+// Status returns the status of every known peer, sorted by peer ID. It is cheap
+// and safe to call from any goroutine, at any rate.
+func (a *App) Status() []PeerStatus {
+	return slices.Clone(a.status.load())
+}
+
+// markSynced records that clipboard content was exchanged with a peer.
+func (a *App) markSynced(remotePeerID string) {
+	a.status.update(remotePeerID, func(s *PeerStatus) { s.LastSync = time.Now() })
+}
+
+// runStatus logs a summary of the peers every StatusInterval until ctx is done.
+func (a *App) runStatus(ctx context.Context) {
+	ticker := time.NewTicker(a.StatusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.logStatus()
+		}
+	}
+}
+
+// logStatus logs one event per peer: connection and channel state, round trip,
+// last sync and last error.
+func (a *App) logStatus() {
+	peers := a.Status()
+	a.logger().Info("Status", "peers", len(peers))
+	for _, p := range peers {
+		attrs := []any{"peer", p.PeerID, "state", cmp.Or(p.State, "new"), "channel_open", p.ChannelOpen}
+		if p.RTT > 0 {
+			attrs = append(attrs, "rtt", p.RTT.Round(100*time.Microsecond))
+		}
+		if !p.LastSync.IsZero() {
+			attrs = append(attrs, "last_sync", p.LastSync.Format(time.RFC3339))
+		}
+		if p.LastError != "" {
+			attrs = append(attrs, "last_error", p.LastError, "last_error_at", p.LastErrorAt.Format(time.RFC3339))
+		}
+		a.logger().Info("Peer status", attrs...)
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/protocol"
+)
+
+func TestLastSync(t *testing.T) {
+	a, _ := newTestApp(t, "peer-b")
+	a.sendClipboard(0, protocol.FormatText, []byte("hello"))
+	dc := &fakeChannel{}
+	if _, _, err := a.outboxes["peer-b"].flush(dc, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := newTestApp(t)
+	for _, payload := range dc.sent {
+		b.handlePayload("peer-a", []byte(payload))
+	}
+	peers := b.Status()
+	if len(peers) != 1 || peers[0].PeerID != "peer-a" || peers[0].LastSync.IsZero() {
+		t.Fatalf("status after receiving %+v, want peer-a with a last sync", peers)
+	}
+}
+
+func TestLogStatus(t *testing.T) {
+	var logs bytes.Buffer
+	a, _ := newTestPeer(t, "default", "password", &logs)
+	a.status.update("peer-b", func(s *PeerStatus) {
+		s.State = "connected"
+		s.ChannelOpen = true
+	})
+	a.markSynced("peer-b")
+	a.recordPeerError("peer-c", "handshake timed out")
+
+	a.logStatus()
+
+	for _, want := range []string{
+		"msg=Status peers=2",
+		"peer=peer-b state=connected channel_open=true last_sync=",
+		`peer=peer-c state=new channel_open=false last_error="handshake timed out" last_error_at=`,
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("status log is missing %q:\n%s", want, logs.String())
+		}
+	}
+}
+
+// BenchmarkSendWithStatusReaders measures send throughput alone and while
+// goroutines poll Status as fast as they can. Status reads a snapshot without
+// taking App.mu, so both should be about the same when there are spare cores
+// for the readers; with GOMAXPROCS=1 they only share the CPU.
+func BenchmarkSendWithStatusReaders(b *testing.B) {
+	for _, readers := range []int{0, runtime.GOMAXPROCS(0)} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+			peerIDs := []string{"peer-b", "peer-c", "peer-d", "peer-e"}
+			a, _ := newTestApp(b, peerIDs...)
+			for _, peerID := range peerIDs {
+				a.status.update(peerID, func(s *PeerStatus) { s.State = "connected" })
+			}
+			body := []byte("clipboard content of a typical size for a copied line of text")
+
+			done := make(chan struct{})
+			var wg sync.WaitGroup
+			for range readers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						select {
+						case <-done:
+							return
+						default:
+							if len(a.Status()) != len(peerIDs) {
+								panic("status lost a peer")
+							}
+						}
+					}
+				}()
+			}
+
+			b.SetBytes(int64(len(body)))
+			b.ResetTimer()
+			for range b.N {
+				a.sendClipboard(0, protocol.FormatText, body)
+			}
+			b.StopTimer()
+			close(done)
+			wg.Wait()
+		})
+	}
+}
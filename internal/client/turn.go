@@ -0,0 +1,65 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TURNServer is a relay used when peers can't reach each other directly, e.g.
+// behind symmetric NATs or firewalls blocking UDP.
+type TURNServer struct {
+	URL        string // turn:host:port or turns:host:port, optionally with ?transport=tcp
+	Username   string
+	Credential string
+}
+
+// validate checks that s is a TURN URL with credentials.
+func (s TURNServer) validate() error {
+	if !strings.HasPrefix(s.URL, "turn:") && !strings.HasPrefix(s.URL, "turns:") {
+		return fmt.Errorf("TURN server %q must start with turn: or turns:", s.URL)
+	}
+	if s.Username == "" || s.Credential == "" {
+		return fmt.Errorf("TURN server %s needs a username and a password", s.URL)
+	}
+	return nil
+}
+
+// NewTURNServers pairs TURN URLs with their credentials. Usernames and passwords
+// are given either once, for all URLs, or once per URL in the same order.
+func NewTURNServers(urls, usernames, passwords []string) ([]TURNServer, error) {
+	if len(urls) == 0 {
+		if len(usernames) > 0 || len(passwords) > 0 {
+			return nil, fmt.Errorf("TURN credentials given without a TURN server")
+		}
+		return nil, nil
+	}
+
+	pick := func(values []string, i int, what string) (string, error) {
+		switch len(values) {
+		case 0:
+			return "", nil
+		case 1:
+			return values[0], nil
+		case len(urls):
+			return values[i], nil
+		}
+		return "", fmt.Errorf("got %d TURN %ss for %d servers, expected 1 or one per server", len(values), what, len(urls))
+	}
+
+	servers := make([]TURNServer, len(urls))
+	for i, url := range urls {
+		username, err := pick(usernames, i, "username")
+		if err != nil {
+			return nil, err
+		}
+		password, err := pick(passwords, i, "password")
+		if err != nil {
+			return nil, err
+		}
+		servers[i] = TURNServer{URL: url, Username: username, Credential: password}
+		if err := servers[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return servers, nil
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+func TestNewTURNServers(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		urls, users, passes []string
+		want                []TURNServer
+		invalid             bool
+	}{
+		{"none", nil, nil, nil, nil, false},
+		{"one", []string{"turn:a.example:3478"}, []string{"user"}, []string{"pass"},
+			[]TURNServer{{"turn:a.example:3478", "user", "pass"}}, false},
+		{"shared credentials", []string{"turn:a.example:3478", "turns:b.example:5349"}, []string{"user"}, []string{"pass"},
+			[]TURNServer{{"turn:a.example:3478", "user", "pass"}, {"turns:b.example:5349", "user", "pass"}}, false},
+		{"credentials per server", []string{"turn:a.example:3478", "turn:b.example:3478?transport=tcp"}, []string{"user-a", "user-b"}, []string{"pass-a", "pass-b"},
+			[]TURNServer{{"turn:a.example:3478", "user-a", "pass-a"}, {"turn:b.example:3478?transport=tcp", "user-b", "pass-b"}}, false},
+		{"shared username, passwords per server", []string{"turn:a.example", "turn:b.example"}, []string{"user"}, []string{"pass-a", "pass-b"},
+			[]TURNServer{{"turn:a.example", "user", "pass-a"}, {"turn:b.example", "user", "pass-b"}}, false},
+		{"missing username", []string{"turn:a.example"}, nil, []string{"pass"}, nil, true},
+		{"missing password", []string{"turn:a.example"}, []string{"user"}, nil, nil, true},
+		{"too few passwords", []string{"turn:a.example", "turn:b.example", "turn:c.example"}, []string{"user"}, []string{"pass-a", "pass-b"}, nil, true},
+		{"not a TURN URL", []string{"stun:a.example"}, []string{"user"}, []string{"pass"}, nil, true},
+		{"credentials without a server", nil, []string{"user"}, []string{"pass"}, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewTURNServers(tc.urls, tc.users, tc.passes)
+			if tc.invalid {
+				if err == nil {
+					t.Fatalf("accepted, returning %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("returned %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWebRTCConfigTURN(t *testing.T) {
+	a, _ := newTestApp(t)
+	a.STUNServers = []string{"stun:stun.example:3478"}
+	a.TURNServers = []TURNServer{
+		{"turn:a.example:3478", "user-a", "pass-a"},
+		{"turns:b.example:5349", "user-b", "pass-b"},
+	}
+
+	want := []webrtc.ICEServer{
+		{URLs: []string{"stun:stun.example:3478"}},
+		{URLs: []string{"turn:a.example:3478"}, Username: "user-a", Credential: "pass-a", CredentialType: webrtc.ICECredentialTypePassword},
+		{URLs: []string{"turns:b.example:5349"}, Username: "user-b", Credential: "pass-b", CredentialType: webrtc.ICECredentialTypePassword},
+	}
+	if got := a.webRTCConfig().ICEServers; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ICE servers %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+package clipboard
+
+import (
+	"context"
+
+	"golang.design/x/clipboard"
+)
+
+// Backend is a clipboard the Manager reads, writes and watches.
+type Backend interface {
+	// Init prepares the backend for use. It may be called more than once.
+	Init() error
+	// Read returns the content in format, or nil if there is none.
+	Read(format Format) []byte
+	// Write replaces the clipboard with content in format.
+	Write(format Format, content []byte)
+	// Watch emits the content in format each time it changes, until ctx is done.
+	Watch(ctx context.Context, format Format) <-chan []byte
+}
+
+// System is the system clipboard (CTRL+C / CTRL+V) through golang.design/x/clipboard.
+// It is the default Backend.
+var System Backend = systemBackend{}
+
+type systemBackend struct{}
+
+// Init initializes the system clipboard. The library is process-wide and shared
+// by all Managers, so calling Init from several of them is safe.
+func (systemBackend) Init() error { return clipboard.Init() }
+
+func (systemBackend) Read(format Format) []byte { return clipboard.Read(format) }
+
+func (systemBackend) Write(format Format, content []byte) { clipboard.Write(format, content) }
+
+func (systemBackend) Watch(ctx context.Context, format Format) <-chan []byte {
+	return clipboard.Watch(ctx, format)
+}
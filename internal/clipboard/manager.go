@@ -4,57 +4,372 @@
 package clipboard
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.design/x/clipboard"
 )
 
+// DefaultHistorySize is the number of entries kept by the Manager's history
+// unless HistorySize says otherwise.
+const DefaultHistorySize = 20
+
+// Format is the kind of content on the clipboard.
+type Format = clipboard.Format
+
+// Clipboard formats that can be watched and written.
+const (
+	FmtText  = clipboard.FmtText  // UTF-8 text
+	FmtImage = clipboard.FmtImage // PNG image
+)
+
+// formatSettle is how long WatchFormats holds back a change while watching several
+// formats, in case another one changes too. Copying an image in a browser often
+// sets both text (the URL) and the image; only the image is reported then.
+const formatSettle = 250 * time.Millisecond
+
+// echoTTL is how long a write by WriteSafely is remembered for echo cancellation.
+// The watcher polls every second, so its echo normally arrives well within it.
+const echoTTL = 5 * time.Second
+
+// Update is a change of the clipboard seen by Watch.
+type Update struct {
+	Format  Format
+	Content []byte
+}
+
+// HistoryEntry is a clipboard entry kept in the Manager's history.
+type HistoryEntry struct {
+	Format  Format
+	Content []byte
+	Time    time.Time
+}
+
 // Manager handles the local clipboard state and prevents infinite echo loops.
 type Manager struct {
-	lastContent string
-	mu          sync.Mutex
+	// Backend is the clipboard to sync, System when nil.
+	Backend Backend
+
+	// Images makes Watch report copied images as well as text.
+	Images bool
+
+	// HistorySize is the number of entries kept by History, DefaultHistorySize when zero.
+	HistorySize int
+
+	// MaxBytes, when positive, makes Watch drop copies larger than this, so a
+	// huge copy never reaches the network.
+	MaxBytes int
+
+	// Logger receives the Manager's log events, slog.Default() when nil.
+	Logger *slog.Logger
+
+	paused    atomic.Bool
+	stopClear func() bool                     // Cancels the pending clear of the last WriteSafelyWithTTL
+	writeGen  uint64                          // Incremented by every write
+	written   map[[sha256.Size]byte]time.Time // Hashes of recent WriteSafely content, by write time
+	history   []HistoryEntry                  // Oldest first, at most HistorySize entries
+	mu        sync.Mutex
+
+	// afterFunc schedules the clears of WriteSafelyWithTTL, like time.AfterFunc
+	// when nil. Tests replace it with a fake clock.
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
 }
 
 // NewManager creates a thread-safe clipboard manager.
 func NewManager() *Manager {
-	return &Manager{}
+	return &Manager{written: make(map[[sha256.Size]byte]time.Time)}
 }
 
-// Init initializes the system clipboard.
+// Init initializes the backend.
 func (m *Manager) Init() error {
-	return clipboard.Init()
+	return m.backend().Init()
+}
+
+// logger returns the logger for the Manager's events.
+func (m *Manager) logger() *slog.Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return slog.Default()
+}
+
+// backend returns Backend, or System when it is unset.
+func (m *Manager) backend() Backend {
+	if m.Backend != nil {
+		return m.Backend
+	}
+	return System
+}
+
+// Watch returns a channel that emits an update whenever the user copies text, or
+// an image if Images is set. The channel is closed once ctx is done or the
+// clipboard backend stops.
+func (m *Manager) Watch(ctx context.Context) <-chan Update {
+	if m.Images {
+		return m.WatchFormats(ctx, FmtImage, FmtText)
+	}
+	return m.WatchFormats(ctx, FmtText)
+}
+
+// WatchFormats watches each of formats and merges their changes into one channel.
+// When several formats change within formatSettle of each other, as when an
+// application copies an item in several formats at once, only the first of them
+// in formats is reported. The channel is closed, and all watchers stopped, once
+// ctx is done; it is also closed if every watcher stops on its own.
+func (m *Manager) WatchFormats(ctx context.Context, formats ...Format) <-chan Update {
+	sources := make([]<-chan []byte, len(formats))
+	for i, format := range formats {
+		sources[i] = m.backend().Watch(ctx, format)
+	}
+	return m.merge(ctx, formats, sources)
+}
+
+// merge implements WatchFormats on the update channels of each format.
+func (m *Manager) merge(ctx context.Context, formats []Format, sources []<-chan []byte) <-chan Update {
+	type change struct {
+		rank int // Index in formats, lower wins
+		Update
+	}
+
+	// Forward every source into one channel, closed once all of them are
+	in := make(chan change)
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for data := range source {
+				if m.tooLarge(data) {
+					continue
+				}
+				select {
+				case in <- change{rank: i, Update: Update{Format: formats[i], Content: data}}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(in)
+	}()
+
+	out := make(chan Update)
+	go func() {
+		defer close(out)
+
+		emit := func(update Update) bool {
+			if m.paused.Load() {
+				return true // Dropped, and kept out of the history
+			}
+			m.Remember(update.Format, update.Content)
+			select {
+			case out <- update:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var pending *change
+		var settle <-chan time.Time
+		for {
+			select {
+			case c, ok := <-in:
+				if !ok {
+					return
+				}
+				if len(sources) == 1 {
+					if !emit(c.Update) {
+						return
+					}
+					continue
+				}
+				if pending == nil || c.rank <= pending.rank {
+					pending = &c
+				}
+				if settle == nil {
+					settle = time.After(formatSettle)
+				}
+			case <-settle:
+				if !emit(pending.Update) {
+					return
+				}
+				pending, settle = nil, nil
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
 }
 
-// Watch returns a channel that emits text whenever the user copies text data.
-func (m *Manager) Watch(ctx context.Context) <-chan []byte {
-	return clipboard.Watch(ctx, clipboard.FmtText)
+// Pause stops watchers from reporting copies until Resume, e.g. while copying a
+// password that shouldn't be synced. Copies made while paused are never reported.
+func (m *Manager) Pause() {
+	m.paused.Store(true)
 }
 
-// WriteSafely writes to the system clipboard and updates the internal state
-// so that the Watcher knows to ignore the specific update (Echo cancellation).
-func (m *Manager) WriteSafely(content []byte) {
-	text := string(content)
+// Resume undoes Pause.
+func (m *Manager) Resume() {
+	m.paused.Store(false)
+}
 
+// Paused reports whether the Manager is paused.
+func (m *Manager) Paused() bool {
+	return m.paused.Load()
+}
+
+// TooLarge reports whether data exceeds MaxBytes. Content read outside of
+// Watch must be checked with it before being sent.
+func (m *Manager) TooLarge(data []byte) bool {
+	return m.MaxBytes > 0 && len(data) > m.MaxBytes
+}
+
+// tooLarge reports, with a warning, whether a copy exceeds MaxBytes.
+func (m *Manager) tooLarge(data []byte) bool {
+	if !m.TooLarge(data) {
+		return false
+	}
+	m.logger().Warn("Not syncing a copy over the size limit", "bytes", len(data), "limit", m.MaxBytes)
+	return true
+}
+
+// Read returns the current text on the clipboard.
+func (m *Manager) Read() []byte {
+	return m.backend().Read(FmtText)
+}
+
+// WriteSafely writes content in the given format to the clipboard and
+// remembers it so that the Watcher knows to ignore the resulting update (Echo
+// cancellation).
+func (m *Manager) WriteSafely(format Format, content []byte) {
+	m.WriteSafelyWithTTL(format, content, 0)
+}
+
+// WriteSafelyWithTTL is like WriteSafely, then clears the clipboard after ttl
+// unless its content changed meanwhile. A later write cancels the pending clear.
+// A ttl of zero never clears.
+func (m *Manager) WriteSafelyWithTTL(format Format, content []byte, ttl time.Duration) {
 	m.mu.Lock()
-	m.lastContent = text
+	m.expectEcho(content)
+	m.remember(format, content)
+	if m.stopClear != nil {
+		m.stopClear()
+		m.stopClear = nil
+	}
+	m.writeGen++
+	if ttl > 0 {
+		gen := m.writeGen
+		m.stopClear = m.schedule(ttl, func() { m.clear(gen, format, content) })
+	}
 	m.mu.Unlock()
 
-	clipboard.Write(clipboard.FmtText, content)
+	m.backend().Write(format, content)
 }
 
-// ShouldIgnore checks if the given text matches the last thing we wrote programmatically.
-// If it matches, it means the "change" event was triggered by us, and it should be ignored.
+// schedule runs f after d, and returns a function cancelling it.
+func (m *Manager) schedule(d time.Duration, f func()) func() bool {
+	if m.afterFunc != nil {
+		return m.afterFunc(d, f)
+	}
+	return time.AfterFunc(d, f).Stop
+}
+
+// clear empties the clipboard for write number gen, if it is still the latest
+// write and the clipboard still holds its content. The empty content is written
+// in the format of the write, so an image is replaced rather than left behind.
+func (m *Manager) clear(gen uint64, format Format, content []byte) {
+	m.mu.Lock()
+	if m.writeGen != gen {
+		m.mu.Unlock()
+		return
+	}
+	m.stopClear = nil
+	m.mu.Unlock()
+
+	if !bytes.Equal(m.backend().Read(format), content) {
+		return
+	}
+	m.mu.Lock()
+	m.expectEcho(nil)
+	m.mu.Unlock()
+	m.backend().Write(format, []byte{})
+}
+
+// expectEcho records content as written, so ShouldIgnore drops its echo.
+// Must be called with m.mu held.
+func (m *Manager) expectEcho(content []byte) {
+	now := time.Now()
+	for hash, at := range m.written {
+		if now.Sub(at) > echoTTL {
+			delete(m.written, hash)
+		}
+	}
+	m.written[sha256.Sum256(content)] = now
+}
+
+// ShouldIgnore reports whether a watched update is the echo of content recently
+// written by WriteSafely. Each write cancels one echo, so a later genuine copy of
+// the same content is synced again. Local copies never change the state, so a
+// copy interleaved with remote writes is neither dropped nor mistaken for an echo.
 func (m *Manager) ShouldIgnore(content []byte) bool {
-	text := string(content)
+	hash := sha256.Sum256(content)
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if text == m.lastContent {
-		return true
+	at, ok := m.written[hash]
+	if !ok {
+		return false
 	}
+	// Writes up to this one were overwritten by it, their echoes can't come anymore
+	for other, otherAt := range m.written {
+		if !otherAt.After(at) {
+			delete(m.written, other)
+		}
+	}
+	return time.Since(at) <= echoTTL
+}
 
-	m.lastContent = text
-	return false
+// Remember records content in the history without writing it to the clipboard.
+// Local copies and WriteSafely are recorded automatically. Content identical to
+// the newest entry only refreshes its time, so the history holds distinct items.
+func (m *Manager) Remember(format Format, content []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remember(format, content)
+}
+
+// remember is Remember with m.mu held.
+func (m *Manager) remember(format Format, content []byte) {
+	if n := len(m.history); n > 0 {
+		if last := &m.history[n-1]; last.Format == format && bytes.Equal(last.Content, content) {
+			last.Time = time.Now()
+			return
+		}
+	}
+
+	size := m.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+	if len(m.history) >= size {
+		m.history = slices.Delete(m.history, 0, len(m.history)-size+1)
+	}
+	m.history = append(m.history, HistoryEntry{Format: format, Content: content, Time: time.Now()})
+}
+
+// History returns a copy of the remembered entries, oldest first.
+func (m *Manager) History() []HistoryEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]HistoryEntry(nil), m.history...)
 }
@@ -0,0 +1,547 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// quiet is how long a test waits to conclude that no update is coming.
+const quiet = 50 * time.Millisecond
+
+// newTestManager returns a Manager on a MemoryBackend, watching text until the
+// test ends.
+func newTestManager(t *testing.T) (*Manager, *MemoryBackend, <-chan Update) {
+	t.Helper()
+	backend := NewMemoryBackend()
+	m := NewManager()
+	m.Backend = backend
+	if err := m.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return m, backend, m.Watch(ctx)
+}
+
+// next returns the next update from updates, failing the test if none comes.
+func next(t *testing.T, updates <-chan Update) Update {
+	t.Helper()
+	select {
+	case update := <-updates:
+		return update
+	case <-time.After(time.Second):
+		t.Fatal("no update from the watcher")
+		return Update{}
+	}
+}
+
+// none fails the test if updates emits anything within quiet.
+func none(t *testing.T, updates <-chan Update) {
+	t.Helper()
+	select {
+	case update := <-updates:
+		t.Fatalf("unexpected update %q", update.Content)
+	case <-time.After(quiet):
+	}
+}
+
+func TestManagerWatchEchoCycle(t *testing.T) {
+	m, backend, updates := newTestManager(t)
+
+	// A local copy is reported and not mistaken for an echo
+	backend.Copy(FmtText, []byte("local"))
+	update := next(t, updates)
+	if update.Format != FmtText || string(update.Content) != "local" {
+		t.Fatalf("got %v %q, want text %q", update.Format, update.Content, "local")
+	}
+	if m.ShouldIgnore(update.Content) {
+		t.Fatal("a local copy was ignored as an echo")
+	}
+
+	// A remote write reaches the clipboard, and its echo is ignored
+	m.WriteSafely(FmtText, []byte("remote"))
+	if writes := backend.Writes(); len(writes) != 1 || string(writes[0].Content) != "remote" {
+		t.Fatalf("backend writes %v, want one write of %q", writes, "remote")
+	}
+	if got := m.Read(); string(got) != "remote" {
+		t.Fatalf("Read returned %q, want %q", got, "remote")
+	}
+	if echo := next(t, updates); !m.ShouldIgnore(echo.Content) {
+		t.Fatalf("the echo of a remote write, %q, was not ignored", echo.Content)
+	}
+
+	// Copying the same content again after another copy is a genuine copy
+	backend.Copy(FmtText, []byte("other"))
+	if update := next(t, updates); m.ShouldIgnore(update.Content) {
+		t.Fatal("a local copy was ignored as an echo")
+	}
+	backend.Copy(FmtText, []byte("remote"))
+	if update := next(t, updates); m.ShouldIgnore(update.Content) {
+		t.Fatal("a later copy of remotely written content was ignored")
+	}
+}
+
+func TestManagerMaxBytes(t *testing.T) {
+	m, backend, updates := newTestManager(t)
+	m.MaxBytes = 4
+	var logs bytes.Buffer
+	m.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	backend.Copy(FmtText, []byte("too large"))
+	none(t, updates)
+
+	backend.Copy(FmtText, []byte("fits"))
+	if update := next(t, updates); string(update.Content) != "fits" {
+		t.Fatalf("got %q, want %q", update.Content, "fits")
+	}
+	// The watcher warned before passing the next update on
+	if !strings.Contains(logs.String(), "over the size limit") {
+		t.Fatalf("no warning in the Manager's logger, got %q", logs.String())
+	}
+	if !m.TooLarge([]byte("too large")) || m.TooLarge([]byte("fits")) {
+		t.Fatal("TooLarge disagrees with MaxBytes")
+	}
+}
+
+func TestManagerPause(t *testing.T) {
+	m, backend, updates := newTestManager(t)
+
+	m.Pause()
+	if !m.Paused() {
+		t.Fatal("Paused is false after Pause")
+	}
+	backend.Copy(FmtText, []byte("password"))
+	none(t, updates)
+	for _, entry := range m.History() {
+		if bytes.Equal(entry.Content, []byte("password")) {
+			t.Fatal("a copy made while paused is in the history")
+		}
+	}
+
+	m.Resume()
+	if m.Paused() {
+		t.Fatal("Paused is true after Resume")
+	}
+	backend.Copy(FmtText, []byte("public"))
+	if update := next(t, updates); string(update.Content) != "public" {
+		t.Fatalf("got %q after Resume, want %q", update.Content, "public")
+	}
+}
+
+func TestManagerWatchFormats(t *testing.T) {
+	m := NewManager()
+	m.Backend = NewMemoryBackend()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	image, text := make(chan []byte), make(chan []byte)
+	defer close(image)
+	defer close(text)
+	updates := m.merge(ctx, []Format{FmtImage, FmtText}, []<-chan []byte{image, text})
+
+	// Copied together, as by a browser: only the format listed first is reported
+	text <- []byte("https://example.com/cat.png")
+	image <- []byte("png")
+	if update := next(t, updates); update.Format != FmtImage || string(update.Content) != "png" {
+		t.Fatalf("got %v %q, want the image", update.Format, update.Content)
+	}
+	none(t, updates)
+
+	// A format listed later is reported when it changes on its own
+	text <- []byte("hello")
+	if update := next(t, updates); update.Format != FmtText || string(update.Content) != "hello" {
+		t.Fatalf("got %v %q, want the text", update.Format, update.Content)
+	}
+
+	// The channel is closed once ctx is done, even with the sources still open
+	cancel()
+	select {
+	case update, ok := <-updates:
+		if ok {
+			t.Fatalf("unexpected update %q after ctx was done", update.Content)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the channel wasn't closed after ctx was done")
+	}
+}
+
+func TestManagerWatchFormatsSourcesClosed(t *testing.T) {
+	m := NewManager()
+	m.Backend = NewMemoryBackend()
+	image, text := make(chan []byte), make(chan []byte)
+	updates := m.merge(t.Context(), []Format{FmtImage, FmtText}, []<-chan []byte{image, text})
+
+	close(image)
+	close(text)
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("unexpected update from closed sources")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the channel wasn't closed after every source stopped")
+	}
+}
+
+// forward reads the updates of a Manager like the client does: echoes are ignored,
+// everything else is passed to send.
+func forward(m *Manager, updates <-chan Update, send func([]byte)) {
+	for update := range updates {
+		if !m.ShouldIgnore(update.Content) {
+			send(update.Content)
+		}
+	}
+}
+
+func TestManagerAlternatingRemoteWritesAndCopies(t *testing.T) {
+	m, backend, updates := newTestManager(t)
+	sent := make(chan []byte, 1)
+	go forward(m, updates, func(content []byte) { sent <- content })
+
+	for i := range 200 {
+		m.WriteSafely(FmtText, fmt.Appendf(nil, "remote %d", i))
+		backend.Copy(FmtText, fmt.Appendf(nil, "local %d", i))
+
+		select {
+		case got := <-sent:
+			if want := fmt.Sprintf("local %d", i); string(got) != want {
+				t.Fatalf("sent %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("local copy %d was dropped", i)
+		}
+	}
+	select {
+	case got := <-sent:
+		t.Fatalf("sent %q after the last copy", got)
+	case <-time.After(quiet):
+	}
+}
+
+// copyingBackend is a MemoryBackend on which the user copies something as soon
+// as each Write lands, before the Manager has seen its echo.
+type copyingBackend struct {
+	*MemoryBackend
+	copy func(written []byte) []byte
+}
+
+func (b copyingBackend) Write(format Format, content []byte) {
+	b.MemoryBackend.Write(format, content)
+	b.Copy(FmtText, b.copy(content))
+}
+
+func TestManagerCopyDuringRemoteWrite(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		copy func(i int) string // What the user copies during remote write i
+	}{
+		{"new content", func(i int) string { return fmt.Sprintf("local %d", i) }},
+		// The legacy client dropped a copy equal to an earlier remote value
+		{"earlier remote value", func(i int) string { return fmt.Sprintf("remote %d", i-1) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			memory := NewMemoryBackend()
+			var i int
+			m := NewManager()
+			m.Backend = copyingBackend{memory, func([]byte) []byte { return []byte(tc.copy(i)) }}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sent := make(chan []byte, 1)
+			go forward(m, m.Watch(ctx), func(content []byte) { sent <- content })
+
+			for i = range 100 {
+				m.WriteSafely(FmtText, fmt.Appendf(nil, "remote %d", i))
+				select {
+				case got := <-sent:
+					if want := tc.copy(i); string(got) != want {
+						t.Fatalf("sent %q, want the copy %q", got, want)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("copy %q made during a remote write was lost", tc.copy(i))
+				}
+			}
+			select {
+			case got := <-sent:
+				t.Fatalf("sent %q after the last copy, a remote write echoed", got)
+			case <-time.After(quiet):
+			}
+		})
+	}
+}
+
+func TestManagerNoEchoLoop(t *testing.T) {
+	// Two Managers synced to each other like two peers
+	a, backendA, updatesA := newTestManager(t)
+	b, backendB, updatesB := newTestManager(t)
+	var sends atomic.Int32
+	go forward(a, updatesA, func(content []byte) {
+		sends.Add(1)
+		b.WriteSafely(FmtText, content)
+	})
+	go forward(b, updatesB, func(content []byte) {
+		sends.Add(1)
+		a.WriteSafely(FmtText, content)
+	})
+
+	for i := range 50 {
+		backendA.Copy(FmtText, fmt.Appendf(nil, "from a %d", i))
+		backendB.Copy(FmtText, fmt.Appendf(nil, "from b %d", i))
+	}
+	// Let the watchers drain, a full one drops changes like a polling watcher
+	time.Sleep(quiet)
+	backendA.Copy(FmtText, []byte("last"))
+
+	deadline := time.Now().Add(time.Second)
+	for !bytes.Equal(backendB.Read(FmtText), []byte("last")) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the last copy never reached b, it holds %q", backendB.Read(FmtText))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	settled := sends.Load()
+	time.Sleep(10 * quiet)
+	if n := sends.Load(); n != settled {
+		t.Fatalf("%d more sends after the copies stopped, the managers echo each other", n-settled)
+	}
+	if n := sends.Load(); n > 101 {
+		t.Fatalf("%d sends for 101 copies", n)
+	}
+}
+
+func TestManagerHistoryEviction(t *testing.T) {
+	m := NewManager()
+	m.Backend = NewMemoryBackend()
+	m.HistorySize = 3
+
+	for i := range 5 {
+		m.Remember(FmtText, fmt.Appendf(nil, "item %d", i))
+	}
+	history := m.History()
+	if len(history) != 3 {
+		t.Fatalf("history holds %d entries, want 3", len(history))
+	}
+	for i, entry := range history {
+		if want := fmt.Sprintf("item %d", i+2); string(entry.Content) != want {
+			t.Errorf("entry %d is %q, want %q", i, entry.Content, want)
+		}
+	}
+}
+
+func TestManagerHistoryDedup(t *testing.T) {
+	m := NewManager()
+	m.Backend = NewMemoryBackend()
+
+	m.Remember(FmtText, []byte("a"))
+	first := m.History()[0].Time
+	m.Remember(FmtText, []byte("a"))
+	m.WriteSafely(FmtText, []byte("a"))
+	history := m.History()
+	if len(history) != 1 {
+		t.Fatalf("history holds %d entries after identical ones, want 1", len(history))
+	}
+	if history[0].Time.Before(first) {
+		t.Fatal("an identical entry didn't refresh the time")
+	}
+
+	// Only consecutive duplicates are merged, and formats are told apart
+	m.Remember(FmtImage, []byte("a"))
+	m.Remember(FmtText, []byte("b"))
+	m.Remember(FmtText, []byte("a"))
+	var got []string
+	for _, entry := range m.History() {
+		got = append(got, fmt.Sprintf("%v:%s", entry.Format, entry.Content))
+	}
+	want := []string{
+		fmt.Sprintf("%v:a", FmtText),
+		fmt.Sprintf("%v:a", FmtImage),
+		fmt.Sprintf("%v:b", FmtText),
+		fmt.Sprintf("%v:a", FmtText),
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("history is %v, want %v", got, want)
+	}
+}
+
+func TestManagerHistoryConcurrent(t *testing.T) {
+	m, backend, updates := newTestManager(t)
+	m.HistorySize = 8
+	go forward(m, updates, func([]byte) {})
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				m.WriteSafely(FmtText, fmt.Appendf(nil, "remote %d-%d", i, j))
+				backend.Copy(FmtText, fmt.Appendf(nil, "local %d-%d", i, j))
+				if n := len(m.History()); n > m.HistorySize {
+					t.Errorf("history holds %d entries, more than %d", n, m.HistorySize)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// fakeClock stands in for the timers of a Manager, firing them on Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Duration
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Duration
+	f       func()
+	stopped bool
+}
+
+// install makes m schedule its clears on c.
+func (c *fakeClock) install(m *Manager) {
+	m.afterFunc = func(d time.Duration, f func()) func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		timer := &fakeTimer{at: c.now + d, f: f}
+		c.timers = append(c.timers, timer)
+		return func() bool {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			stopped := timer.stopped
+			timer.stopped = true
+			return !stopped
+		}
+	}
+}
+
+// Advance moves the clock forward by d and runs the timers due by then.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now += d
+	var due []func()
+	for _, timer := range c.timers {
+		if !timer.stopped && timer.at <= c.now {
+			timer.stopped = true
+			due = append(due, timer.f)
+		}
+	}
+	c.mu.Unlock()
+	for _, f := range due {
+		f()
+	}
+}
+
+func TestManagerWriteSafelyWithTTL(t *testing.T) {
+	const ttl = time.Minute
+	for _, tc := range []struct {
+		name    string
+		format  Format
+		between func(m *Manager, backend *MemoryBackend) // Runs after the write, before the clock moves
+		advance time.Duration
+		want    Update // Left on the clipboard
+		writes  int
+	}{
+		{"cleared after ttl", FmtText, nil, ttl, Update{FmtText, nil}, 2},
+		{"image cleared", FmtImage, nil, ttl, Update{FmtImage, nil}, 2},
+		{"not before ttl", FmtText, nil, ttl - time.Second, Update{FmtText, []byte("secret")}, 1},
+		{"copied something else", FmtText, func(m *Manager, backend *MemoryBackend) {
+			backend.Copy(FmtText, []byte("other"))
+		}, ttl, Update{FmtText, []byte("other")}, 1},
+		{"copied an image", FmtText, func(m *Manager, backend *MemoryBackend) {
+			backend.Copy(FmtImage, []byte("png"))
+		}, ttl, Update{FmtImage, []byte("png")}, 1},
+		{"newer write", FmtText, func(m *Manager, backend *MemoryBackend) {
+			m.WriteSafely(FmtText, []byte("newer"))
+		}, ttl, Update{FmtText, []byte("newer")}, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := NewMemoryBackend()
+			m := NewManager()
+			m.Backend = backend
+			var clock fakeClock
+			clock.install(m)
+
+			content := []byte("secret")
+			if tc.format == FmtImage {
+				content = []byte("\x89PNG secret")
+			}
+			m.WriteSafelyWithTTL(tc.format, content, ttl)
+			if tc.between != nil {
+				tc.between(m, backend)
+			}
+			clock.Advance(tc.advance)
+
+			if got := backend.Read(tc.want.Format); !bytes.Equal(got, tc.want.Content) {
+				t.Errorf("clipboard holds %q, want %q", got, tc.want.Content)
+			}
+			writes := backend.Writes()
+			if len(writes) != tc.writes {
+				t.Fatalf("%d writes, want %d", len(writes), tc.writes)
+			}
+			if last := writes[len(writes)-1]; tc.writes == 2 && len(last.Content) == 0 && last.Format != tc.format {
+				t.Fatalf("cleared format %v, want %v", last.Format, tc.format)
+			}
+		})
+	}
+}
+
+func TestManagerShouldIgnoreHash(t *testing.T) {
+	content := bytes.Repeat([]byte("clipboard "), 100<<10)
+	for _, tc := range []struct {
+		name   string
+		flip   int // Index of the byte changed in the update, -1 for none
+		ignore bool
+	}{
+		{"equal", -1, true},
+		{"first byte differs", 0, false},
+		{"middle byte differs", len(content) / 2, false},
+		{"last byte differs", len(content) - 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewManager()
+			m.Backend = NewMemoryBackend()
+			m.WriteSafely(FmtText, content)
+
+			update := bytes.Clone(content)
+			if tc.flip >= 0 {
+				update[tc.flip] ^= 1
+			}
+			if got := m.ShouldIgnore(update); got != tc.ignore {
+				t.Fatalf("ShouldIgnore returned %v, want %v", got, tc.ignore)
+			}
+		})
+	}
+}
+
+func TestManagerShouldIgnoreAllocs(t *testing.T) {
+	m := NewManager()
+	m.Backend = NewMemoryBackend()
+	m.WriteSafely(FmtText, bytes.Repeat([]byte("x"), 4<<20))
+	other := bytes.Repeat([]byte("y"), 4<<20)
+
+	if allocs := testing.AllocsPerRun(10, func() { m.ShouldIgnore(other) }); allocs != 0 {
+		t.Fatalf("ShouldIgnore of a 4MB update allocates %v times, want none", allocs)
+	}
+}
+
+func BenchmarkShouldIgnore(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 4 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			m := NewManager()
+			m.Backend = NewMemoryBackend()
+			m.WriteSafely(FmtText, bytes.Repeat([]byte("x"), size))
+			other := bytes.Repeat([]byte("y"), size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for b.Loop() {
+				m.ShouldIgnore(other)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sync"
+)
+
+// memoryWatchBuffer is how many changes a MemoryBackend watcher holds before
+// dropping new ones, like a polling watcher missing intermediate changes.
+const memoryWatchBuffer = 16
+
+// MemoryBackend is an in-memory clipboard, for running without a display (e.g.
+// in CI) and for exercising the Manager deterministically. Copy simulates the
+// user copying something; Writes lists what was written through the Backend.
+type MemoryBackend struct {
+	mu       sync.Mutex
+	content  map[Format][]byte
+	watchers map[Format][]chan []byte
+	writes   []Update
+}
+
+// NewMemoryBackend returns an empty in-memory clipboard.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		content:  make(map[Format][]byte),
+		watchers: make(map[Format][]chan []byte),
+	}
+}
+
+func (b *MemoryBackend) Init() error { return nil }
+
+func (b *MemoryBackend) Read(format Format) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.content[format])
+}
+
+func (b *MemoryBackend) Write(format Format, content []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writes = append(b.writes, Update{Format: format, Content: slices.Clone(content)})
+	b.set(format, content)
+}
+
+// Copy replaces the clipboard with content as if the user had copied it, so
+// watchers see the change but it isn't listed in Writes.
+func (b *MemoryBackend) Copy(format Format, content []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.set(format, content)
+}
+
+// Writes returns everything written through Write, oldest first.
+func (b *MemoryBackend) Writes() []Update {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.writes)
+}
+
+// set replaces the clipboard, which holds one format at a time, and notifies the
+// watchers of format if it changed. Must be called with b.mu held.
+func (b *MemoryBackend) set(format Format, content []byte) {
+	changed := !bytes.Equal(b.content[format], content)
+	clear(b.content)
+	b.content[format] = slices.Clone(content)
+	if !changed || len(content) == 0 {
+		return
+	}
+	for _, watcher := range b.watchers[format] {
+		select {
+		case watcher <- slices.Clone(content):
+		default:
+		}
+	}
+}
+
+func (b *MemoryBackend) Watch(ctx context.Context, format Format) <-chan []byte {
+	watcher := make(chan []byte, memoryWatchBuffer)
+
+	b.mu.Lock()
+	b.watchers[format] = append(b.watchers[format], watcher)
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.watchers[format] = slices.DeleteFunc(b.watchers[format], func(w chan []byte) bool { return w == watcher })
+		close(watcher)
+	}()
+	return watcher
+}
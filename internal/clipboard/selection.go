@@ -0,0 +1,106 @@
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// selectionPoll is how often the primary selection is polled for changes, the
+// same rate as the system clipboard watcher.
+const selectionPoll = time.Second
+
+// Primary is the X11/Wayland primary selection (select to copy, middle-click to
+// paste), which golang.design/x/clipboard doesn't expose. It runs wl-paste and
+// wl-copy on Wayland, and xclip on X11; one of them must be installed.
+var Primary Backend = &commandBackend{selection: "primary"}
+
+// commandBackend reads and writes a selection with the wl-clipboard or xclip tools.
+type commandBackend struct {
+	selection string
+	wayland   atomic.Bool // Use wl-clipboard rather than xclip; Init may run again while watching
+}
+
+func (b *commandBackend) Init() error {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-paste"); err == nil {
+			b.wayland.Store(true)
+			return nil
+		}
+	}
+	b.wayland.Store(false)
+	if _, err := exec.LookPath("xclip"); err != nil {
+		return errors.New("the " + b.selection + " selection needs wl-clipboard (Wayland) or xclip (X11) to be installed")
+	}
+	return nil
+}
+
+// mimeType is the target requested from the selection for format.
+func mimeType(format Format) string {
+	if format == FmtImage {
+		return "image/png"
+	}
+	return "text/plain;charset=utf-8"
+}
+
+func (b *commandBackend) Read(format Format) []byte {
+	var cmd *exec.Cmd
+	if b.wayland.Load() {
+		cmd = exec.Command("wl-paste", "--"+b.selection, "--no-newline", "--type", mimeType(format))
+	} else {
+		cmd = exec.Command("xclip", "-selection", b.selection, "-target", mimeType(format), "-out")
+	}
+	// Both tools fail when the selection is empty or lacks the format
+	content, err := cmd.Output()
+	if err != nil || len(content) == 0 {
+		return nil
+	}
+	return content
+}
+
+func (b *commandBackend) Write(format Format, content []byte) {
+	var cmd *exec.Cmd
+	if b.wayland.Load() {
+		cmd = exec.Command("wl-copy", "--"+b.selection, "--type", mimeType(format))
+	} else {
+		cmd = exec.Command("xclip", "-selection", b.selection, "-target", mimeType(format), "-in")
+	}
+	// Both tools fork to keep serving the selection, Run returns once the parent exits
+	cmd.Stdin = bytes.NewReader(content)
+	if err := cmd.Run(); err != nil {
+		slog.Error("Failed to write the selection", "selection", b.selection, "err", err)
+	}
+}
+
+func (b *commandBackend) Watch(ctx context.Context, format Format) <-chan []byte {
+	updates := make(chan []byte, 1)
+	last := b.Read(format)
+	go func() {
+		defer close(updates)
+		ticker := time.NewTicker(selectionPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			content := b.Read(format)
+			if content == nil || bytes.Equal(content, last) {
+				continue
+			}
+			last = content
+			select {
+			case updates <- content:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
@@ -0,0 +1,60 @@
+package clipboard
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// fakeWlPaste puts a wl-paste printing content on PATH and pretends to run
+// under Wayland.
+func fakeWlPaste(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s' '" + content + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "wl-paste"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv("WAYLAND_DISPLAY", "wayland-test")
+}
+
+func TestCommandBackendWayland(t *testing.T) {
+	fakeWlPaste(t, "selected")
+	b := &commandBackend{selection: "primary"}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Read(FmtText); string(got) != "selected" {
+		t.Fatalf("Read returned %q, want %q", got, "selected")
+	}
+}
+
+// TestCommandBackendReinit re-initializes the backend while it is read and
+// watched, as clipboard recovery does; run with -race.
+func TestCommandBackendReinit(t *testing.T) {
+	fakeWlPaste(t, "selected")
+	b := &commandBackend{selection: "primary"}
+	if err := b.Init(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b.Watch(ctx, FmtText)
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			b.Init()
+		}()
+		go func() {
+			defer wg.Done()
+			b.Read(FmtText)
+		}()
+	}
+	wg.Wait()
+}
@@ -1,14 +1,24 @@
 // Package crypto implements the security layer for the clipboard synchronization usecase.
-// It uses AES-256-GCM for authenticated encryption and SHA-256 for key derivation
+// It uses AES-256-GCM or ChaCha20-Poly1305 for authenticated encryption and SHA-256
+// for key derivation
 package crypto
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // DeriveKey turns a string password into a 32-byte key using SHA-256
@@ -17,48 +27,344 @@ func DeriveKey(password string) []byte {
 	return hash[:]
 }
 
-// Encrypt encrypts data using AES-GCM
-// It returns a byte slice containing [Nonce (12b)] + [Ciphertext]
-func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+// DeriveSubkeys derives one key per direction of a connection from master with
+// HKDF-SHA256, so a key compromised in one direction doesn't expose the other.
+// The roles are those of signaling.ShouldInitiate: the initiator seals with
+// sendKey and opens with recvKey, the responder seals with recvKey and opens
+// with sendKey.
+func DeriveSubkeys(master []byte) (sendKey, recvKey []byte) {
+	// HKDF only fails for lengths far above KeySize
+	sendKey, _ = hkdf.Key(sha256.New, master, nil, "clipboard-sync/initiator-to-responder", KeySize)
+	recvKey, _ = hkdf.Key(sha256.New, master, nil, "clipboard-sync/responder-to-initiator", KeySize)
+	return sendKey, recvKey
+}
+
+// RoomID returns an identifier for a room that only peers holding key can compute,
+// so the room name can be hidden from the signaling server. Peers using the same
+// password and room name get the same identifier.
+func RoomID(key []byte, room string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("clipboard-sync/room-id/" + room))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// KeyCommitment returns a commitment to key for challenge, which peers can
+// exchange to check they share a password without revealing it. Use a
+// challenge unique to the sender, so commitments can't be replayed by others.
+func KeyCommitment(key, challenge []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("clipboard-sync/key-commitment/"))
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
+
+// VerifyKeyCommitment reports whether commitment was made by KeyCommitment with
+// the same key and challenge. The comparison takes constant time.
+func VerifyKeyCommitment(key, challenge, commitment []byte) bool {
+	return subtle.ConstantTimeCompare(KeyCommitment(key, challenge), commitment) == 1
+}
+
+// CipherID identifies the AEAD cipher that sealed a message. It is stored in the
+// header of every ciphertext, so the receiver can pick the matching cipher.
+type CipherID byte
+
+const (
+	CipherAESGCM           CipherID = 1 // AES-256-GCM, fastest with AES hardware acceleration
+	CipherChaCha20Poly1305 CipherID = 2 // ChaCha20-Poly1305, faster without it
+)
+
+// Version is the format version of the ciphertexts produced by Encrypt, the
+// only one Decrypt reads.
+const Version byte = 3
+
+var (
+	// ErrUnknownCipher is returned when a ciphertext names a cipher this build doesn't know.
+	ErrUnknownCipher = errors.New("unknown cipher")
+	// ErrUnsupportedVersion is returned when a ciphertext has a format version this build can't read.
+	ErrUnsupportedVersion = errors.New("unsupported ciphertext version")
+	// ErrDecryptAuth is returned when a ciphertext fails authentication: it was
+	// sealed with another key or associated data, or was tampered with.
+	ErrDecryptAuth = errors.New("message authentication failed")
+	// ErrCiphertextTooShort is returned when a ciphertext is too short to be a
+	// message at all, i.e. a malformed frame rather than a wrong key.
+	ErrCiphertextTooShort = errors.New("ciphertext too short")
+)
+
+var cipherNames = map[CipherID]string{
+	CipherAESGCM:           "aes-gcm",
+	CipherChaCha20Poly1305: "chacha20-poly1305",
+}
+
+func (id CipherID) String() string {
+	if name, ok := cipherNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("cipher(%d)", byte(id))
+}
+
+// ParseCipher returns the cipher with the given name ("aes-gcm" or "chacha20-poly1305").
+func ParseCipher(name string) (CipherID, error) {
+	for id, n := range cipherNames {
+		if n == name {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q (want aes-gcm or chacha20-poly1305)", ErrUnknownCipher, name)
+}
+
+// AEAD encrypts and authenticates messages with one cipher and key.
+type AEAD interface {
+	// NonceSize is the length of the nonce at the start of each message.
+	NonceSize() int
+	// Encrypt returns [Nonce] + [Ciphertext], with a fresh random nonce. The
+	// associated data aad is authenticated but not included in the output.
+	Encrypt(plaintext, aad []byte) ([]byte, error)
+	// Decrypt opens a message produced by Encrypt with the same aad.
+	Decrypt(ciphertext, aad []byte) ([]byte, error)
+}
+
+// NewAEAD returns the cipher id keyed with a 32-byte key.
+func NewAEAD(id CipherID, key []byte) (AEAD, error) {
+	return newAEAD(id, key, rand.Reader)
+}
+
+// newAEAD is NewAEAD with the source of nonces given by random.
+func newAEAD(id CipherID, key []byte, random io.Reader) (AEAD, error) {
+	switch id {
+	case CipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		return aead{gcm, random}, nil
+	case CipherChaCha20Poly1305:
+		c, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, err
+		}
+		return aead{c, random}, nil
+	}
+	return nil, fmt.Errorf("%w %d", ErrUnknownCipher, byte(id))
+}
+
+// aead implements AEAD on top of a standard cipher.AEAD.
+type aead struct {
+	cipher.AEAD
+	rand io.Reader // Source of nonces
+}
+
+func (a aead) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	// Create a random nonce value
+	nonce := make([]byte, a.NonceSize())
+	if _, err := io.ReadFull(a.rand, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return a.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (a aead) Decrypt(ciphertext, aad []byte) ([]byte, error) {
+	nonceSize := a.NonceSize()
+	if len(ciphertext) < nonceSize+a.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+
+	// Split nonce and actual ciphertext
+	nonce, actualCiphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	plaintext, err := a.Open(nil, nonce, actualCiphertext, aad)
 	if err != nil {
-		return nil, err
+		return nil, ErrDecryptAuth
 	}
+	return plaintext, nil
+}
+
+// Header flags describing how the plaintext was transformed before sealing.
+const (
+	FlagGzip byte = 1 << iota // Plaintext is gzip-compressed
+)
+
+// MaxDecompressedSize bounds the plaintext Decrypt inflates a compressed message
+// to, so a small malicious message can't exhaust memory.
+const MaxDecompressedSize = 64 << 20
+
+// EncryptOptions configure EncryptWithOptions. The zero value encrypts with
+// AES-256-GCM and no compression, like Encrypt.
+type EncryptOptions struct {
+	Cipher           CipherID // Defaults to CipherAESGCM
+	Compress         bool     // Gzip the plaintext when that makes it smaller
+	CompressionLevel int      // gzip level 1 (fastest) to 9 (smallest); 0 = default
+
+	// AAD is associated data bound to the message: it isn't sent, and
+	// DecryptWithOptions fails unless given the same bytes.
+	AAD []byte
 
-	gcm, err := cipher.NewGCM(block)
+	// KeyID names the key in the header, so a Keyring can find it again.
+	KeyID byte
+
+	// Rand is the source of nonces, crypto/rand when nil. Only meant for
+	// deterministic output in tests or a custom nonce scheme; nonces must
+	// never repeat under one key.
+	Rand io.Reader
+}
+
+// Encrypt encrypts data using AES-GCM.
+// It returns a byte slice containing [Version (1b)] + [Flags (1b)] + [Key ID (1b)] + [Cipher ID (1b)] + [Nonce] + [Ciphertext].
+// The header before the nonce is authenticated along with the ciphertext.
+func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
+	return EncryptWithOptions(plaintext, key, EncryptOptions{})
+}
+
+// EncryptWithOptions encrypts data in the same format as Encrypt, with the
+// cipher and compression given by opts. Compression is skipped, and FlagGzip
+// left clear, when it doesn't make the plaintext smaller.
+func EncryptWithOptions(plaintext []byte, key []byte, opts EncryptOptions) ([]byte, error) {
+	id := opts.Cipher
+	if id == 0 {
+		id = CipherAESGCM
+	}
+	random := opts.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+	c, err := newAEAD(id, key, random)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a random nonce value using the rand package.
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	var flags byte
+	if opts.Compress {
+		compressed, err := compress(plaintext, opts.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(plaintext) {
+			plaintext, flags = compressed, flags|FlagGzip
+		}
+	}
+
+	h := []byte{Version, flags, opts.KeyID, byte(id)}
+	sealed, err := c.Encrypt(plaintext, associatedData(h, opts.AAD))
+	if err != nil {
 		return nil, err
 	}
+	return append(h, sealed...), nil
+}
 
-	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+// associatedData returns the data authenticated along with a message: its
+// header, so flags like FlagGzip can't be flipped in transit, then the
+// caller's aad.
+func associatedData(header, aad []byte) []byte {
+	data := make([]byte, 0, len(header)+len(aad))
+	return append(append(data, header...), aad...)
 }
 
-// Decrypt decrypts the data using AES-GCM
-// It expects input in the format [Nonce (12b)] + [Ciphertext]
+// DecryptOptions configure DecryptWithOptions.
+type DecryptOptions struct {
+	// Nonces, when set, rejects messages whose nonce was seen recently with
+	// ErrNonceReuse. Only authenticated messages are recorded.
+	Nonces *NonceTracker
+
+	// AAD must equal the EncryptOptions.AAD the message was sealed with.
+	AAD []byte
+}
+
+// Decrypt decrypts data sealed by Encrypt or EncryptWithOptions, using the cipher
+// named in its header, and decompresses it if needed.
 func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
+	return DecryptWithOptions(ciphertext, key, DecryptOptions{})
+}
+
+// DecryptWithOptions is like Decrypt, with the checks given by opts. The key id
+// in the header is ignored, key is used whatever it says.
+func DecryptWithOptions(ciphertext []byte, key []byte, opts DecryptOptions) ([]byte, error) {
+	h, err := parseHeader(ciphertext)
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	c, err := NewAEAD(h.cipher, key)
 	if err != nil {
 		return nil, err
 	}
+	plaintext, err := c.Decrypt(h.sealed, associatedData(ciphertext[:headerSize], opts.AAD))
+	if err != nil {
+		return nil, err
+	}
+	if opts.Nonces != nil {
+		if err := opts.Nonces.Check(h.sealed[:c.NonceSize()]); err != nil {
+			return nil, err
+		}
+	}
+	if h.flags&FlagGzip != 0 {
+		return decompress(plaintext)
+	}
+	return plaintext, nil
+}
+
+// headerSize is the length of the unencrypted prefix of a ciphertext.
+const headerSize = 4
+
+// header is the parsed unencrypted prefix of a ciphertext.
+type header struct {
+	flags  byte
+	keyID  byte
+	cipher CipherID
+	sealed []byte // [Nonce] + [Ciphertext]
+}
+
+// parseHeader splits a ciphertext into its header and sealed part.
+func parseHeader(ciphertext []byte) (header, error) {
+	if len(ciphertext) < 1 {
+		return header{}, ErrCiphertextTooShort
+	}
+	if ciphertext[0] != Version {
+		return header{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, ciphertext[0])
+	}
+	if len(ciphertext) < headerSize {
+		return header{}, ErrCiphertextTooShort
+	}
+	return header{
+		flags:  ciphertext[1],
+		keyID:  ciphertext[2],
+		cipher: CipherID(ciphertext[3]),
+		sealed: ciphertext[headerSize:],
+	}, nil
+}
 
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+func compress(data []byte, level int) ([]byte, error) {
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
 	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	// Split nonce and actual ciphertext
-	nonce, actualCiphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed payload: %w", err)
+	}
+	defer r.Close()
 
-	return gcm.Open(nil, nonce, actualCiphertext, nil)
+	plaintext, err := io.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed payload: %w", err)
+	}
+	if len(plaintext) > MaxDecompressedSize {
+		return nil, fmt.Errorf("decompressed payload exceeds %d bytes", MaxDecompressedSize)
+	}
+	return plaintext, nil
 }
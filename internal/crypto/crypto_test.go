@@ -0,0 +1,342 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCiphersRoundTrip(t *testing.T) {
+	key := DeriveKey("password")
+	for _, id := range []CipherID{CipherAESGCM, CipherChaCha20Poly1305} {
+		t.Run(id.String(), func(t *testing.T) {
+			sealed, err := EncryptWithOptions([]byte("hello"), key, EncryptOptions{Cipher: id})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if CipherID(sealed[3]) != id {
+				t.Fatalf("header names cipher %v, want %v", CipherID(sealed[3]), id)
+			}
+			plaintext, err := Decrypt(sealed, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plaintext) != "hello" {
+				t.Fatalf("decrypted %q, want %q", plaintext, "hello")
+			}
+		})
+	}
+}
+
+func TestDecryptUnknownCipher(t *testing.T) {
+	key := DeriveKey("password")
+	sealed, err := Encrypt([]byte("hello"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed[3] = 0x7f
+	if _, err := Decrypt(sealed, key); !errors.Is(err, ErrUnknownCipher) {
+		t.Fatalf("Decrypt returned %v, want ErrUnknownCipher", err)
+	}
+	if _, err := ParseCipher("rot13"); !errors.Is(err, ErrUnknownCipher) {
+		t.Fatalf("ParseCipher returned %v, want ErrUnknownCipher", err)
+	}
+}
+
+func TestDecryptVersion(t *testing.T) {
+	key := DeriveKey("password")
+	sealed, err := Encrypt([]byte("hello"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed[0] != Version {
+		t.Fatalf("Encrypt wrote version %d, want %d", sealed[0], Version)
+	}
+	if _, err := Decrypt(sealed, key); err != nil {
+		t.Fatalf("Decrypt of the current format: %v", err)
+	}
+
+	sealed[0] = 0xee
+	if _, err := Decrypt(sealed, key); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("Decrypt returned %v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	key := DeriveKey("password")
+	random := make([]byte, 4<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name      string
+		plaintext []byte
+		gzipped   bool
+	}{
+		{"compressible", bytes.Repeat([]byte("clipboard "), 1000), true},
+		{"incompressible", random, false},
+		// gzip's own header makes a short input larger
+		{"larger when compressed", []byte("abc"), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			plain, err := Encrypt(tc.plaintext, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sealed, err := EncryptWithOptions(tc.plaintext, key, EncryptOptions{Compress: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gzipped := sealed[1]&FlagGzip != 0; gzipped != tc.gzipped {
+				t.Fatalf("FlagGzip is %v, want %v", gzipped, tc.gzipped)
+			}
+			if tc.gzipped && len(sealed) >= len(plain) {
+				t.Fatalf("compressed message is %d bytes, not smaller than %d", len(sealed), len(plain))
+			}
+			if !tc.gzipped && len(sealed) != len(plain) {
+				t.Fatalf("uncompressed message is %d bytes, want %d", len(sealed), len(plain))
+			}
+			plaintext, err := Decrypt(sealed, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(plaintext, tc.plaintext) {
+				t.Fatal("round trip changed the plaintext")
+			}
+		})
+	}
+}
+
+func TestAAD(t *testing.T) {
+	key := DeriveKey("password")
+	sealed, err := EncryptWithOptions([]byte("hello"), key, EncryptOptions{AAD: []byte("room-a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptWithOptions(sealed, key, DecryptOptions{AAD: []byte("room-a")}); err != nil {
+		t.Fatalf("matching AAD: %v", err)
+	}
+	for _, aad := range [][]byte{nil, []byte("room-b")} {
+		if _, err := DecryptWithOptions(sealed, key, DecryptOptions{AAD: aad}); !errors.Is(err, ErrDecryptAuth) {
+			t.Errorf("AAD %q returned %v, want ErrDecryptAuth", aad, err)
+		}
+	}
+
+	// The header is authenticated too
+	sealed[1] ^= FlagGzip
+	if _, err := DecryptWithOptions(sealed, key, DecryptOptions{AAD: []byte("room-a")}); !errors.Is(err, ErrDecryptAuth) {
+		t.Fatalf("flipped flag returned %v, want ErrDecryptAuth", err)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	key := DeriveKey("password")
+	sealed, err := Encrypt([]byte("hello"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decrypt(sealed[:headerSize+5], key); !errors.Is(err, ErrCiphertextTooShort) {
+		t.Errorf("truncated ciphertext returned %v, want ErrCiphertextTooShort", err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Decrypt(tampered, key); !errors.Is(err, ErrDecryptAuth) {
+		t.Errorf("tampered tag returned %v, want ErrDecryptAuth", err)
+	}
+	if _, err := Decrypt(sealed, DeriveKey("other")); !errors.Is(err, ErrDecryptAuth) {
+		t.Errorf("wrong key returned %v, want ErrDecryptAuth", err)
+	}
+}
+
+func TestVerifyKeyCommitment(t *testing.T) {
+	key := DeriveKey("password")
+	challenge := []byte("peer-a")
+	commitment := KeyCommitment(key, challenge)
+
+	if !VerifyKeyCommitment(key, challenge, commitment) {
+		t.Fatal("matching key and challenge rejected")
+	}
+	if VerifyKeyCommitment(DeriveKey("other"), challenge, commitment) {
+		t.Error("mismatching key accepted")
+	}
+	if VerifyKeyCommitment(key, []byte("peer-b"), commitment) {
+		t.Error("commitment replayed for another challenge accepted")
+	}
+	if VerifyKeyCommitment(key, challenge, commitment[:16]) || VerifyKeyCommitment(key, challenge, nil) {
+		t.Error("truncated commitment accepted")
+	}
+}
+
+func TestEncryptRand(t *testing.T) {
+	key := DeriveKey("password")
+	nonce := bytes.Repeat([]byte{7}, 12)
+
+	first, err := EncryptWithOptions([]byte("hello"), key, EncryptOptions{Rand: bytes.NewReader(nonce)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EncryptWithOptions([]byte("hello"), key, EncryptOptions{Rand: bytes.NewReader(nonce)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("same nonce source gave different ciphertexts")
+	}
+	if !bytes.Equal(first[headerSize:headerSize+len(nonce)], nonce) {
+		t.Fatalf("ciphertext carries nonce %x, want %x", first[headerSize:headerSize+len(nonce)], nonce)
+	}
+
+	failure := errors.New("no entropy")
+	if _, err := EncryptWithOptions([]byte("hello"), key, EncryptOptions{Rand: iotest.ErrReader(failure)}); !errors.Is(err, failure) {
+		t.Fatalf("failing nonce source returned %v, want %v", err, failure)
+	}
+}
+
+func TestDeriveSubkeys(t *testing.T) {
+	sendKey, recvKey := DeriveSubkeys(DeriveKey("password"))
+	if len(sendKey) != KeySize || len(recvKey) != KeySize {
+		t.Fatalf("subkeys are %d and %d bytes, want %d", len(sendKey), len(recvKey), KeySize)
+	}
+	if bytes.Equal(sendKey, recvKey) {
+		t.Fatal("send and receive subkeys are equal")
+	}
+
+	// Both peers derive the same pair, the responder uses it mirrored
+	respSend, respRecv := DeriveSubkeys(DeriveKey("password"))
+	respSend, respRecv = respRecv, respSend
+
+	for _, tc := range []struct {
+		name       string
+		seal, open []byte
+	}{
+		{"initiator to responder", sendKey, respRecv},
+		{"responder to initiator", respSend, recvKey},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sealed, err := Encrypt([]byte("hello"), tc.seal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := Decrypt(sealed, tc.open)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plaintext) != "hello" {
+				t.Fatalf("decrypted %q, want %q", plaintext, "hello")
+			}
+		})
+	}
+
+	// A message can't be reflected back to its sender in the other direction
+	sealed, err := Encrypt([]byte("hello"), sendKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(sealed, recvKey); !errors.Is(err, ErrDecryptAuth) {
+		t.Fatalf("reflected message returned %v, want ErrDecryptAuth", err)
+	}
+}
+
+var benchSizes = []struct {
+	name string
+	size int
+}{
+	{"64B", 64},
+	{"1KB", 1 << 10},
+	{"64KB", 64 << 10},
+	{"4MB", 4 << 20},
+}
+
+// benchOptions are the configurations compared by the benchmarks. Compression
+// is measured on text-like input, random input wouldn't compress.
+var benchOptions = []struct {
+	name string
+	opts EncryptOptions
+}{
+	{"aes-gcm", EncryptOptions{Cipher: CipherAESGCM}},
+	{"chacha20-poly1305", EncryptOptions{Cipher: CipherChaCha20Poly1305}},
+	{"aes-gcm+gzip", EncryptOptions{Cipher: CipherAESGCM, Compress: true}},
+}
+
+// benchPlaintext returns size bytes of input for opts.
+func benchPlaintext(b *testing.B, size int, opts EncryptOptions) []byte {
+	if opts.Compress {
+		line := []byte("The quick brown fox jumps over the lazy dog 0123456789\n")
+		return bytes.Repeat(line, size/len(line)+1)[:size]
+	}
+	data := make([]byte, size)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	return data
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	key := DeriveKey("benchmark")
+	for _, o := range benchOptions {
+		for _, s := range benchSizes {
+			b.Run(fmt.Sprintf("%s/%s", o.name, s.name), func(b *testing.B) {
+				plaintext := benchPlaintext(b, s.size, o.opts)
+				b.SetBytes(int64(s.size))
+				for b.Loop() {
+					if _, err := EncryptWithOptions(plaintext, key, o.opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	key := DeriveKey("benchmark")
+	for _, o := range benchOptions {
+		for _, s := range benchSizes {
+			b.Run(fmt.Sprintf("%s/%s", o.name, s.name), func(b *testing.B) {
+				ciphertext, err := EncryptWithOptions(benchPlaintext(b, s.size, o.opts), key, o.opts)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(int64(s.size))
+				for b.Loop() {
+					if _, err := Decrypt(ciphertext, key); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkCompressLevel shows the trade-off of --compression-level: the time to
+// seal text-like input, against the size of the result relative to the input.
+func BenchmarkCompressLevel(b *testing.B) {
+	key := DeriveKey("benchmark")
+	for _, level := range []int{1, 6, 9} {
+		for _, s := range benchSizes[2:] {
+			b.Run(fmt.Sprintf("level-%d/%s", level, s.name), func(b *testing.B) {
+				opts := EncryptOptions{Compress: true, CompressionLevel: level}
+				plaintext := benchPlaintext(b, s.size, opts)
+				var sealed []byte
+				b.SetBytes(int64(s.size))
+				for b.Loop() {
+					var err error
+					if sealed, err = EncryptWithOptions(plaintext, key, opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(len(sealed))/float64(s.size), "ratio")
+			})
+		}
+	}
+}
+
+func BenchmarkDeriveKey(b *testing.B) {
+	for b.Loop() {
+		DeriveKey("correct horse battery staple")
+	}
+}
@@ -0,0 +1,62 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// KeySize is the size of the keys used by all ciphers.
+const KeySize = 32
+
+// LoadKey reads a raw key from the file at path, for users who prefer a random
+// key to a password. The file holds the 32 key bytes themselves, or their hex or
+// base64 encoding; surrounding whitespace is ignored. An all-zero key is
+// rejected, it is almost certainly a mistake.
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	key, err := parseKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func parseKey(data []byte) ([]byte, error) {
+	var key []byte
+	if len(data) == KeySize {
+		key = data
+	} else {
+		text := string(bytes.TrimSpace(data))
+		if decoded, err := hex.DecodeString(text); err == nil {
+			key = decoded
+		} else if decoded, err := base64.StdEncoding.DecodeString(text); err == nil {
+			key = decoded
+		} else if decoded, err := base64.RawURLEncoding.DecodeString(text); err == nil {
+			key = decoded
+		} else {
+			return nil, fmt.Errorf("expected %d raw bytes, hex or base64", KeySize)
+		}
+	}
+
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key is %d bytes, expected %d", len(key), KeySize)
+	}
+	if bytes.Equal(key, make([]byte, KeySize)) {
+		return nil, fmt.Errorf("key is all zeros")
+	}
+	return key, nil
+}
+
+// Zero overwrites b with zeros, to wipe key material once it is no longer
+// needed. Copies made elsewhere, e.g. by the garbage collector moving memory,
+// are not affected.
+func Zero(b []byte) {
+	clear(b)
+}
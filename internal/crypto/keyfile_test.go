@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKeyFile writes data to a file in a temporary directory and returns its path.
+func writeKeyFile(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKey(t *testing.T) {
+	key := DeriveKey("password")
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"raw", key},
+		{"hex", []byte(hex.EncodeToString(key) + "\n")},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(key) + "\n")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := LoadKey(writeKeyFile(t, tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Fatalf("loaded %x, want %x", got, key)
+			}
+		})
+	}
+}
+
+func TestLoadKeyInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{"wrong length", []byte(hex.EncodeToString(DeriveKey("password")[:16]) + "\n")},
+		{"all zeros", []byte(hex.EncodeToString(make([]byte, KeySize)))},
+		{"not an encoding", []byte("not a key")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := LoadKey(writeKeyFile(t, tc.data)); err == nil {
+				t.Fatal("LoadKey succeeded")
+			}
+		})
+	}
+
+	if _, err := LoadKey(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Fatalf("missing file returned %v, want a not-exist error", err)
+	}
+}
+
+func TestZero(t *testing.T) {
+	key := DeriveKey("password")
+	Zero(key)
+	if !bytes.Equal(key, make([]byte, KeySize)) {
+		t.Fatalf("Zero left %x", key)
+	}
+}
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownKey is returned by Keyring.Decrypt when a message names a key id
+// that isn't in the keyring, e.g. because it was removed after a rotation.
+var ErrUnknownKey = errors.New("unknown key id")
+
+// Keyring holds the keys of a room during a key rotation. New messages are
+// sealed with the current key, and messages sealed with any key still in the
+// keyring can be opened, so messages in flight survive the rotation.
+// It is safe for concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[byte][]byte
+	current byte
+}
+
+// KeyID returns an id for key in a Keyring. Every holder of the key computes the
+// same id, so peers agree on it without coordination.
+func KeyID(key []byte) byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("clipboard-sync/key-id"))
+	return mac.Sum(nil)[0]
+}
+
+// NewKeyring returns an empty keyring. Add a key before encrypting.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[byte][]byte)}
+}
+
+// Add stores key under id and makes it the current key. Adding an id that
+// is already present replaces its key.
+func (k *Keyring) Add(id byte, key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = key
+	k.current = id
+}
+
+// Remove drops the key with id. Messages sealed with it can't be opened
+// anymore. Removing the current key leaves the keyring without one until the
+// next Add.
+func (k *Keyring) Remove(id byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, id)
+}
+
+// Destroy drops the key with id like Remove and zeroes it. Messages being
+// sealed or opened with it finish first.
+func (k *Keyring) Destroy(id byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	Zero(k.keys[id])
+	delete(k.keys, id)
+}
+
+// Wipe destroys every key in the keyring.
+func (k *Keyring) Wipe() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for id, key := range k.keys {
+		Zero(key)
+		delete(k.keys, id)
+	}
+}
+
+// Key returns the key stored under id, or nil if there is none.
+func (k *Keyring) Key(id byte) []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[id]
+}
+
+// Current returns the id and key used to seal new messages. The key is nil
+// if the keyring has no current key.
+func (k *Keyring) Current() (byte, []byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current, k.keys[k.current]
+}
+
+// Encrypt seals plaintext with the current key, recording its id in the header.
+// opts.KeyID is ignored.
+func (k *Keyring) Encrypt(plaintext []byte, opts EncryptOptions) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key := k.keys[k.current]
+	if key == nil {
+		return nil, errors.New("keyring has no current key")
+	}
+	opts.KeyID = k.current
+	return EncryptWithOptions(plaintext, key, opts)
+}
+
+// Decrypt opens a message with the key named in its header.
+func (k *Keyring) Decrypt(ciphertext []byte, opts DecryptOptions) ([]byte, error) {
+	h, err := parseHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[h.keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %d", ErrUnknownKey, h.keyID)
+	}
+	return DecryptWithOptions(ciphertext, key, opts)
+}
@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestKeyringRotation(t *testing.T) {
+	keyA, keyB := DeriveKey("password a"), DeriveKey("password b")
+	k := NewKeyring()
+	k.Add(KeyID(keyA), keyA)
+	inFlight, err := k.Encrypt([]byte("sealed with a"), EncryptOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k.Add(KeyID(keyB), keyB)
+	sealed, err := k.Encrypt([]byte("sealed with b"), EncryptOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(sealed, keyB); err != nil {
+		t.Fatalf("new messages aren't sealed with the current key: %v", err)
+	}
+	if plaintext, err := k.Decrypt(inFlight, DecryptOptions{}); err != nil || string(plaintext) != "sealed with a" {
+		t.Fatalf("in-flight message: %q, %v", plaintext, err)
+	}
+
+	k.Destroy(KeyID(keyA))
+	if _, err := k.Decrypt(inFlight, DecryptOptions{}); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("message sealed with a removed key returned %v, want ErrUnknownKey", err)
+	}
+	if !bytes.Equal(keyA, make([]byte, len(keyA))) {
+		t.Fatal("Destroy didn't zero the key")
+	}
+}
@@ -0,0 +1,49 @@
+package crypto
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNonceReuse is returned when a message reuses the nonce of a recent message,
+// either through a random collision or because the message was replayed.
+var ErrNonceReuse = errors.New("nonce reuse detected")
+
+// NonceTracker remembers the nonces of the most recent messages, up to a fixed
+// capacity, so reuse within a session can be detected.
+type NonceTracker struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+	ring []string // Remembered nonces in arrival order, oldest overwritten first
+	next int
+}
+
+// NewNonceTracker creates a tracker remembering up to capacity nonces.
+func NewNonceTracker(capacity int) *NonceTracker {
+	return &NonceTracker{
+		seen: make(map[string]struct{}, capacity),
+		ring: make([]string, capacity),
+	}
+}
+
+// Check records nonce and returns ErrNonceReuse if it was already seen.
+func (t *NonceTracker) Check(nonce []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := string(nonce)
+	if _, ok := t.seen[key]; ok {
+		return ErrNonceReuse
+	}
+	if len(t.ring) == 0 {
+		return nil
+	}
+
+	if old := t.ring[t.next]; old != "" {
+		delete(t.seen, old)
+	}
+	t.ring[t.next] = key
+	t.seen[key] = struct{}{}
+	t.next = (t.next + 1) % len(t.ring)
+	return nil
+}
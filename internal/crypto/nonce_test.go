@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecryptNonceReuse(t *testing.T) {
+	key := DeriveKey("password")
+	nonces := NewNonceTracker(16)
+	nonce := bytes.Repeat([]byte{7}, 12)
+
+	// Two different messages forced to share a nonce
+	first, err := EncryptWithOptions([]byte("first"), key, EncryptOptions{Rand: bytes.NewReader(nonce)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EncryptWithOptions([]byte("second"), key, EncryptOptions{Rand: bytes.NewReader(nonce)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DecryptWithOptions(first, key, DecryptOptions{Nonces: nonces}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptWithOptions(second, key, DecryptOptions{Nonces: nonces}); !errors.Is(err, ErrNonceReuse) {
+		t.Fatalf("second message returned %v, want ErrNonceReuse", err)
+	}
+}
+
+func TestNonceTrackerCapacity(t *testing.T) {
+	nonces := NewNonceTracker(2)
+	for _, nonce := range []string{"a", "b", "c"} {
+		if err := nonces.Check([]byte(nonce)); err != nil {
+			t.Fatalf("fresh nonce %q: %v", nonce, err)
+		}
+	}
+	// "a" was forgotten to make room for "c"
+	if err := nonces.Check([]byte("a")); err != nil {
+		t.Fatalf("forgotten nonce: %v", err)
+	}
+	if err := nonces.Check([]byte("c")); !errors.Is(err, ErrNonceReuse) {
+		t.Fatalf("remembered nonce returned %v, want ErrNonceReuse", err)
+	}
+}
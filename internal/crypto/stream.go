@@ -0,0 +1,225 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamSegmentSize is the amount of plaintext sealed in each segment of a stream.
+const StreamSegmentSize = 64 << 10
+
+// streamVersion is the first byte of a stream, before the cipher id.
+const streamVersion = 1
+
+// streamIDSize is the size of the random id that ties segments to their stream.
+const streamIDSize = 16
+
+// Segment flags, authenticated with the segment.
+const (
+	segmentFinal byte = 1 << iota // Last segment of the stream
+)
+
+// segmentHeaderSize is [Flags (1b)] + [Sealed Length (4b)].
+const segmentHeaderSize = 5
+
+// ErrStreamTruncated is returned by a stream reader when the stream ends before
+// its final segment, i.e. data was cut off.
+var ErrStreamTruncated = errors.New("encrypted stream truncated")
+
+// ErrStreamTrailingData is returned by a stream reader when data follows the
+// final segment.
+var ErrStreamTrailingData = errors.New("data after the end of the encrypted stream")
+
+// segmentAAD binds a segment to its stream, its position in it and to whether
+// it is the last one, so segments can't be reordered, dropped, appended or
+// spliced in from another stream under the same key.
+func segmentAAD(streamID []byte, seq uint64, flags byte) []byte {
+	aad := make([]byte, streamIDSize+9)
+	copy(aad, streamID)
+	binary.BigEndian.PutUint64(aad[streamIDSize:], seq)
+	aad[streamIDSize+8] = flags
+	return aad
+}
+
+// encryptWriter seals everything written to it as a stream of segments.
+type encryptWriter struct {
+	w      io.Writer
+	c      AEAD
+	id     CipherID
+	buf    []byte
+	stream []byte // Random id of the stream, nil until the header is written
+	seq    uint64
+	closed bool
+}
+
+// NewEncryptWriter returns a writer that encrypts data written to it with
+// AES-256-GCM and writes it to w, in segments of StreamSegmentSize that are
+// sealed independently so neither side has to hold the whole plaintext.
+// Close must be called to write the final segment.
+// Stream layout: [Version (1b)] + [Cipher ID (1b)] + [Stream ID (16b)] + segments of
+// [Flags (1b)] + [Length (4b)] + [Nonce] + [Ciphertext]
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	c, err := NewAEAD(CipherAESGCM, key)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, c: c, id: CipherAESGCM, buf: make([]byte, 0, StreamSegmentSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		// Only seal a full segment once more data follows it, the last one
+		// has to be marked final by Close
+		if len(e.buf) == StreamSegmentSize {
+			if err := e.flush(0); err != nil {
+				return n, err
+			}
+		}
+		k := copy(e.buf[len(e.buf):StreamSegmentSize], p)
+		e.buf = e.buf[:len(e.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close writes the final segment. It does not close the underlying writer.
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.flush(segmentFinal)
+}
+
+// flush seals the buffered plaintext as the next segment.
+func (e *encryptWriter) flush(flags byte) error {
+	if e.stream == nil {
+		header := make([]byte, 2+streamIDSize)
+		header[0], header[1] = streamVersion, byte(e.id)
+		if _, err := rand.Read(header[2:]); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(header); err != nil {
+			return err
+		}
+		e.stream = header[2:]
+	}
+
+	sealed, err := e.c.Encrypt(e.buf, segmentAAD(e.stream, e.seq, flags))
+	if err != nil {
+		return err
+	}
+	e.seq++
+	e.buf = e.buf[:0]
+
+	frame := make([]byte, segmentHeaderSize, segmentHeaderSize+len(sealed))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(sealed)))
+	_, err = e.w.Write(append(frame, sealed...))
+	return err
+}
+
+// decryptReader opens a stream written by an encryptWriter.
+type decryptReader struct {
+	r    io.Reader
+	key  []byte
+	c    AEAD
+	id   []byte // Stream id from the header
+	buf  []byte // Plaintext of the current segment not yet read
+	seq  uint64
+	done bool // Whether the final segment was read
+	err  error
+}
+
+// NewDecryptReader returns a reader that decrypts a stream written by an
+// encrypt writer from r. Reads fail if a segment was modified, reordered or
+// removed, with ErrStreamTruncated if the stream ends early and with
+// ErrStreamTrailingData if anything follows its final segment.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %d", len(key))
+	}
+	return &decryptReader{r: r, key: key}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			return 0, io.EOF
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next reads and opens the next segment into d.buf.
+func (d *decryptReader) next() error {
+	if d.c == nil {
+		var header [2 + streamIDSize]byte
+		if _, err := io.ReadFull(d.r, header[:]); err != nil {
+			return truncated(err)
+		}
+		if header[0] != streamVersion {
+			return fmt.Errorf("%w: stream version %d", ErrUnsupportedVersion, header[0])
+		}
+		c, err := NewAEAD(CipherID(header[1]), d.key)
+		if err != nil {
+			return err
+		}
+		d.c, d.id = c, header[2:]
+	}
+
+	var header [segmentHeaderSize]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		return truncated(err)
+	}
+	flags, size := header[0], binary.BigEndian.Uint32(header[1:])
+	if size > StreamSegmentSize+uint32(d.c.NonceSize())+16 {
+		return fmt.Errorf("stream segment of %d bytes is too large", size)
+	}
+
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return truncated(err)
+	}
+	plaintext, err := d.c.Decrypt(sealed, segmentAAD(d.id, d.seq, flags))
+	if err != nil {
+		return fmt.Errorf("stream segment %d: %w", d.seq, err)
+	}
+	if flags&segmentFinal != 0 {
+		// Nothing may follow the final segment
+		var extra [1]byte
+		switch _, err := io.ReadFull(d.r, extra[:]); err {
+		case io.EOF:
+		case nil:
+			return ErrStreamTrailingData
+		default:
+			return err
+		}
+		d.done = true
+	}
+	d.seq++
+	d.buf = plaintext
+	return nil
+}
+
+// truncated maps the end of the underlying reader to ErrStreamTruncated.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrStreamTruncated
+	}
+	return err
+}
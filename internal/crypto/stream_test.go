@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// encryptStream returns data encrypted as a stream with key.
+func encryptStream(t *testing.T, data, key []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := NewEncryptWriter(&out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// decryptStream reads the whole stream with key.
+func decryptStream(stream, key []byte) ([]byte, error) {
+	r, err := NewDecryptReader(bytes.NewReader(stream), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// segments splits a stream into its header and segments.
+func segments(stream []byte) (header []byte, segs [][]byte) {
+	header, rest := stream[:2+streamIDSize], stream[2+streamIDSize:]
+	for len(rest) > 0 {
+		n := segmentHeaderSize + int(binary.BigEndian.Uint32(rest[1:segmentHeaderSize]))
+		segs = append(segs, rest[:n])
+		rest = rest[n:]
+	}
+	return header, segs
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := DeriveKey("password")
+	data := make([]byte, 10<<20)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decryptStream(encryptStream(t, data, key), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("round trip changed the data")
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := DeriveKey("password")
+	data := bytes.Repeat([]byte("x"), 3*StreamSegmentSize)
+	header, segs := segments(encryptStream(t, data, key))
+
+	if len(segs) != 3 {
+		t.Fatalf("stream has %d segments, want 3", len(segs))
+	}
+	reordered := bytes.Join([][]byte{header, segs[1], segs[0], segs[2]}, nil)
+	if _, err := decryptStream(reordered, key); !errors.Is(err, ErrDecryptAuth) {
+		t.Errorf("reordered segments returned %v, want ErrDecryptAuth", err)
+	}
+	truncated := bytes.Join([][]byte{header, segs[0], segs[1]}, nil)
+	if _, err := decryptStream(truncated, key); !errors.Is(err, ErrStreamTruncated) {
+		t.Errorf("truncated stream returned %v, want ErrStreamTruncated", err)
+	}
+
+	// A segment from another stream under the same key, at the same position
+	_, other := segments(encryptStream(t, data, key))
+	spliced := bytes.Join([][]byte{header, segs[0], other[1], segs[2]}, nil)
+	if _, err := decryptStream(spliced, key); !errors.Is(err, ErrDecryptAuth) {
+		t.Errorf("spliced segment returned %v, want ErrDecryptAuth", err)
+	}
+	trailing := bytes.Join([][]byte{header, segs[0], segs[1], segs[2], []byte("x")}, nil)
+	if _, err := decryptStream(trailing, key); !errors.Is(err, ErrStreamTrailingData) {
+		t.Errorf("data after the final segment returned %v, want ErrStreamTrailingData", err)
+	}
+}
@@ -0,0 +1,31 @@
+// Package logging configures the structured, leveled logger shared by the client
+// and the server.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Setup makes a logger writing to w the default for log/slog and for the log
+// package. level is debug, info, warn or error; format is text or json.
+func Setup(w io.Writer, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
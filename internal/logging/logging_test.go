@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// restoreDefault puts back the default loggers Setup replaces when the test ends.
+func restoreDefault(t *testing.T) {
+	t.Helper()
+	logger, flags, output := slog.Default(), log.Flags(), log.Writer()
+	t.Cleanup(func() {
+		slog.SetDefault(logger)
+		log.SetFlags(flags)
+		log.SetOutput(output)
+	})
+}
+
+func TestSetup(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		level, format string
+		logged        []slog.Level // Levels that get through
+		invalid       bool
+	}{
+		{"info", "info", "json", []slog.Level{slog.LevelInfo, slog.LevelWarn, slog.LevelError}, false},
+		{"debug", "debug", "json", []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}, false},
+		{"error", "error", "json", []slog.Level{slog.LevelError}, false},
+		{"case insensitive", "WARN", "json", []slog.Level{slog.LevelWarn, slog.LevelError}, false},
+		{"invalid level", "loud", "json", nil, true},
+		{"invalid format", "info", "xml", nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			restoreDefault(t)
+			var out bytes.Buffer
+			if err := Setup(&out, tc.level, tc.format); (err != nil) != tc.invalid {
+				t.Fatalf("returned %v, want an error: %v", err, tc.invalid)
+			}
+			if tc.invalid {
+				return
+			}
+
+			for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+				slog.Log(t.Context(), level, "Peer connected", "room", "room-a", "peer", "peer-b")
+			}
+			var got []slog.Level
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var event struct {
+					Level slog.Level
+					Msg   string
+					Room  string
+					Peer  string
+				}
+				if err := json.Unmarshal([]byte(line), &event); err != nil {
+					t.Fatalf("invalid JSON event %q: %v", line, err)
+				}
+				if event.Msg != "Peer connected" || event.Room != "room-a" || event.Peer != "peer-b" {
+					t.Fatalf("event %q lost its attributes", line)
+				}
+				got = append(got, event.Level)
+			}
+			if !slices.Equal(got, tc.logged) {
+				t.Fatalf("logged levels %v, want %v", got, tc.logged)
+			}
+		})
+	}
+}
+
+func TestSetupText(t *testing.T) {
+	restoreDefault(t)
+	var out bytes.Buffer
+	if err := Setup(&out, "info", "text"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Info("Peer connected", "room", "room-a", "peer", "peer-b")
+	// The log package goes through the same handler
+	log.Print("from the log package")
+
+	for _, want := range []string{`msg="Peer connected" room=room-a peer=peer-b`, `msg="from the log package"`} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("missing %s in %q", want, out.String())
+		}
+	}
+}
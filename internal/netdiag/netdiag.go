@@ -0,0 +1,155 @@
+// Package netdiag diagnoses how the local network's NAT behaves using STUN.
+// It sends binding requests to several STUN servers from a single UDP socket and
+// compares the reflexive (public) addresses they report, which tells users whether
+// direct P2P connections are likely to work or a TURN server is needed.
+package netdiag
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/pion/stun"
+)
+
+// NATType describes the detected NAT mapping behaviour.
+type NATType string
+
+const (
+	NATNone      NATType = "none (public address)"
+	NATCone      NATType = "cone (endpoint-independent mapping)"
+	NATSymmetric NATType = "symmetric (endpoint-dependent mapping)"
+	NATUnknown   NATType = "unknown"
+)
+
+// Result is the outcome of a single STUN binding request.
+type Result struct {
+	Server string       // STUN server URL as configured
+	Mapped *net.UDPAddr // Reflexive address reported by the server
+	Err    error        // Set if the server could not be queried
+}
+
+// Report summarizes the STUN results for the local network.
+type Report struct {
+	LocalPort int
+	Results   []Result
+	NAT       NATType
+}
+
+// Recommendation returns advice for the user based on the detected NAT type.
+func (r *Report) Recommendation() string {
+	switch r.NAT {
+	case NATNone:
+		return "No NAT detected. Direct P2P connections should work."
+	case NATCone:
+		return "Cone NAT detected. Direct P2P connections should work with STUN alone."
+	case NATSymmetric:
+		return "Symmetric NAT detected — configure a TURN server, direct P2P connections will likely fail."
+	default:
+		return "Could not determine the NAT type. Configure at least two reachable STUN servers and try again."
+	}
+}
+
+// Diagnose queries every STUN server from the same local UDP socket and classifies
+// the NAT. Full-cone and restricted-cone NATs can't be told apart without RFC 5780
+// capable servers, so both are reported as NATCone.
+func Diagnose(stunURLs []string, timeout time.Duration) (*Report, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	report := &Report{LocalPort: conn.LocalAddr().(*net.UDPAddr).Port}
+	var mapped []*net.UDPAddr
+	for _, server := range stunURLs {
+		addr, err := query(conn, server, timeout)
+		report.Results = append(report.Results, Result{Server: server, Mapped: addr, Err: err})
+		if err == nil {
+			mapped = append(mapped, addr)
+		}
+	}
+
+	if len(mapped) == 0 {
+		return report, errors.New("no STUN server responded (is outbound UDP blocked?)")
+	}
+	report.NAT = classify(mapped, report.LocalPort)
+	return report, nil
+}
+
+// classify derives the NAT type from the reflexive addresses seen by different servers.
+func classify(mapped []*net.UDPAddr, localPort int) NATType {
+	if mapped[0].Port == localPort && isLocalIP(mapped[0].IP) {
+		return NATNone
+	}
+	if len(mapped) < 2 {
+		return NATUnknown
+	}
+	for _, addr := range mapped[1:] {
+		if !addr.IP.Equal(mapped[0].IP) || addr.Port != mapped[0].Port {
+			return NATSymmetric
+		}
+	}
+	return NATCone
+}
+
+// query sends a STUN binding request to server and returns the reflexive address.
+func query(conn *net.UDPConn, server string, timeout time.Duration) (*net.UDPAddr, error) {
+	uri, err := stun.ParseURI(server)
+	if err != nil {
+		return nil, err
+	}
+	raddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("%s:%d", uri.Host, uri.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := stun.Build(stun.TransactionID, stun.BindingRequest)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(req.Raw, raddr); err != nil {
+		return nil, err
+	}
+
+	// Read until the response to our transaction arrives or the deadline passes
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return nil, err
+		}
+		if !from.IP.Equal(raddr.IP) || from.Port != raddr.Port {
+			continue
+		}
+
+		var res stun.Message
+		if err := stun.Decode(buf[:n], &res); err != nil || res.TransactionID != req.TransactionID {
+			continue
+		}
+
+		var xorAddr stun.XORMappedAddress
+		if err := xorAddr.GetFrom(&res); err != nil {
+			return nil, fmt.Errorf("invalid STUN response: %w", err)
+		}
+		return &net.UDPAddr{IP: xorAddr.IP, Port: xorAddr.Port}, nil
+	}
+}
+
+// isLocalIP reports whether ip is assigned to one of this machine's interfaces.
+func isLocalIP(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
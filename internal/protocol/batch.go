@@ -0,0 +1,51 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// EncodeBatch frames several clipboard entries, oldest first, into one payload
+// for an envelope with FlagBatch set.
+// Layout: [Count (2b)] + Count * ([Length (4b)] + [Data])
+func EncodeBatch(entries [][]byte) []byte {
+	size := 2
+	for _, entry := range entries {
+		size += 4 + len(entry)
+	}
+
+	body := make([]byte, 0, size)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(entries)))
+	for _, entry := range entries {
+		body = binary.BigEndian.AppendUint32(body, uint32(len(entry)))
+		body = append(body, entry...)
+	}
+	return body
+}
+
+// DecodeBatch parses a payload produced by EncodeBatch.
+func DecodeBatch(body []byte) ([][]byte, error) {
+	if len(body) < 2 {
+		return nil, errors.New("batch too short")
+	}
+	count := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+
+	entries := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if len(body) < 4 {
+			return nil, errors.New("batch entry header truncated")
+		}
+		n := binary.BigEndian.Uint32(body)
+		body = body[4:]
+		if uint64(n) > uint64(len(body)) {
+			return nil, errors.New("batch entry truncated")
+		}
+		entries = append(entries, body[:n])
+		body = body[n:]
+	}
+	if count == 0 {
+		return nil, errors.New("empty batch")
+	}
+	return entries, nil
+}
@@ -0,0 +1,228 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// FragmentHeaderSize is the length of the header at the start of a fragment's payload.
+const FragmentHeaderSize = 12
+
+// Fragment is one piece of a message too large for a single DataChannel send.
+// It travels as the payload of an envelope with FlagFragment set, and the
+// reassembled bytes form a complete inner envelope.
+// Layout: [Message ID (8b)] + [Index (2b)] + [Count (2b)] + [Chunk]
+type Fragment struct {
+	ID    uint64
+	Index uint16
+	Count uint16
+	Chunk []byte
+}
+
+// Marshal serializes a fragment into an envelope payload.
+func (f *Fragment) Marshal() []byte {
+	data := make([]byte, FragmentHeaderSize, FragmentHeaderSize+len(f.Chunk))
+	binary.BigEndian.PutUint64(data[0:8], f.ID)
+	binary.BigEndian.PutUint16(data[8:10], f.Index)
+	binary.BigEndian.PutUint16(data[10:12], f.Count)
+	return append(data, f.Chunk...)
+}
+
+// UnmarshalFragment parses the payload of an envelope with FlagFragment set.
+func UnmarshalFragment(data []byte) (*Fragment, error) {
+	if len(data) < FragmentHeaderSize {
+		return nil, ErrTruncated
+	}
+	f := &Fragment{
+		ID:    binary.BigEndian.Uint64(data[0:8]),
+		Index: binary.BigEndian.Uint16(data[8:10]),
+		Count: binary.BigEndian.Uint16(data[10:12]),
+		Chunk: data[FragmentHeaderSize:],
+	}
+	if f.Count == 0 || f.Index >= f.Count {
+		return nil, fmt.Errorf("invalid fragment %d of %d", f.Index, f.Count)
+	}
+	return f, nil
+}
+
+// Split cuts a serialized envelope into fragment envelopes of at most maxSize
+// bytes each, identified by id, which must be unique among the sender's
+// transfers. An envelope that already fits is returned as is.
+func Split(data []byte, id uint64, maxSize int) ([][]byte, error) {
+	if len(data) <= maxSize {
+		return [][]byte{data}, nil
+	}
+	chunkSize := maxSize - HeaderSize - FragmentHeaderSize
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("fragment size %d is smaller than the headers", maxSize)
+	}
+	count := (len(data) + chunkSize - 1) / chunkSize
+	if count > math.MaxUint16 {
+		return nil, fmt.Errorf("message of %d bytes needs %d fragments, more than %d", len(data), count, math.MaxUint16)
+	}
+
+	parts := make([][]byte, 0, count)
+	for i := range count {
+		chunk := data[i*chunkSize : min((i+1)*chunkSize, len(data))]
+		frag := Fragment{ID: id, Index: uint16(i), Count: uint16(count), Chunk: chunk}
+		env := Envelope{Version: Version, Flags: FlagFragment, Seq: id, Payload: frag.Marshal()}
+		part, err := env.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// chunkSlotSize is what a transfer holds per fragment before it arrives (a slice
+// header), charged to the byte budget so a peer announcing many fragments and
+// sending few or empty ones can't hold memory the budget doesn't see.
+const chunkSlotSize = 24
+
+// ErrTransferTooLarge is returned when a single transfer exceeds the reassembly byte budget.
+var ErrTransferTooLarge = errors.New("fragmented transfer too large")
+
+// Reassembler collects fragments until their message is complete. It bounds the
+// memory held by incomplete transfers, so a peer that starts many transfers and
+// never finishes them can't exhaust memory: the oldest transfers are evicted once
+// MaxTransfers or MaxBytes is exceeded, and transfers older than Timeout expire.
+type Reassembler struct {
+	MaxTransfers int           // In-progress transfers kept across all sources
+	MaxBytes     int           // Bytes buffered across all in-progress transfers
+	Timeout      time.Duration // Time allowed for a transfer to complete
+
+	mu        sync.Mutex
+	transfers map[transferKey]*transfer
+	buffered  int
+}
+
+type transferKey struct {
+	source string
+	id     uint64
+}
+
+type transfer struct {
+	chunks   [][]byte
+	received int
+	size     int // Bytes of the chunks received and of the slots for all of them
+	started  time.Time
+}
+
+// NewReassembler creates a reassembler with the given limits.
+func NewReassembler(maxTransfers, maxBytes int, timeout time.Duration) *Reassembler {
+	return &Reassembler{
+		MaxTransfers: maxTransfers,
+		MaxBytes:     maxBytes,
+		Timeout:      timeout,
+		transfers:    make(map[transferKey]*transfer),
+	}
+}
+
+// Add stores a fragment received from source (e.g. a peer ID). It returns the
+// reassembled message once every fragment has arrived, in any order, and nil
+// before that.
+func (r *Reassembler) Add(source string, f *Fragment) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.expire(now)
+
+	key := transferKey{source, f.ID}
+	t, ok := r.transfers[key]
+	if !ok {
+		slots := int(f.Count) * chunkSlotSize
+		if slots > r.MaxBytes {
+			return nil, ErrTransferTooLarge
+		}
+		t = &transfer{chunks: make([][]byte, f.Count), size: slots, started: now}
+		r.transfers[key] = t
+		r.buffered += slots
+	}
+	if int(f.Count) != len(t.chunks) {
+		r.drop(key)
+		return nil, fmt.Errorf("fragment count changed from %d to %d", len(t.chunks), f.Count)
+	}
+	if t.chunks[f.Index] != nil {
+		return nil, nil // Duplicate
+	}
+	if t.size+len(f.Chunk) > r.MaxBytes {
+		r.drop(key)
+		return nil, ErrTransferTooLarge
+	}
+
+	t.chunks[f.Index] = append([]byte{}, f.Chunk...)
+	t.received++
+	t.size += len(f.Chunk)
+	r.buffered += len(f.Chunk)
+
+	if t.received == len(t.chunks) {
+		r.drop(key)
+		data := make([]byte, 0, t.size-len(t.chunks)*chunkSlotSize)
+		for _, chunk := range t.chunks {
+			data = append(data, chunk...)
+		}
+		return data, nil
+	}
+
+	r.evict(key)
+	return nil, nil
+}
+
+// Forget discards the incomplete transfers of source, e.g. when a peer leaves.
+func (r *Reassembler) Forget(source string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key := range r.transfers {
+		if key.source == source {
+			r.drop(key)
+		}
+	}
+}
+
+// Pending returns the number of incomplete transfers and the bytes they hold.
+func (r *Reassembler) Pending() (transfers, bytes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.transfers), r.buffered
+}
+
+// expire drops transfers that did not complete within the timeout.
+func (r *Reassembler) expire(now time.Time) {
+	for key, t := range r.transfers {
+		if now.Sub(t.started) > r.Timeout {
+			r.drop(key)
+		}
+	}
+}
+
+// evict drops the oldest transfers, other than keep, until the limits are met.
+func (r *Reassembler) evict(keep transferKey) {
+	for len(r.transfers) > r.MaxTransfers || r.buffered > r.MaxBytes {
+		var oldest transferKey
+		var oldestStart time.Time
+		found := false
+		for key, t := range r.transfers {
+			if key != keep && (!found || t.started.Before(oldestStart)) {
+				oldest, oldestStart, found = key, t.started, true
+			}
+		}
+		if !found {
+			return
+		}
+		r.drop(oldest)
+	}
+}
+
+func (r *Reassembler) drop(key transferKey) {
+	if t, ok := r.transfers[key]; ok {
+		r.buffered -= t.size
+		delete(r.transfers, key)
+	}
+}
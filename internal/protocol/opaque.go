@@ -0,0 +1,49 @@
+package protocol
+
+import "errors"
+
+// maxFormatName bounds the name of an opaque format, e.g. a MIME type or X11 atom.
+const maxFormatName = 255
+
+// EncodeOpaque frames raw clipboard bytes with the name of their format, for an
+// envelope with FormatOpaque.
+// Layout: [Name Length (1b)] + [Name] + [Data]
+func EncodeOpaque(name string, data []byte) ([]byte, error) {
+	if name == "" || len(name) > maxFormatName {
+		return nil, errors.New("opaque format name must be 1-255 bytes")
+	}
+	body := make([]byte, 0, 1+len(name)+len(data))
+	body = append(body, byte(len(name)))
+	body = append(body, name...)
+	return append(body, data...), nil
+}
+
+// MIMEType returns the content type of a decrypted envelope body in the given
+// format, or "" if it can't be determined.
+func MIMEType(format Format, body []byte) string {
+	switch format {
+	case FormatText:
+		return "text/plain"
+	case FormatImage:
+		return "image/png"
+	case FormatOpaque:
+		name, _, err := DecodeOpaque(body)
+		if err != nil {
+			return ""
+		}
+		return name
+	}
+	return ""
+}
+
+// DecodeOpaque parses a body produced by EncodeOpaque.
+func DecodeOpaque(body []byte) (name string, data []byte, err error) {
+	if len(body) < 1 {
+		return "", nil, ErrTruncated
+	}
+	n := int(body[0])
+	if n == 0 || len(body) < 1+n {
+		return "", nil, errors.New("invalid opaque format name")
+	}
+	return string(body[1 : 1+n]), body[1+n:], nil
+}
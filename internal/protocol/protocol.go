@@ -0,0 +1,108 @@
+// Package protocol defines the framing of clipboard messages exchanged between
+// peers over the DataChannel (or the relay). Every message is an Envelope: a small
+// fixed header describing the content, followed by the encrypted payload.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Version is the envelope version produced by this build.
+const Version byte = 1
+
+// HeaderSize is the length of the fixed envelope header in bytes.
+const HeaderSize = 15
+
+// Flags describe how the payload of an envelope is encoded.
+type Flags byte
+
+const (
+	FlagBatch    Flags = 1 << iota // Payload holds several entries, see EncodeBatch
+	FlagFragment                   // Payload is a Fragment of a larger envelope
+)
+
+// Format identifies the kind of clipboard content carried by an envelope.
+//
+// Identifiers 1-127 are well-known formats this project defines and writes back
+// natively. 128-254 are reserved. FormatOpaque (255) carries any other format
+// verbatim, named inside the encrypted payload (see EncodeOpaque) so the server
+// never learns what kind of content is being synced.
+type Format byte
+
+const (
+	FormatText   Format = 1   // UTF-8 text
+	FormatImage  Format = 2   // PNG image
+	FormatOpaque Format = 255 // Named format passed through as raw bytes
+)
+
+var (
+	// ErrUnsupportedVersion is returned when an envelope has a version this build can't read.
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	// ErrTruncated is returned when an envelope is shorter than its header claims.
+	ErrTruncated = errors.New("envelope truncated")
+)
+
+// Envelope is a single message on the clipboard DataChannel.
+// Layout: [Version (1b)] + [Flags (1b)] + [Format (1b)] + [Sequence (8b)] + [Length (4b)] + [Payload]
+type Envelope struct {
+	Version byte
+	Flags   Flags
+	Format  Format
+	Seq     uint64 // Per-sender sequence number, incremented for every message
+	Payload []byte // Encrypted content
+}
+
+// Marshal serializes an envelope to bytes.
+func (e *Envelope) Marshal() ([]byte, error) {
+	if uint64(len(e.Payload)) > math.MaxUint32 {
+		return nil, fmt.Errorf("payload too large: %d bytes", len(e.Payload))
+	}
+
+	data := make([]byte, HeaderSize, HeaderSize+len(e.Payload))
+	data[0] = e.Version
+	data[1] = byte(e.Flags)
+	data[2] = byte(e.Format)
+	binary.BigEndian.PutUint64(data[3:11], e.Seq)
+	binary.BigEndian.PutUint32(data[11:15], uint32(len(e.Payload)))
+	return append(data, e.Payload...), nil
+}
+
+// AuthenticatedHeader returns the header fields a sender binds to the encrypted
+// payload as associated data: all but the payload length, which isn't known
+// until the payload is sealed.
+func (e *Envelope) AuthenticatedHeader() []byte {
+	data := make([]byte, 11)
+	data[0] = e.Version
+	data[1] = byte(e.Flags)
+	data[2] = byte(e.Format)
+	binary.BigEndian.PutUint64(data[3:11], e.Seq)
+	return data
+}
+
+// Unmarshal parses an envelope, checking its version and length.
+func Unmarshal(data []byte) (*Envelope, error) {
+	if len(data) < 1 {
+		return nil, ErrTruncated
+	}
+	if data[0] != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+	if len(data) < HeaderSize {
+		return nil, ErrTruncated
+	}
+
+	length := binary.BigEndian.Uint32(data[11:15])
+	if uint64(length) != uint64(len(data)-HeaderSize) {
+		return nil, ErrTruncated
+	}
+	return &Envelope{
+		Version: data[0],
+		Flags:   Flags(data[1]),
+		Format:  Format(data[2]),
+		Seq:     binary.BigEndian.Uint64(data[3:11]),
+		Payload: data[HeaderSize:],
+	}, nil
+}
@@ -0,0 +1,278 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// FuzzUnmarshal checks that untrusted envelopes never panic the parsers run on
+// them, and that valid envelopes survive a round trip.
+func FuzzUnmarshal(f *testing.F) {
+	for _, env := range []Envelope{
+		{Version: Version, Format: FormatText, Seq: 1, Payload: []byte("ciphertext")},
+		{Version: Version, Flags: FlagBatch, Format: FormatImage, Seq: 2},
+	} {
+		data, err := env.Marshal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	parts, err := Split(bytes.Repeat([]byte("x"), 64), 3, 32)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, part := range parts {
+		f.Add(part)
+	}
+	f.Add([]byte{})
+	f.Add([]byte{Version})
+	f.Add([]byte{Version, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		env, err := Unmarshal(data)
+		if err != nil {
+			if env != nil {
+				t.Fatalf("Unmarshal returned an envelope along with error %v", err)
+			}
+			return
+		}
+
+		out, err := env.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal of a parsed envelope failed: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Fatalf("round trip changed the envelope: %x != %x", out, data)
+		}
+
+		// The payload is parsed further depending on the flags
+		if env.Flags&FlagFragment != 0 {
+			if frag, err := UnmarshalFragment(env.Payload); err == nil {
+				NewReassembler(4, 1<<20, 0).Add("fuzz", frag)
+			}
+		}
+		DecodeBatch(env.Payload)
+		DecodeOpaque(env.Payload)
+		MIMEType(env.Format, env.Payload)
+	})
+}
+
+// fragments splits an envelope carrying payload into fragments of at most
+// maxSize bytes, and returns the envelope with its parsed fragments.
+func fragments(t *testing.T, id uint64, payload []byte, maxSize int) ([]byte, []*Fragment) {
+	t.Helper()
+	data, err := (&Envelope{Version: Version, Format: FormatText, Seq: id, Payload: payload}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := Split(data, id, maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frags []*Fragment
+	for _, part := range parts {
+		if len(part) > maxSize {
+			t.Fatalf("fragment of %d bytes, over the limit of %d", len(part), maxSize)
+		}
+		env, err := Unmarshal(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.Flags&FlagFragment == 0 {
+			t.Fatal("a part isn't flagged as a fragment")
+		}
+		frag, err := UnmarshalFragment(env.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frags = append(frags, frag)
+	}
+	return data, frags
+}
+
+func TestSplitFits(t *testing.T) {
+	data := []byte("small envelope")
+	parts, err := Split(data, 1, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 1 || !bytes.Equal(parts[0], data) {
+		t.Fatalf("split a message that fits into %d parts", len(parts))
+	}
+	if _, err := Split(bytes.Repeat([]byte("x"), 64), 1, HeaderSize+FragmentHeaderSize); err == nil {
+		t.Fatal("split with no room for a chunk succeeded")
+	}
+}
+
+func TestReassembleOutOfOrder(t *testing.T) {
+	data, frags := fragments(t, 7, bytes.Repeat([]byte("clipboard "), 1000), 1024)
+	if len(frags) < 3 {
+		t.Fatalf("split into %d fragments, want several", len(frags))
+	}
+
+	r := NewReassembler(4, 1<<20, time.Minute)
+	for i := len(frags) - 1; i >= 0; i-- {
+		got, err := r.Add("peer-a", frags[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && got != nil {
+			t.Fatalf("reassembled with %d fragments missing", i)
+		}
+		if i == 0 && !bytes.Equal(got, data) {
+			t.Fatal("the reassembled message differs from the original")
+		}
+	}
+	if len(r.transfers) != 0 || r.buffered != 0 {
+		t.Fatalf("%d transfers and %d bytes left after completion", len(r.transfers), r.buffered)
+	}
+}
+
+func TestReassembleInterleaved(t *testing.T) {
+	// Two transfers from one peer with their own IDs, and one from another peer
+	// reusing an ID
+	dataA, fragsA := fragments(t, 1, bytes.Repeat([]byte("a"), 3000), 1024)
+	dataB, fragsB := fragments(t, 2, bytes.Repeat([]byte("b"), 3000), 1024)
+	dataC, fragsC := fragments(t, 1, bytes.Repeat([]byte("c"), 3000), 1024)
+
+	r := NewReassembler(4, 1<<20, time.Minute)
+	got := make(map[string][]byte)
+	for i := range fragsA {
+		for _, tc := range []struct {
+			name   string
+			source string
+			frag   *Fragment
+		}{
+			{"a", "peer-a", fragsA[i]},
+			{"b", "peer-a", fragsB[len(fragsB)-1-i]},
+			{"c", "peer-b", fragsC[i]},
+		} {
+			data, err := r.Add(tc.source, tc.frag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data != nil {
+				got[tc.name] = data
+			}
+		}
+	}
+	if !bytes.Equal(got["a"], dataA) || !bytes.Equal(got["b"], dataB) || !bytes.Equal(got["c"], dataC) {
+		t.Fatal("interleaved transfers were mixed up")
+	}
+}
+
+func TestReassembleDuplicate(t *testing.T) {
+	data, frags := fragments(t, 1, bytes.Repeat([]byte("x"), 2000), 1024)
+	r := NewReassembler(4, 1<<20, time.Minute)
+	for _, frag := range []*Fragment{frags[0], frags[0]} {
+		if got, err := r.Add("peer-a", frag); got != nil || err != nil {
+			t.Fatalf("incomplete transfer returned %v, %v", got, err)
+		}
+	}
+	var got []byte
+	for _, frag := range frags[1:] {
+		var err error
+		if got, err = r.Add("peer-a", frag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("reassembly after a duplicate differs from the original")
+	}
+}
+
+func TestReassemblerDropsIncomplete(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		_, frags := fragments(t, 1, bytes.Repeat([]byte("x"), 3000), 1024)
+		r := NewReassembler(4, 1<<20, 50*time.Millisecond)
+		for _, frag := range frags[:len(frags)-1] {
+			r.Add("peer-a", frag)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		// The final fragment arrives too late, the transfer was discarded
+		got, err := r.Add("peer-a", frags[len(frags)-1])
+		if got != nil || err != nil {
+			t.Fatalf("late final fragment returned %v, %v; want nothing", got, err)
+		}
+		last := frags[len(frags)-1]
+		if r.buffered != len(last.Chunk)+int(last.Count)*chunkSlotSize {
+			t.Fatalf("%d bytes buffered, want only the late fragment", r.buffered)
+		}
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		_, fragsA := fragments(t, 1, bytes.Repeat([]byte("a"), 3000), 1024)
+		dataB, fragsB := fragments(t, 2, bytes.Repeat([]byte("b"), 3000), 1024)
+		r := NewReassembler(1, 1<<20, time.Minute)
+
+		r.Add("peer-a", fragsA[0])
+		// A second transfer exceeds MaxTransfers, the oldest one goes
+		var got []byte
+		for _, frag := range fragsB {
+			got, _ = r.Add("peer-a", frag)
+		}
+		if !bytes.Equal(got, dataB) {
+			t.Fatal("the newer transfer didn't complete")
+		}
+		for _, frag := range fragsA[1:] {
+			if got, _ := r.Add("peer-a", frag); got != nil {
+				t.Fatal("the evicted transfer completed")
+			}
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		_, frags := fragments(t, 1, bytes.Repeat([]byte("x"), 3000), 1024)
+		r := NewReassembler(4, 2000, time.Minute)
+		var err error
+		for _, frag := range frags {
+			if _, err = r.Add("peer-a", frag); err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, ErrTransferTooLarge) {
+			t.Fatalf("returned %v, want ErrTransferTooLarge", err)
+		}
+		if len(r.transfers) != 0 || r.buffered != 0 {
+			t.Fatalf("%d transfers and %d bytes left after dropping", len(r.transfers), r.buffered)
+		}
+	})
+
+	t.Run("forgotten", func(t *testing.T) {
+		_, frags := fragments(t, 1, bytes.Repeat([]byte("x"), 3000), 1024)
+		r := NewReassembler(4, 1<<20, time.Minute)
+		r.Add("peer-a", frags[0])
+		r.Add("peer-b", frags[0])
+		r.Forget("peer-a")
+		if len(r.transfers) != 1 || r.buffered != len(frags[0].Chunk)+int(frags[0].Count)*chunkSlotSize {
+			t.Fatalf("%d transfers and %d bytes left, want only peer-b's", len(r.transfers), r.buffered)
+		}
+	})
+
+	t.Run("empty fragments", func(t *testing.T) {
+		const maxBytes = 1 << 20
+		r := NewReassembler(16, maxBytes, time.Minute)
+		// Each transfer announces the most fragments and sends one empty one
+		for id := range uint64(64) {
+			_, err := r.Add("peer-a", &Fragment{ID: id, Index: 0, Count: math.MaxUint16})
+			if !errors.Is(err, ErrTransferTooLarge) {
+				t.Fatalf("a transfer of %d empty fragments returned %v, want ErrTransferTooLarge", math.MaxUint16, err)
+			}
+		}
+		// Fewer fit, but only as many as the budget pays for
+		for id := range uint64(64) {
+			r.Add("peer-a", &Fragment{ID: id, Index: 0, Count: 8192})
+			if r.buffered > maxBytes {
+				t.Fatalf("%d bytes accounted, over the limit of %d", r.buffered, maxBytes)
+			}
+		}
+		if want := maxBytes / (8192 * chunkSlotSize); len(r.transfers) != want {
+			t.Fatalf("%d transfers kept, want %d", len(r.transfers), want)
+		}
+	})
+}
@@ -0,0 +1,41 @@
+// Package redact decides how much of the clipboard content a log sink may show.
+// Clipboards often hold passwords and tokens, so every sink describes content
+// through a Policy instead of formatting it directly. The default policy only
+// reveals the size; content previews must be enabled explicitly per sink.
+package redact
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Policy controls whether a sink may include content previews.
+type Policy int
+
+const (
+	SizeOnly Policy = iota // Only the size of the content, the default
+	Preview                // The size and the first previewRunes characters
+)
+
+// previewRunes is the number of characters shown by the Preview policy.
+const previewRunes = 24
+
+// Describe returns a description of content that is safe for a sink with this policy.
+func (p Policy) Describe(content []byte) string {
+	size := fmt.Sprintf("%d bytes", len(content))
+	if p != Preview || len(content) == 0 {
+		return size
+	}
+
+	end := 0
+	for count := 0; end < len(content) && count < previewRunes; count++ {
+		_, n := utf8.DecodeRune(content[end:])
+		end += n
+	}
+	preview := strconv.Quote(string(content[:end]))
+	if end < len(content) {
+		preview += "…"
+	}
+	return size + " " + preview
+}
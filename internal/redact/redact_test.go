@@ -0,0 +1,31 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	long := strings.Repeat("a", previewRunes+1)
+	for _, tc := range []struct {
+		name    string
+		policy  Policy
+		content string
+		want    string
+	}{
+		{"size only", SizeOnly, "hunter2", "7 bytes"},
+		{"size only by default", Policy(0), "hunter2", "7 bytes"},
+		{"unknown policy", Policy(42), "hunter2", "7 bytes"},
+		{"preview", Preview, "hunter2", `7 bytes "hunter2"`},
+		{"preview of empty content", Preview, "", "0 bytes"},
+		{"truncated preview", Preview, long, `25 bytes "` + long[:previewRunes] + `"…`},
+		{"preview counts characters", Preview, strings.Repeat("é", previewRunes), `48 bytes "` + strings.Repeat("é", previewRunes) + `"`},
+		{"preview escapes control characters", Preview, "a\nb", `3 bytes "a\nb"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.policy.Describe([]byte(tc.content)); got != tc.want {
+				t.Fatalf("returned %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package signaling
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Server authentication: the client sends a random challenge in the "challenge"
+// query parameter and the server answers in the ServerProofHeader of the upgrade
+// response, proving it knows the pre-shared server secret.
+const (
+	ChallengeParam    = "challenge"
+	ServerProofHeader = "X-Server-Proof"
+)
+
+// RoomTokenParam is the query parameter carrying the room access token, which
+// the server checks before letting a peer into a room (see the server's
+// --room-token). It is unrelated to the encryption password.
+const RoomTokenParam = "room_token"
+
+// ServerProof returns the answer to challenge for the given server secret.
+func ServerProof(secret, challenge string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("clipboard-sync/server-proof/" + challenge))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyServerProof reports whether proof answers challenge for the given secret.
+func VerifyServerProof(secret, challenge, proof string) bool {
+	return hmac.Equal([]byte(ServerProof(secret, challenge)), []byte(proof))
+}
@@ -0,0 +1,82 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidMessage is wrapped by the errors returned by Message.Validate.
+var ErrInvalidMessage = errors.New("invalid signaling message")
+
+// NewJoin announces from to the room, or to a single peer if to is set (asking
+// it to initiate). commitment proves the key, see crypto.KeyCommitment.
+func NewJoin(from, to, commitment string) *Message {
+	return &Message{Type: TypeJoin, FromPeer: from, ToPeer: to, Payload: commitment}
+}
+
+// NewLeave announces that from leaves the room.
+func NewLeave(from string) *Message {
+	return &Message{Type: TypeLeave, FromPeer: from}
+}
+
+// NewOffer carries an SDP offer from one peer to another.
+func NewOffer(from, to, sdp string) *Message {
+	return &Message{Type: TypeOffer, FromPeer: from, ToPeer: to, Payload: sdp}
+}
+
+// NewAnswer carries an SDP answer from one peer to another.
+func NewAnswer(from, to, sdp string) *Message {
+	return &Message{Type: TypeAnswer, FromPeer: from, ToPeer: to, Payload: sdp}
+}
+
+// NewCandidate carries an ICE candidate, as JSON, from one peer to another.
+func NewCandidate(from, to, candidate string) *Message {
+	return &Message{Type: TypeCandidate, FromPeer: from, ToPeer: to, Payload: candidate}
+}
+
+// NewRelay carries a base64 encrypted payload to the whole room.
+func NewRelay(from, payload string) *Message {
+	return &Message{Type: TypeRelay, FromPeer: from, Payload: payload}
+}
+
+// NewAck acknowledges the message with ID id, received from to.
+func NewAck(from, to, id string) *Message {
+	return &Message{Type: TypeAck, FromPeer: from, ToPeer: to, Payload: id}
+}
+
+// NewPing is a heartbeat whose payload the peer echoes back in a pong.
+func NewPing(from, payload string) *Message {
+	return &Message{Type: TypePing, FromPeer: from, Payload: payload}
+}
+
+// NewPong answers a ping with its payload.
+func NewPong(from, payload string) *Message {
+	return &Message{Type: TypePong, FromPeer: from, Payload: payload}
+}
+
+// Validate checks that the message has a known type, a sender, and the fields
+// its type requires: offers, answers, candidates and acks go to a single peer
+// and need a payload, relays need a payload.
+func (m *Message) Validate() error {
+	if !KnownType(m.Type) {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidMessage, m.Type)
+	}
+	if m.FromPeer == "" {
+		return fmt.Errorf("%w: %s without a sender", ErrInvalidMessage, m.Type)
+	}
+
+	switch m.Type {
+	case TypeOffer, TypeAnswer, TypeCandidate, TypeAck:
+		if m.ToPeer == "" {
+			return fmt.Errorf("%w: %s without a recipient", ErrInvalidMessage, m.Type)
+		}
+		if m.Payload == "" {
+			return fmt.Errorf("%w: %s without a payload", ErrInvalidMessage, m.Type)
+		}
+	case TypeRelay:
+		if m.Payload == "" {
+			return fmt.Errorf("%w: %s without a payload", ErrInvalidMessage, m.Type)
+		}
+	}
+	return nil
+}
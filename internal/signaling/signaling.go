@@ -3,7 +3,11 @@
 // and connection establishment without carrying clipboard data.
 package signaling
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // Message types for signaling protocol
 const (
@@ -12,15 +16,59 @@ const (
 	TypeOffer     = "offer"     // WebRTC SDP offer
 	TypeAnswer    = "answer"    // WebRTC SDP answer
 	TypeCandidate = "candidate" // ICE candidate
+	TypeRelay     = "relay"     // Encrypted clipboard payload relayed through the server
+	TypePing      = "ping"      // Heartbeat over the control DataChannel, Payload is echoed back
+	TypePong      = "pong"      // Answer to a ping
+	TypeAck       = "ack"       // Acknowledges receipt of the message whose ID is the Payload
+)
+
+// Protocol versions. Version 2 added message IDs, timestamps, acks and
+// heartbeats; messages without a Version are version 1. Version 3 changed the
+// DataChannel payloads to the protocol envelope and crypto header v3, which
+// older peers can't read nor write, so they are no longer interoperable.
+//
+// Two peers talk when their ranges of versions overlap, at the highest version
+// both speak. A newer peer whose MinVersion is at most our ProtocolVersion
+// therefore still talks to us; it is up to the newer side to speak down.
+const (
+	ProtocolVersion    = 3 // Version spoken by this build
+	MinProtocolVersion = 3 // Oldest version this build interoperates with
 )
 
+// VersionHeader is set by the server on the upgrade response to the range of
+// protocol versions it supports, as "min-max".
+const VersionHeader = "X-Signaling-Versions"
+
+// DefaultMaxMessageSize is the default upper bound, in bytes, for a single
+// signaling message read from a WebSocket. SDP offers and answers with all
+// gathered candidates are a few KB, so this leaves plenty of headroom while
+// preventing a peer from exhausting memory with a gigantic frame.
+const DefaultMaxMessageSize int64 = 256 << 10
+
+// MaxMessageSizeHeader is set by the server on the upgrade response to the
+// largest message, in bytes, it reads from a client; larger ones get the client
+// disconnected.
+const MaxMessageSizeHeader = "X-Signaling-Max-Message-Size"
+
 // Message represents a signaling message sent over WebSocket.
 // The server broadcasts these messages to other peers in the same room.
 type Message struct {
-	Type     string `json:"type"`              // Message type (join, leave, offer, answer, candidate)
-	FromPeer string `json:"from"`              // Sender's peer ID
-	ToPeer   string `json:"to,omitempty"`      // Target peer ID (empty = broadcast to all)
-	Payload  string `json:"payload,omitempty"` // SDP or ICE candidate JSON
+	Version    int    `json:"v,omitempty"`       // Sender's protocol version, absent for version 1
+	MinVersion int    `json:"min_v,omitempty"`   // Oldest version the sender still speaks, absent if only Version
+	ID         string `json:"id,omitempty"`      // Unique message ID, referenced by acks
+	Type       string `json:"type"`              // Message type (join, leave, offer, answer, candidate)
+	FromPeer   string `json:"from"`              // Sender's peer ID
+	ToPeer     string `json:"to,omitempty"`      // Target peer ID (empty = broadcast to all)
+	Payload    string `json:"payload,omitempty"` // SDP, ICE candidate JSON or base64 relayed data
+
+	// Resume marks the join of a peer reconnecting to the server after its
+	// signaling connection dropped. Peers still connected to it keep their
+	// connection rather than negotiating a new one.
+	Resume bool `json:"resume,omitempty"`
+
+	// Timestamp is when the message was sent, in Unix milliseconds. Zero for
+	// messages from builds that predate it.
+	Timestamp int64 `json:"ts,omitempty"`
 }
 
 // Marshal serializes a signaling message to JSON bytes.
@@ -36,3 +84,65 @@ func Unmarshal(data []byte) (*Message, error) {
 	}
 	return &msg, nil
 }
+
+// Stale reports whether the message was sent more than maxAge before now, or
+// claims to be from more than maxAge in the future, as a replayed message would.
+// Messages without a Timestamp are never stale, neither is anything when maxAge
+// is zero.
+func (m *Message) Stale(now time.Time, maxAge time.Duration) bool {
+	if m.Timestamp == 0 || maxAge <= 0 {
+		return false
+	}
+	age := now.Sub(time.UnixMilli(m.Timestamp))
+	return age > maxAge || age < -maxAge
+}
+
+// Negotiate returns the version this build talks to a peer that speaks version
+// down to minVersion, as found in its messages, and whether the two ranges
+// overlap at all. A zero version stands for a message without a Version, a zero
+// minVersion for a peer that only speaks version.
+func Negotiate(version, minVersion int) (int, bool) {
+	if version == 0 {
+		version = 1
+	}
+	if minVersion == 0 || minVersion > version {
+		minVersion = version
+	}
+	common := min(version, ProtocolVersion)
+	return common, common >= max(minVersion, MinProtocolVersion)
+}
+
+// IsCompatible reports whether this build can talk to a peer, see Negotiate.
+func IsCompatible(version, minVersion int) bool {
+	_, ok := Negotiate(version, minVersion)
+	return ok
+}
+
+// VersionRange formats the supported versions for VersionHeader.
+func VersionRange() string {
+	return fmt.Sprintf("%d-%d", MinProtocolVersion, ProtocolVersion)
+}
+
+// ParseVersionRange parses a VersionHeader value.
+func ParseVersionRange(value string) (minVersion, maxVersion int, err error) {
+	if _, err := fmt.Sscanf(value, "%d-%d", &minVersion, &maxVersion); err != nil {
+		return 0, 0, fmt.Errorf("invalid version range %q", value)
+	}
+	return minVersion, maxVersion, nil
+}
+
+// KnownType reports whether t is one of the message types above.
+func KnownType(t string) bool {
+	switch t {
+	case TypeJoin, TypeLeave, TypeOffer, TypeAnswer, TypeCandidate, TypeRelay, TypePing, TypePong, TypeAck:
+		return true
+	}
+	return false
+}
+
+// ShouldInitiate decides which of two peers sends the offer, so that both sides
+// agree without negotiating. The peer with the lower ID (byte-wise) initiates.
+// Identical IDs should never happen; neither side initiates then.
+func ShouldInitiate(localID, remoteID string) bool {
+	return localID < remoteID
+}
@@ -0,0 +1,251 @@
+package signaling
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// FuzzUnmarshal checks that untrusted signaling messages never panic the parser
+// or the validation the hub and clients run on them, and that valid messages
+// survive a round trip.
+func FuzzUnmarshal(f *testing.F) {
+	for _, msg := range []*Message{
+		NewJoin("peer-a", "", "commitment"),
+		NewOffer("peer-a", "peer-b", "v=0"),
+		NewCandidate("peer-a", "peer-b", "candidate:1 1 udp 1 127.0.0.1 9 typ host"),
+		NewRelay("peer-a", "cGF5bG9hZA=="),
+	} {
+		data, err := msg.Marshal()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte(""))
+	f.Add([]byte("null"))
+	f.Add([]byte(`{"type":"offer","from":1}`))
+	f.Add([]byte{0xff, 0x00, '{'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := Unmarshal(data)
+		if err != nil {
+			if msg != nil {
+				t.Fatalf("Unmarshal returned a message along with error %v", err)
+			}
+			return
+		}
+		if msg.Validate() != nil {
+			return
+		}
+
+		out, err := msg.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal of a valid message failed: %v", err)
+		}
+		again, err := Unmarshal(out)
+		if err != nil {
+			t.Fatalf("Unmarshal of a marshalled message failed: %v", err)
+		}
+		if !reflect.DeepEqual(msg, again) {
+			t.Fatalf("round trip changed the message: %+v != %+v", msg, again)
+		}
+	})
+}
+
+func TestServerProof(t *testing.T) {
+	proof := ServerProof("secret", "challenge")
+	for _, tc := range []struct {
+		name                      string
+		secret, challenge, answer string
+		ok                        bool
+	}{
+		{"matching", "secret", "challenge", proof, true},
+		{"other secret", "other", "challenge", proof, false},
+		{"replayed for another challenge", "secret", "other challenge", proof, false},
+		{"truncated", "secret", "challenge", proof[:32], false},
+		{"missing", "secret", "challenge", "", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := VerifyServerProof(tc.secret, tc.challenge, tc.answer); got != tc.ok {
+				t.Fatalf("VerifyServerProof returned %v, want %v", got, tc.ok)
+			}
+		})
+	}
+}
+
+func TestShouldInitiate(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		local, remote string
+		want          bool
+	}{
+		{"lower", "peer-a", "peer-b", true},
+		{"higher", "peer-b", "peer-a", false},
+		{"prefix", "peer", "peer-a", true},
+		{"shorter but higher", "z", "peer-a", false},
+		{"longer but lower", "a-very-long-id", "b", true},
+		{"case", "Peer", "peer", true},
+		{"non-ASCII", "peer-é", "peer-z", false},
+		{"empty", "", "peer-a", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ShouldInitiate(tc.local, tc.remote); got != tc.want {
+				t.Fatalf("returned %v, want %v", got, tc.want)
+			}
+			// Both sides must agree: exactly one of them initiates
+			if other := ShouldInitiate(tc.remote, tc.local); other == tc.want {
+				t.Fatalf("the remote side also returned %v", other)
+			}
+		})
+	}
+
+	// Identical IDs are impossible in a room; neither side initiates then
+	if ShouldInitiate("peer-a", "peer-a") {
+		t.Fatal("a peer initiates with its own ID")
+	}
+}
+
+func TestPingPongRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		msg  *Message
+		typ  string
+	}{
+		{"ping", NewPing("peer-a", "1700000000000000000"), TypePing},
+		{"pong", NewPong("peer-b", "1700000000000000000"), TypePong},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.msg.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Unmarshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := got.Validate(); err != nil {
+				t.Fatalf("invalid after a round trip: %v", err)
+			}
+			if got.Type != tc.typ || got.FromPeer != tc.msg.FromPeer || got.Payload != tc.msg.Payload {
+				t.Fatalf("round trip returned %+v, want %+v", got, tc.msg)
+			}
+		})
+	}
+}
+
+func TestMessageTimestamp(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	for _, tc := range []struct {
+		name      string
+		json      string
+		timestamp int64
+		stale     bool // Beyond a minute from now
+	}{
+		{"timestamp", `{"type":"offer","from":"peer-a","to":"peer-b","payload":"v=0","ts":1700000000000}`, 1700000000000, false},
+		{"without a timestamp", `{"type":"offer","from":"peer-a","to":"peer-b","payload":"v=0"}`, 0, false},
+		{"stale", `{"type":"offer","from":"peer-a","to":"peer-b","payload":"v=0","ts":1699999900000}`, 1699999900000, true},
+		{"from the future", `{"type":"offer","from":"peer-a","to":"peer-b","payload":"v=0","ts":1700000100000}`, 1700000100000, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := Unmarshal([]byte(tc.json))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Timestamp != tc.timestamp {
+				t.Fatalf("timestamp %d, want %d", msg.Timestamp, tc.timestamp)
+			}
+			if stale := msg.Stale(now, time.Minute); stale != tc.stale {
+				t.Fatalf("stale: %v, want %v", stale, tc.stale)
+			}
+			if msg.Stale(now, 0) {
+				t.Fatal("stale with no maximum age")
+			}
+
+			// Marshaling keeps the timestamp, and leaves it out when absent
+			data, err := msg.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tc.json {
+				t.Fatalf("marshaled to %s, want %s", data, tc.json)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		version, minVersion int
+		common              int
+		ok                  bool
+	}{
+		{"same version", ProtocolVersion, MinProtocolVersion, ProtocolVersion, true},
+		{"same version without a minimum", ProtocolVersion, 0, ProtocolVersion, true},
+		// Releases before version 3 can't read the DataChannel payloads
+		{"no version", 0, 0, 1, false},
+		{"version 1", 1, 0, 1, false},
+		{"version 2", 2, 0, 2, false},
+		// A newer peer still speaking our version talks at ours
+		{"newer, speaking ours", ProtocolVersion + 1, ProtocolVersion, ProtocolVersion, true},
+		{"newer, without a minimum", ProtocolVersion + 1, 0, ProtocolVersion, false},
+		{"newer, past ours", ProtocolVersion + 2, ProtocolVersion + 1, ProtocolVersion, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			common, ok := Negotiate(tc.version, tc.minVersion)
+			if common != tc.common || ok != tc.ok {
+				t.Fatalf("Negotiate(%d, %d) = %d, %v; want %d, %v", tc.version, tc.minVersion, common, ok, tc.common, tc.ok)
+			}
+			if IsCompatible(tc.version, tc.minVersion) != tc.ok {
+				t.Fatalf("IsCompatible disagrees with Negotiate")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		msg   *Message
+		valid bool
+	}{
+		{"join", NewJoin("peer-a", "", "commitment"), true},
+		{"targeted join", NewJoin("peer-a", "peer-b", "commitment"), true},
+		{"join without a commitment", NewJoin("peer-a", "", ""), true},
+		{"leave", NewLeave("peer-a"), true},
+		{"offer", NewOffer("peer-a", "peer-b", "v=0"), true},
+		{"offer without a recipient", NewOffer("peer-a", "", "v=0"), false},
+		{"offer without an SDP", NewOffer("peer-a", "peer-b", ""), false},
+		{"answer", NewAnswer("peer-a", "peer-b", "v=0"), true},
+		{"answer without a recipient", NewAnswer("peer-a", "", "v=0"), false},
+		{"answer without an SDP", NewAnswer("peer-a", "peer-b", ""), false},
+		{"candidate", NewCandidate("peer-a", "peer-b", "{}"), true},
+		{"candidate without a recipient", NewCandidate("peer-a", "", "{}"), false},
+		{"candidate without a payload", NewCandidate("peer-a", "peer-b", ""), false},
+		{"relay", NewRelay("peer-a", "cGF5bG9hZA=="), true},
+		{"relay without a payload", NewRelay("peer-a", ""), false},
+		{"ack", NewAck("peer-a", "peer-b", "id"), true},
+		{"ack without a recipient", NewAck("peer-a", "", "id"), false},
+		{"ack without an ID", NewAck("peer-a", "peer-b", ""), false},
+		{"ping", NewPing("peer-a", "1"), true},
+		{"pong", NewPong("peer-a", "1"), true},
+		{"without a sender", NewOffer("", "peer-b", "v=0"), false},
+		{"unknown type", &Message{Type: "bogus", FromPeer: "peer-a"}, false},
+		{"without a type", &Message{FromPeer: "peer-a"}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.msg.Validate()
+			if tc.valid {
+				if err != nil {
+					t.Fatalf("returned %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidMessage) {
+				t.Fatalf("returned %v, want an ErrInvalidMessage", err)
+			}
+		})
+	}
+}
@@ -3,36 +3,43 @@ package utils
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 )
 
-// PrintLocalIPs prints the interfaces on which the server is going to be listening on.
+// LocalWSAddresses returns the WebSocket URLs under which other machines on the
+// network can reach the server, one per IPv4 address of every interface that
+// is up, in interface order. Loopback addresses are left out.
 //
 // Parameters:
+//   - scheme: "ws", or "wss" when serving over TLS
 //   - port: includes the ':' before the actual port number
-func PrintLocalIPs(port string) {
-	fmt.Println(">> Available Network Addresses:")
-
+func LocalWSAddresses(scheme, port string) ([]string, error) {
 	interfaces, err := net.Interfaces()
 	if err != nil {
-		log.Printf("Error getting interfaces: %v", err)
-		return
+		return nil, fmt.Errorf("list network interfaces: %w", err)
 	}
+	return wsAddresses(scheme, port, interfaces, (*net.Interface).Addrs), nil
+}
 
-	for _, iface := range interfaces {
+// wsAddresses is LocalWSAddresses for the given interfaces, whose addresses are
+// listed by addrs.
+func wsAddresses(scheme, port string, interfaces []net.Interface, addrs func(*net.Interface) ([]net.Addr, error)) []string {
+	var urls []string
+	for i := range interfaces {
+		iface := &interfaces[i]
 		// Skip interfaces which are down or loopback interfaces (eg. localhost)
 		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
 			continue
 		}
 
 		// Get addresses for these interfaces
-		addrs, err := iface.Addrs()
+		ifaceAddrs, err := addrs(iface)
 		if err != nil {
 			continue
 		}
 
-		for _, addr := range addrs {
+		for _, addr := range ifaceAddrs {
 			var ip net.IP
 			switch v := addr.(type) {
 			case *net.IPNet:
@@ -41,7 +48,7 @@ func PrintLocalIPs(port string) {
 				ip = v.IP
 			}
 
-			// Print only IPv4 addresses
+			// Keep only IPv4 addresses
 			if ip == nil || ip.IsLoopback() {
 				continue
 			}
@@ -50,10 +57,25 @@ func PrintLocalIPs(port string) {
 				continue
 			}
 
-			fmt.Printf("    - ws://%s%s/ws\n", ip.String(), port)
+			urls = append(urls, fmt.Sprintf("%s://%s%s/ws", scheme, ip.String(), port))
 		}
+	}
+	return urls
+}
 
+// PrintLocalIPs prints the addresses returned by LocalWSAddresses, followed by
+// the localhost address.
+func PrintLocalIPs(scheme, port string) {
+	fmt.Println(">> Available Network Addresses:")
+
+	urls, err := LocalWSAddresses(scheme, port)
+	if err != nil {
+		slog.Error("Failed to list network addresses", "err", err)
+		return
+	}
+	for _, url := range urls {
+		fmt.Printf("    - %s\n", url)
 	}
-	fmt.Printf("    - ws://localhost%s/ws (Local only)\n", port)
+	fmt.Printf("    - %s://localhost%s/ws (Local only)\n", scheme, port)
 	fmt.Println("----------------------------------------------")
 }
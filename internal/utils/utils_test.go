@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+)
+
+// ipNet returns the address of an interface with the given CIDR notation.
+func ipNet(t *testing.T, cidr string) net.Addr {
+	t.Helper()
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ipnet.IP = ip
+	return ipnet
+}
+
+func TestWSAddresses(t *testing.T) {
+	interfaces := []net.Interface{
+		{Index: 1, Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+		{Index: 2, Name: "eth0", Flags: net.FlagUp},
+		{Index: 3, Name: "docker0"}, // Down
+		{Index: 4, Name: "wlan0", Flags: net.FlagUp},
+		{Index: 5, Name: "tun0", Flags: net.FlagUp},
+	}
+	addrs := map[string][]net.Addr{
+		"lo": {ipNet(t, "127.0.0.1/8"), ipNet(t, "::1/128")},
+		"eth0": {
+			ipNet(t, "192.168.1.10/24"),
+			ipNet(t, "fe80::1/64"),
+			ipNet(t, "127.0.0.2/8"),
+			&net.IPAddr{IP: net.ParseIP("10.0.0.5")},
+		},
+		"docker0": {ipNet(t, "172.17.0.1/16")},
+		"wlan0":   {ipNet(t, "2001:db8::5/64"), ipNet(t, "192.168.2.20/24")},
+	}
+	listAddrs := func(iface *net.Interface) ([]net.Addr, error) {
+		if iface.Name == "tun0" {
+			return nil, errors.New("permission denied")
+		}
+		return addrs[iface.Name], nil
+	}
+
+	got := wsAddresses("wss", ":8080", interfaces, listAddrs)
+	want := []string{
+		"wss://192.168.1.10:8080/ws",
+		"wss://10.0.0.5:8080/ws",
+		"wss://192.168.2.20:8080/ws",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestWSAddressesNone(t *testing.T) {
+	interfaces := []net.Interface{{Name: "lo", Flags: net.FlagUp | net.FlagLoopback}}
+	listAddrs := func(*net.Interface) ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.IPv4(127, 0, 0, 1), Mask: net.CIDRMask(8, 32)}}, nil
+	}
+	if got := wsAddresses("ws", ":8080", interfaces, listAddrs); len(got) != 0 {
+		t.Fatalf("got %q with only a loopback interface, want none", got)
+	}
+}
@@ -1,34 +1,149 @@
 // Package wsserver implements the WebSocket signaling server for P2P clipboard sync.
 // It functions as a matchmaker that accepts connections, manages rooms for device
 // discovery, and broadcasts signaling messages (offers, answers, ICE candidates)
-// between clients. No clipboard data flows through this server.
+// between clients. Clipboard data only flows through it when clients relay
+// payloads (the client's -relay-threshold), and then only encrypted.
 package wsserver
 
 import (
-	"log"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
-}
+// Keepalive defaults, see Hub.PingInterval and Hub.PongTimeout.
+const (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPongTimeout  = 60 * time.Second
+)
+
+// DefaultWriteTimeout is the default Hub.WriteTimeout.
+const DefaultWriteTimeout = 10 * time.Second
+
+// DuplicatePolicy is the value of Hub.DuplicatePeers.
+type DuplicatePolicy string
+
+const (
+	// DuplicateReplace closes the existing connection and registers the new one.
+	DuplicateReplace DuplicatePolicy = "replace"
+	// DuplicateReject refuses the new connection and keeps the existing one.
+	DuplicateReject DuplicatePolicy = "reject"
+)
+
+// controlWriteWait bounds how long sending a ping or close frame may block.
+const controlWriteWait = 10 * time.Second
 
 // Hub manages rooms and client connections.
 type Hub struct {
-	rooms map[string]map[string]*websocket.Conn // stores all the connected clients within the same room.
-	mu    sync.Mutex                            // Protects the map from concurrent access.
+	// MaxMessageSize is the largest signaling message (in bytes) accepted from a client.
+	// Connections sending anything larger are closed.
+	MaxMessageSize int64
+
+	// PublisherToken, if set, lets a peer joining with a matching publisher_token
+	// query parameter become the single publisher of its room. The room is then
+	// read-only for everyone else: their signaling only reaches the publisher and
+	// their relayed payloads are dropped.
+	PublisherToken string
+
+	// ServerSecret, if set, is used to answer the challenge of clients that verify
+	// they are talking to the intended server (see signaling.ServerProof).
+	ServerSecret string
+
+	// PingInterval is how often each connection is pinged; a connection that
+	// sends nothing, not even a pong, for PongTimeout is closed and its peer
+	// removed. This reaps connections silently dropped by NATs and firewalls.
+	// Zero disables keepalive.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+
+	// WriteTimeout bounds how long relaying a message to a peer may block. A
+	// peer that doesn't read fast enough is disconnected, so it can't stall the
+	// peers sending to it for longer. Zero means no limit.
+	WriteTimeout time.Duration
+
+	// RoomToken, if set, must be presented by peers in the signaling.RoomTokenParam
+	// query parameter to join any room that has no entry in RoomTokens. Peers
+	// without the right token are refused with a close frame.
+	RoomToken string
+	// RoomTokens holds the token of individual rooms, by room ID. It takes
+	// precedence over RoomToken.
+	RoomTokens map[string]string
+
+	// AdminToken, if set, must be presented by requests to HandleRooms.
+	AdminToken string
+
+	// ConnectionsPerMinute limits how many connections a single remote IP may
+	// open per minute, bursts included; excess upgrades get 429 Too Many
+	// Requests. Loopback is exempt. Zero means unlimited.
+	ConnectionsPerMinute int
+
+	// AllowedOrigins restricts which web pages may open a connection, matched
+	// against the Origin header browsers send. Entries are origins such as
+	// "https://app.example.com" or hosts such as "localhost:3000", and may use
+	// "*" wildcards ("https://*.example.com"). Requests without an Origin
+	// header, like those of the native client, are always accepted. Empty
+	// allows every origin.
+	AllowedOrigins []string
+
+	// DuplicatePeers decides what happens when a peer joins a room under a
+	// peer_id that is already connected, typically a client reconnecting before
+	// its dead connection was reaped. Defaults to DuplicateReplace.
+	DuplicatePeers DuplicatePolicy
+
+	// Logger receives the hub's log events, slog.Default() when nil. Events
+	// about a peer carry "room" and "peer" attributes.
+	Logger *slog.Logger
+
+	// MaxPeersPerRoom caps how many peers a room holds, since every signaling
+	// broadcast goes to all of them. Joins beyond it are refused with a close
+	// frame. Zero means unlimited.
+	MaxPeersPerRoom int
+
+	rooms      map[string]map[string]*peer // stores all the connected clients within the same room.
+	publishers map[string]string           // Publisher peer ID of each read-only room ("" while it is away).
+	closing    bool                        // Set by Shutdown, new connections are refused.
+	mu         sync.Mutex                  // Protects the maps from concurrent access.
+
+	limiter     *connLimiter // Created on first use from ConnectionsPerMinute.
+	limiterOnce sync.Once
+}
+
+// logger returns the logger for the hub's events.
+func (h *Hub) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
+
+// peer is a client connected to a room.
+type peer struct {
+	id          string // The peer_id it registered with, its messages must be from it.
+	conn        *websocket.Conn
+	writeMu     sync.Mutex // Serializes messages to conn, which allows one writer at a time.
+	connectedAt time.Time
 }
 
 // NewHub creates a new thread-safe hub.
 func NewHub() *Hub {
 	return &Hub{
-		rooms: make(map[string]map[string]*websocket.Conn),
+		MaxMessageSize: signaling.DefaultMaxMessageSize,
+		PingInterval:   DefaultPingInterval,
+		PongTimeout:    DefaultPongTimeout,
+		WriteTimeout:   DefaultWriteTimeout,
+		DuplicatePeers: DuplicateReplace,
+		rooms:          make(map[string]map[string]*peer),
+		publishers:     make(map[string]string),
 	}
 }
 
@@ -36,12 +151,38 @@ func (h *Hub) HandleConnections(w http.ResponseWriter, r *http.Request) {
 	// Upgrade the connection from HTTP GET request to a WebSocket connection.
 	// Hijacks the underlying TCP socket used for establishing the HTTP request which only
 	// communicates using WebSocket frames.
-	ws, err := upgrader.Upgrade(w, r, nil)
+	h.mu.Lock()
+	closing := h.closing
+	h.mu.Unlock()
+	if closing {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	// Checked before upgrading so a flood costs as little as possible
+	if !h.allowConnection(r) {
+		h.logger().Warn("Connection rejected, too many per minute", "ip", remoteIP(r), "limit", h.ConnectionsPerMinute)
+		http.Error(w, "too many connections", http.StatusTooManyRequests)
+		return
+	}
+
+	header := http.Header{
+		signaling.VersionHeader:        {signaling.VersionRange()},
+		signaling.MaxMessageSizeHeader: {strconv.FormatInt(h.MaxMessageSize, 10)},
+	}
+	if challenge := r.URL.Query().Get(signaling.ChallengeParam); challenge != "" && h.ServerSecret != "" {
+		header.Set(signaling.ServerProofHeader, signaling.ServerProof(h.ServerSecret, challenge))
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: h.checkOrigin}
+	ws, err := upgrader.Upgrade(w, r, header)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		h.logger().Warn("Upgrade failed", "err", err)
 		return
 	}
 
+	// Limit the size of incoming frames so a malicious client can't exhaust memory.
+	// gorilla/websocket replies with a "message too big" close frame when exceeded.
+	ws.SetReadLimit(h.MaxMessageSize)
+
 	// Identify the room
 	roomID := r.URL.Query().Get("room")
 	if roomID == "" {
@@ -51,73 +192,321 @@ func (h *Hub) HandleConnections(w http.ResponseWriter, r *http.Request) {
 	// Identify the peer
 	peerID := r.URL.Query().Get("peer_id")
 	if peerID == "" {
-		log.Println("Connection rejected: Missing peer_id")
+		h.logger().Warn("Connection rejected, missing peer_id")
 		ws.Close()
 		return
 	}
 
+	if !h.roomTokenValid(roomID, r.URL.Query().Get(signaling.RoomTokenParam)) {
+		h.logger().Warn("Peer rejected, invalid room token", "room", roomID, "peer", peerID)
+		closeWith(ws, websocket.ClosePolicyViolation, "invalid room token")
+		return
+	}
+
 	// Register the client with their peer id
 	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		ws.Close()
+		return
+	}
+	existing := h.rooms[roomID][peerID]
+	if existing != nil && h.DuplicatePeers == DuplicateReject {
+		h.mu.Unlock()
+		h.logger().Warn("Peer rejected, already connected", "room", roomID, "peer", peerID)
+		closeWith(ws, websocket.ClosePolicyViolation, "peer_id is already connected to this room")
+		return
+	}
+	if h.roomFull(roomID, peerID) {
+		h.mu.Unlock()
+		h.logger().Warn("Peer rejected, room is full", "room", roomID, "peer", peerID, "limit", h.MaxPeersPerRoom)
+		closeWith(ws, websocket.CloseTryAgainLater, fmt.Sprintf("room is full (%d peers)", h.MaxPeersPerRoom))
+		return
+	}
+	if existing != nil {
+		// Unregister it like any departing peer, so a publisher slot it held is
+		// free for the new connection to claim
+		h.removePeer(roomID, peerID)
+	}
 	if h.rooms[roomID] == nil {
-		h.rooms[roomID] = make(map[string]*websocket.Conn)
+		h.rooms[roomID] = make(map[string]*peer)
 	}
-	h.rooms[roomID][peerID] = ws
+	self := &peer{id: peerID, conn: ws, connectedAt: time.Now()}
+	h.rooms[roomID][peerID] = self
+	isPublisher := h.claimPublisher(roomID, peerID, r.URL.Query().Get("publisher_token"))
 	h.mu.Unlock()
 
-	log.Printf("[Room: %s] Peer: %s connected", roomID, peerID)
+	if existing != nil {
+		h.logger().Info("Peer reconnected, closing its previous connection", "room", roomID, "peer", peerID)
+		closeWith(existing.conn, websocket.ClosePolicyViolation, "replaced by a newer connection with the same peer_id")
+	}
+
+	h.logger().Info("Peer connected", "room", roomID, "peer", peerID)
+	if isPublisher {
+		h.logger().Info("Peer is the publisher, room is read-only", "room", roomID, "peer", peerID)
+	}
 
 	// Cleanup on exit
 	defer func() {
 		h.mu.Lock()
-		if _, ok := h.rooms[roomID][peerID]; ok {
-			delete(h.rooms[roomID], peerID)
-			// Cleanup empty rooms
-			if len(h.rooms[roomID]) == 0 {
-				delete(h.rooms, roomID)
-			}
+		if h.rooms[roomID][peerID] == self {
+			h.removePeer(roomID, peerID)
 		}
 		h.mu.Unlock()
 		ws.Close()
-		log.Printf("[Room: %s] Device disconnected", roomID)
+		h.logger().Info("Peer disconnected", "room", roomID, "peer", peerID)
 	}()
 
+	if h.PingInterval > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		h.keepAlive(ws, stop)
+	}
+
 	// Watch for changes from client and broadcast them.
 	for {
 		messageType, msg, err := ws.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.Is(err, websocket.ErrReadLimit) {
+				h.logger().Warn("Peer closed, message too large", "room", roomID, "peer", peerID, "limit", h.MaxMessageSize)
+			} else if errors.As(err, &netErr) && netErr.Timeout() {
+				h.logger().Warn("Peer closed, no response", "room", roomID, "peer", peerID, "timeout", h.PongTimeout)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				h.logger().Warn("Peer closed abruptly", "room", roomID, "peer", peerID, "err", err)
+			}
 			break
 		}
-		h.broadcast(roomID, ws, messageType, msg)
+		h.extendDeadline(ws)
+		h.broadcast(roomID, self, messageType, msg)
+	}
+}
+
+// keepAlive pings ws every PingInterval until stop is closed, and makes reads
+// fail once the peer stays silent for PongTimeout.
+func (h *Hub) keepAlive(ws *websocket.Conn, stop <-chan struct{}) {
+	h.extendDeadline(ws)
+	ws.SetPongHandler(func(string) error {
+		h.extendDeadline(ws)
+		return nil
+	})
+
+	go func() {
+		ticker := time.NewTicker(h.PingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// WriteControl may be called concurrently with the broadcast writes
+				if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(controlWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// extendDeadline gives the peer another PongTimeout to send something.
+func (h *Hub) extendDeadline(ws *websocket.Conn) {
+	if h.PingInterval > 0 {
+		ws.SetReadDeadline(time.Now().Add(h.PongTimeout))
 	}
 }
 
-func (h *Hub) broadcast(roomID string, sender *websocket.Conn, messageType int, msg []byte) {
+// Shutdown refuses new connections and sends every peer a close frame, then
+// waits until all of them have disconnected. Once ctx is done, the remaining
+// connections are closed abruptly and ctx's error is returned.
+func (h *Hub) Shutdown(ctx context.Context) error {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.closing = true
+	var peers []*peer
+	for _, room := range h.rooms {
+		for _, p := range room {
+			peers = append(peers, p)
+		}
+	}
+	h.mu.Unlock()
 
-	// Try and parse the signalling message to check for specific target requirements.
-	signallingMsg, err := signaling.Unmarshal(msg)
+	// Outside the lock, so stalled peers don't hold up the rest of the hub
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, p := range peers {
+		p.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(controlWriteWait))
+	}
 
-	// If parsing succeeds and ToPeer is set, then only send the message to that peer.
-	if err == nil && signallingMsg.ToPeer != "" {
-		if targetConn, exists := h.rooms[roomID][signallingMsg.ToPeer]; exists {
-			if err := targetConn.WriteMessage(messageType, msg); err != nil {
-				log.Printf("peer disconnected with id: %s: %v", signallingMsg.ToPeer, err)
-				targetConn.Close()
-				delete(h.rooms[roomID], signallingMsg.ToPeer)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		h.mu.Lock()
+		drained := len(h.rooms) == 0
+		h.mu.Unlock()
+		if drained {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			h.mu.Lock()
+			var conns []*websocket.Conn
+			for roomID, room := range h.rooms {
+				for peerID, p := range room {
+					conns = append(conns, p.conn)
+					h.removePeer(roomID, peerID)
+				}
+			}
+			h.mu.Unlock()
+			for _, conn := range conns {
+				conn.Close()
 			}
+			return ctx.Err()
 		}
+	}
+}
+
+// closeWith sends ws a close frame with code and reason, then closes it.
+func closeWith(ws *websocket.Conn, code int, reason string) {
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(controlWriteWait))
+	ws.Close()
+}
+
+// removePeer unregisters a peer and deletes its room once empty. Must be called
+// with h.mu held.
+func (h *Hub) removePeer(roomID, peerID string) {
+	delete(h.rooms[roomID], peerID)
+	// The room stays read-only, another peer with the token may take over
+	if h.publishers[roomID] == peerID {
+		h.publishers[roomID] = ""
+	}
+	// Cleanup empty rooms
+	if len(h.rooms[roomID]) == 0 {
+		delete(h.rooms, roomID)
+		delete(h.publishers, roomID)
+	}
+}
+
+// roomTokenValid reports whether token grants access to roomID.
+func (h *Hub) roomTokenValid(roomID, token string) bool {
+	want, ok := h.RoomTokens[roomID]
+	if !ok {
+		want = h.RoomToken
+	}
+	if want == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// roomFull reports whether peerID joining roomID would exceed MaxPeersPerRoom.
+// A peer reconnecting under an ID already in the room takes its own slot back.
+// Must be called with h.mu held.
+func (h *Hub) roomFull(roomID, peerID string) bool {
+	if h.MaxPeersPerRoom <= 0 {
+		return false
+	}
+	if _, rejoining := h.rooms[roomID][peerID]; rejoining {
+		return false
+	}
+	return len(h.rooms[roomID]) >= h.MaxPeersPerRoom
+}
+
+// claimPublisher makes peerID the publisher of roomID if token matches and the
+// room has no publisher connected. Must be called with h.mu held.
+func (h *Hub) claimPublisher(roomID, peerID, token string) bool {
+	if h.PublisherToken == "" || token == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.PublisherToken)) != 1 {
+		h.logger().Warn("Peer presented an invalid publisher token", "room", roomID, "peer", peerID)
+		return false
+	}
+	if publisher, readOnly := h.publishers[roomID]; readOnly && publisher != "" {
+		h.logger().Warn("Peer can't publish, the room already has a publisher", "room", roomID, "peer", peerID, "publisher", publisher)
+		return false
+	}
+	h.publishers[roomID] = peerID
+	return true
+}
+
+func (h *Hub) broadcast(roomID string, sender *peer, messageType int, msg []byte) {
+	// Only relay well-formed signaling, peers shouldn't have to cope with garbage
+	signallingMsg, err := signaling.Unmarshal(msg)
+	if err != nil {
+		h.logger().Warn("Dropped an invalid message", "room", roomID, "peer", sender.id, "err", err)
+		return
+	}
+	if err := signallingMsg.Validate(); err != nil {
+		h.logger().Warn("Dropped an invalid message", "room", roomID, "peer", sender.id, "err", err)
+		return
+	}
+	// A peer may only speak for itself, otherwise it could impersonate others
+	if signallingMsg.FromPeer != sender.id {
+		h.logger().Warn("Dropped a message claiming another sender", "room", roomID, "peer", sender.id, "claimed", signallingMsg.FromPeer)
 		return
 	}
 
+	// Writing happens after releasing the lock, so a peer that stops reading
+	// holds up only the peers sending to it, not every room.
+	for _, p := range h.recipients(roomID, sender, signallingMsg) {
+		h.write(roomID, p, messageType, msg)
+	}
+}
+
+// recipients returns the peers of roomID that msg from sender is relayed to.
+func (h *Hub) recipients(roomID string, sender *peer, msg *signaling.Message) []*peer {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	target := msg.ToPeer
+	// In a read-only room, subscribers may only talk to the publisher so they never
+	// connect to each other, and may not push data through the relay.
+	if publisher, readOnly := h.publishers[roomID]; readOnly && sender.id != publisher {
+		if msg.Type == signaling.TypeRelay || publisher == "" {
+			return nil
+		}
+		if target != "" && target != publisher {
+			return nil
+		}
+		target = publisher
+	}
+
+	// If a target is set, then only send the message to that peer.
+	if target != "" {
+		if targetPeer, exists := h.rooms[roomID][target]; exists {
+			return []*peer{targetPeer}
+		}
+		return nil
+	}
+
 	// If no specific target, send to everyone (except sender)
+	recipients := make([]*peer, 0, len(h.rooms[roomID]))
 	for _, client := range h.rooms[roomID] {
-		if client == sender {
-			continue
-		}
-		if err := client.WriteMessage(messageType, msg); err != nil {
-			log.Printf("Write error: %v", err)
-			client.Close()
+		if client != sender {
+			recipients = append(recipients, client)
 		}
 	}
+	return recipients
+}
+
+// write sends msg to p, giving up after WriteTimeout. A peer whose write fails
+// is disconnected and removed from roomID.
+func (h *Hub) write(roomID string, p *peer, messageType int, msg []byte) {
+	p.writeMu.Lock()
+	if h.WriteTimeout > 0 {
+		p.conn.SetWriteDeadline(time.Now().Add(h.WriteTimeout))
+	}
+	err := p.conn.WriteMessage(messageType, msg)
+	p.writeMu.Unlock()
+	if err == nil {
+		return
+	}
+
+	h.logger().Warn("Write failed, disconnecting peer", "room", roomID, "peer", p.id, "err", err)
+	p.conn.Close()
+	h.mu.Lock()
+	if h.rooms[roomID][p.id] == p {
+		h.removePeer(roomID, p.id)
+	}
+	h.mu.Unlock()
 }
@@ -0,0 +1,629 @@
+package wsserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Pujan-khunt/clipboard-sync/internal/signaling"
+	"github.com/gorilla/websocket"
+)
+
+// newTestHub starts a hub behind an httptest server, closed when the test ends.
+func newTestHub(t *testing.T) (*Hub, *httptest.Server) {
+	t.Helper()
+	hub := NewHub()
+	hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	srv := httptest.NewServer(http.HandlerFunc(hub.HandleConnections))
+	t.Cleanup(srv.Close)
+	return hub, srv
+}
+
+// join connects peerID to the default room of the hub behind srv, and waits
+// until the hub has registered it.
+func join(t *testing.T, hub *Hub, srv *httptest.Server, peerID string) *websocket.Conn {
+	t.Helper()
+	return joinWith(t, hub, srv, url.Values{"peer_id": {peerID}})
+}
+
+// joinWith is like join with the query parameters of the connection.
+func joinWith(t *testing.T, hub *Hub, srv *httptest.Server, query url.Values) *websocket.Conn {
+	t.Helper()
+	peerID, roomID := query.Get("peer_id"), query.Get("room")
+	if roomID == "" {
+		roomID = "default"
+	}
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?" + query.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for deadline := time.Now().Add(time.Second); !registered(hub, roomID, peerID); {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never joined the room", peerID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+// inRoom reports whether peerID is registered in the default room.
+func inRoom(hub *Hub, peerID string) bool {
+	return registered(hub, "default", peerID)
+}
+
+// registered reports whether peerID is registered in roomID.
+func registered(hub *Hub, roomID, peerID string) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	_, ok := hub.rooms[roomID][peerID]
+	return ok
+}
+
+// send writes msg to conn.
+func send(t *testing.T, conn *websocket.Conn, msg *signaling.Message) {
+	t.Helper()
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive reads the next message from conn, or returns the read error.
+func receive(conn *websocket.Conn, timeout time.Duration) (*signaling.Message, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return signaling.Unmarshal(data)
+}
+
+func TestHubRelaysSignaling(t *testing.T) {
+	hub, srv := newTestHub(t)
+	a := join(t, hub, srv, "peer-a")
+	b := join(t, hub, srv, "peer-b")
+
+	send(t, a, signaling.NewOffer("peer-a", "peer-b", "v=0"))
+	msg, err := receive(b, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != signaling.TypeOffer || msg.FromPeer != "peer-a" {
+		t.Fatalf("received %s from %s, want an offer from peer-a", msg.Type, msg.FromPeer)
+	}
+}
+
+func TestHubClosesOversizedMessage(t *testing.T) {
+	hub, srv := newTestHub(t)
+	hub.MaxMessageSize = 1 << 10
+	a := join(t, hub, srv, "peer-a")
+	b := join(t, hub, srv, "peer-b")
+
+	send(t, a, signaling.NewOffer("peer-a", "peer-b", strings.Repeat("x", 2<<10)))
+
+	_, err := receive(a, time.Second)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseMessageTooBig {
+		t.Fatalf("sender read %v, want a close frame with code %d (message too big)", err, websocket.CloseMessageTooBig)
+	}
+	for deadline := time.Now().Add(time.Second); inRoom(hub, "peer-a"); {
+		if time.Now().After(deadline) {
+			t.Fatal("the sender is still in the room")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if msg, err := receive(b, 100*time.Millisecond); err == nil {
+		t.Fatalf("the oversized message reached the other peer as %s", msg.Type)
+	}
+}
+
+func TestHubDropsInvalidMessages(t *testing.T) {
+	hub, srv := newTestHub(t)
+	a := join(t, hub, srv, "peer-a")
+	b := join(t, hub, srv, "peer-b")
+
+	for _, raw := range []string{
+		`{"type":"bogus","from":"peer-a","to":"peer-b"}`,
+		`{"type":"offer","to":"peer-b","payload":"v=0"}`,
+		`{"type":"offer","from":"peer-c","to":"peer-b","payload":"v=0"}`,
+		`not json`,
+	} {
+		if err := a.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Invalid messages are dropped without disconnecting the sender, so a valid
+	// one sent afterwards is the first to arrive
+	send(t, a, signaling.NewOffer("peer-a", "peer-b", "v=0"))
+	msg, err := receive(b, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != signaling.TypeOffer || msg.FromPeer != "peer-a" || msg.Payload != "v=0" {
+		t.Fatalf("received %+v, want the valid offer from peer-a", msg)
+	}
+}
+
+func TestHubReadOnlyRoom(t *testing.T) {
+	hub, srv := newTestHub(t)
+	hub.PublisherToken = "secret"
+	pub := joinWith(t, hub, srv, url.Values{"peer_id": {"publisher"}, "publisher_token": {"secret"}})
+	sub1 := join(t, hub, srv, "sub-1")
+	sub2 := join(t, hub, srv, "sub-2")
+
+	// The publisher reaches every subscriber
+	send(t, pub, signaling.NewRelay("publisher", "cGF5bG9hZA=="))
+	for _, sub := range []*websocket.Conn{sub1, sub2} {
+		if msg, err := receive(sub, time.Second); err != nil || msg.Type != signaling.TypeRelay {
+			t.Fatalf("subscriber received %v, %v; want the publisher's relay", msg, err)
+		}
+	}
+
+	// A subscriber can't relay data, and its broadcasts only reach the publisher
+	send(t, sub1, signaling.NewRelay("sub-1", "cGF5bG9hZA=="))
+	send(t, sub1, signaling.NewOffer("sub-1", "sub-2", "v=0"))
+	send(t, sub1, signaling.NewJoin("sub-1", "", "commitment"))
+	if msg, err := receive(sub2, 100*time.Millisecond); err == nil {
+		t.Fatalf("a subscriber received %s from another subscriber", msg.Type)
+	}
+	msg, err := receive(pub, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != signaling.TypeJoin || msg.FromPeer != "sub-1" {
+		t.Fatalf("publisher received %s from %s, want only the join of sub-1", msg.Type, msg.FromPeer)
+	}
+	if msg, err := receive(pub, 100*time.Millisecond); err == nil {
+		t.Fatalf("publisher also received %s", msg.Type)
+	}
+}
+
+func TestHubEvictsStalledPeer(t *testing.T) {
+	hub, srv := newTestHub(t)
+	hub.MaxMessageSize = 1 << 20
+	hub.WriteTimeout = time.Second
+	sender := join(t, hub, srv, "sender")
+	join(t, hub, srv, "stalled") // Never reads
+	a := joinWith(t, hub, srv, url.Values{"peer_id": {"peer-a"}, "room": {"other"}})
+	b := joinWith(t, hub, srv, url.Values{"peer_id": {"peer-b"}, "room": {"other"}})
+
+	// Flood the stalled peer until its socket buffers are full and a write to
+	// it blocks
+	flood, err := signaling.NewOffer("sender", "stalled", strings.Repeat("x", 512<<10)).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for sender.WriteMessage(websocket.TextMessage, flood) == nil {
+		}
+	}()
+
+	// The other room keeps flowing while the write to the stalled peer blocks
+	for start := time.Now(); time.Since(start) < 2*hub.WriteTimeout; {
+		send(t, a, signaling.NewOffer("peer-a", "peer-b", "v=0"))
+		if _, err := receive(b, hub.WriteTimeout/2); err != nil {
+			t.Fatalf("the other room stalled: %v", err)
+		}
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); inRoom(hub, "stalled"); {
+		if time.Now().After(deadline) {
+			t.Fatal("the stalled peer is still in the room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHubReapsUnresponsivePeer(t *testing.T) {
+	hub, srv := newTestHub(t)
+	hub.PingInterval = 50 * time.Millisecond
+	hub.PongTimeout = 200 * time.Millisecond
+	// gorilla answers pings while reading, so only the peer that reads sends pongs
+	alive := join(t, hub, srv, "alive")
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	join(t, hub, srv, "silent")
+
+	start := time.Now()
+	for inRoom(hub, "silent") {
+		if time.Since(start) > hub.PongTimeout+time.Second {
+			t.Fatal("the unresponsive peer wasn't reaped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if time.Since(start) < hub.PongTimeout/2 {
+		t.Fatalf("the unresponsive peer was reaped after %s, before its pong timeout", time.Since(start))
+	}
+
+	// Several pings later, the peer answering them is still there
+	time.Sleep(2 * hub.PongTimeout)
+	if !inRoom(hub, "alive") {
+		t.Fatal("the peer answering pings was reaped")
+	}
+}
+
+// closeCode reads conn until it fails, and sends the code of the close frame it
+// received on the returned channel, or -1 if it failed some other way.
+func closeCode(conn *websocket.Conn) <-chan int {
+	code := make(chan int, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					code <- closeErr.Code
+				} else {
+					code <- -1
+				}
+				return
+			}
+		}
+	}()
+	return code
+}
+
+func TestHubShutdown(t *testing.T) {
+	hub, srv := newTestHub(t)
+	a := join(t, hub, srv, "peer-a")
+	b := join(t, hub, srv, "peer-b")
+	// Reading answers the hub's close frame, which completes the handshake
+	codes := []<-chan int{closeCode(a), closeCode(b)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned %v, want nil once every peer left", err)
+	}
+	for _, code := range codes {
+		if c := <-code; c != websocket.CloseGoingAway {
+			t.Fatalf("peer received close code %d, want %d (going away)", c, websocket.CloseGoingAway)
+		}
+	}
+	if rooms := hub.snapshotRooms().Rooms; len(rooms) != 0 {
+		t.Fatalf("%d rooms left after Shutdown", len(rooms))
+	}
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?peer_id=late"
+	_, resp, err := websocket.DefaultDialer.Dial(u, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("connecting after Shutdown returned %v, want status %d", err, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHubShutdownTimeout(t *testing.T) {
+	hub, srv := newTestHub(t)
+	join(t, hub, srv, "peer-a") // Never reads, so never answers the close frame
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := hub.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown returned %v, want context.DeadlineExceeded", err)
+	}
+	if inRoom(hub, "peer-a") {
+		t.Fatal("the peer is still registered after Shutdown gave up")
+	}
+}
+
+func TestHubMaxPeersPerRoom(t *testing.T) {
+	hub, srv := newTestHub(t)
+	hub.MaxPeersPerRoom = 2
+	a := join(t, hub, srv, "peer-a")
+	b := join(t, hub, srv, "peer-b")
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?peer_id=peer-c"
+	c, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, err = receive(c, time.Second)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater || closeErr.Text != "room is full (2 peers)" {
+		t.Fatalf("the peer over the limit read %v, want a close frame saying the room is full", err)
+	}
+	if inRoom(hub, "peer-c") {
+		t.Fatal("the peer over the limit was registered")
+	}
+
+	// The peers already in the room are unaffected
+	send(t, a, signaling.NewOffer("peer-a", "peer-b", "v=0"))
+	if _, err := receive(b, time.Second); err != nil {
+		t.Fatalf("peers in the full room can't talk: %v", err)
+	}
+
+	// A peer leaving frees its slot
+	b.Close()
+	for deadline := time.Now().Add(time.Second); inRoom(hub, "peer-b"); {
+		if time.Now().After(deadline) {
+			t.Fatal("peer-b never left the room")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	join(t, hub, srv, "peer-c")
+}
+
+// syncBuffer is a bytes.Buffer safe for the hub to log to while a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHubCloseHandshake(t *testing.T) {
+	hub, srv := newTestHub(t)
+	var logs syncBuffer
+	hub.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	graceful := join(t, hub, srv, "graceful")
+	abrupt := join(t, hub, srv, "abrupt")
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := graceful.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// The hub completes the handshake by echoing the close code
+	_, err := receive(graceful, time.Second)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseNormalClosure {
+		t.Fatalf("read %v after closing, want a close frame with code %d (normal closure)", err, websocket.CloseNormalClosure)
+	}
+	abrupt.Close()
+
+	for deadline := time.Now().Add(time.Second); inRoom(hub, "graceful") || inRoom(hub, "abrupt"); {
+		if time.Now().After(deadline) {
+			t.Fatal("the peers never left the room")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "peer=graceful") && strings.Contains(line, "level=WARN") {
+			t.Fatalf("the graceful close was logged as a problem: %s", line)
+		}
+	}
+	if !strings.Contains(logs.String(), `msg="Peer closed abruptly" room=default peer=abrupt`) {
+		t.Fatalf("the abrupt close wasn't reported:\n%s", logs.String())
+	}
+}
+
+// closedPeer returns a peer whose connection is already closed, so every write
+// to it fails.
+func closedPeer(t *testing.T, id string) *peer {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn := <-conns
+	conn.Close()
+	return &peer{id: id, conn: conn, connectedAt: time.Now()}
+}
+
+func TestHubFailedWriteCleansUpRoom(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		others    []string // Peers left in the room besides the failing one
+		publisher bool     // Whether the failing peer is the room's publisher
+		kept      bool     // Whether the room survives
+	}{
+		{"only peer", nil, false, false},
+		{"only peer, publisher", nil, true, false},
+		{"other peers left", []string{"peer-b"}, false, true},
+		{"other peers left, publisher", []string{"peer-b"}, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := NewHub()
+			hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			failing := closedPeer(t, "peer-a")
+			hub.rooms["room"] = map[string]*peer{failing.id: failing}
+			for _, id := range tc.others {
+				hub.rooms["room"][id] = &peer{id: id}
+			}
+			if tc.publisher {
+				hub.publishers["room"] = failing.id
+			}
+
+			hub.write("room", failing, websocket.TextMessage, []byte("{}"))
+
+			hub.mu.Lock()
+			defer hub.mu.Unlock()
+			if _, ok := hub.rooms["room"][failing.id]; ok {
+				t.Fatal("the peer whose write failed is still in the room")
+			}
+			if _, ok := hub.rooms["room"]; ok != tc.kept {
+				t.Fatalf("room kept: %v, want %v", ok, tc.kept)
+			}
+			publisher, readOnly := hub.publishers["room"]
+			if publisher == failing.id {
+				t.Fatal("the peer whose write failed is still the publisher")
+			}
+			if readOnly != (tc.publisher && tc.kept) {
+				t.Fatalf("room read-only: %v, want %v", readOnly, tc.publisher && tc.kept)
+			}
+		})
+	}
+}
+
+func TestHubSpoofedSender(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		from    string // FromPeer claimed by peer-a
+		relayed bool
+	}{
+		{"own id", "peer-a", true},
+		{"peer in the room", "peer-c", false},
+		{"recipient", "peer-b", false},
+		{"unknown peer", "peer-z", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub, srv := newTestHub(t)
+			var logs syncBuffer
+			hub.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+			a := join(t, hub, srv, "peer-a")
+			b := join(t, hub, srv, "peer-b")
+			join(t, hub, srv, "peer-c")
+
+			send(t, a, signaling.NewOffer(tc.from, "peer-b", "v=0"))
+			msg, err := receive(b, 200*time.Millisecond)
+			if !tc.relayed {
+				if err == nil {
+					t.Fatalf("relayed %s claiming to be from %s", msg.Type, msg.FromPeer)
+				}
+				if !strings.Contains(logs.String(), "claiming another sender") {
+					t.Fatalf("the spoofed sender wasn't logged: %q", logs.String())
+				}
+				if !inRoom(hub, "peer-a") {
+					t.Fatal("the spoofing peer was disconnected, its message alone should be dropped")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.FromPeer != tc.from {
+				t.Fatalf("received a message from %s, want %s", msg.FromPeer, tc.from)
+			}
+		})
+	}
+}
+
+func TestHubDuplicatePeers(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy DuplicatePolicy
+		keeps  string // Which connection of peer-a survives: "first" or "second"
+	}{
+		{"replace", DuplicateReplace, "second"},
+		{"reject", DuplicateReject, "first"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub, srv := newTestHub(t)
+			hub.DuplicatePeers = tc.policy
+			b := join(t, hub, srv, "peer-b")
+			conns := map[string]*websocket.Conn{
+				"first":  join(t, hub, srv, "peer-a"),
+				"second": join(t, hub, srv, "peer-a"),
+			}
+			orphaned := conns["first"]
+			if tc.keeps == "first" {
+				orphaned = conns["second"]
+			}
+			closed := closeCode(orphaned)
+			select {
+			case code := <-closed:
+				if code != websocket.ClosePolicyViolation {
+					t.Fatalf("the orphaned connection was closed with %d, want %d", code, websocket.ClosePolicyViolation)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("the orphaned connection is still open")
+			}
+
+			// Once the orphaned connection is gone, the room holds both peers and
+			// routes to the surviving connection
+			time.Sleep(100 * time.Millisecond)
+			hub.mu.Lock()
+			peers := len(hub.rooms["default"])
+			hub.mu.Unlock()
+			if peers != 2 {
+				t.Fatalf("the room holds %d peers, want 2", peers)
+			}
+			send(t, b, signaling.NewOffer("peer-b", "peer-a", "v=0"))
+			msg, err := receive(conns[tc.keeps], time.Second)
+			if err != nil {
+				t.Fatalf("the %s connection didn't receive the offer: %v", tc.keeps, err)
+			}
+			if msg.FromPeer != "peer-b" {
+				t.Fatalf("received a message from %s, want peer-b", msg.FromPeer)
+			}
+		})
+	}
+}
+
+func TestHubRoomTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		shared     string            // Hub.RoomToken
+		perRoom    map[string]string // Hub.RoomTokens
+		room, sent string
+		accepted   bool
+	}{
+		{"no token required", "", nil, "room", "", true},
+		{"shared token", "secret", nil, "room", "secret", true},
+		{"wrong shared token", "secret", nil, "room", "guess", false},
+		{"missing token", "secret", nil, "room", "", false},
+		{"room token", "", map[string]string{"room": "room-secret"}, "room", "room-secret", true},
+		{"room token wins over the shared one", "secret", map[string]string{"room": "room-secret"}, "room", "secret", false},
+		{"other room takes the shared token", "secret", map[string]string{"room": "room-secret"}, "other", "secret", true},
+		{"token of another room", "", map[string]string{"room": "room-secret", "other": "other-secret"}, "other", "room-secret", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub, srv := newTestHub(t)
+			hub.RoomToken, hub.RoomTokens = tc.shared, tc.perRoom
+
+			query := url.Values{"peer_id": {"peer-a"}, "room": {tc.room}}
+			if tc.sent != "" {
+				query.Set(signaling.RoomTokenParam, tc.sent)
+			}
+			if tc.accepted {
+				joinWith(t, hub, srv, query)
+				return
+			}
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/?"+query.Encode(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			select {
+			case code := <-closeCode(conn):
+				if code != websocket.ClosePolicyViolation {
+					t.Fatalf("closed with %d, want %d", code, websocket.ClosePolicyViolation)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("a peer with an invalid room token wasn't refused")
+			}
+			if registered(hub, tc.room, "peer-a") {
+				t.Fatal("a peer with an invalid room token joined the room")
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package wsserver
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// checkOrigin is the upgrader's CheckOrigin, applying AllowedOrigins.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(h.AllowedOrigins) == 0 || origin == "" {
+		return true
+	}
+	if originAllowed(h.AllowedOrigins, origin) {
+		return true
+	}
+	h.logger().Warn("Connection rejected, origin not allowed", "origin", origin)
+	return false
+}
+
+// originAllowed reports whether origin matches one of patterns, either in full
+// or, for patterns without a scheme, by host.
+func originAllowed(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	host := origin
+	if u, err := url.Parse(origin); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*" {
+			return true
+		}
+		target := origin
+		if !strings.Contains(pattern, "://") {
+			target = host
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package wsserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHubAllowedOrigins(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{"empty flag allows all", nil, "https://evil.example", true},
+		{"no origin header", []string{"https://app.example"}, "", true},
+		{"exact origin", []string{"https://app.example"}, "https://app.example", true},
+		{"case insensitive", []string{"https://App.Example"}, "https://app.EXAMPLE", true},
+		{"other scheme", []string{"https://app.example"}, "http://app.example", false},
+		{"disallowed origin", []string{"https://app.example"}, "https://evil.example", false},
+		{"host pattern", []string{"app.example"}, "http://app.example", true},
+		{"wildcard subdomain", []string{"*.example.com"}, "https://app.example.com", true},
+		{"wildcard doesn't match the parent", []string{"*.example.com"}, "https://example.com", false},
+		{"wildcard doesn't match a suffix", []string{"*.example.com"}, "https://app.example.com.evil", false},
+		{"star", []string{"*"}, "https://anything.example", true},
+		{"one of several", []string{"https://a.example", " https://b.example "}, "https://b.example", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := NewHub()
+			hub.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+			hub.AllowedOrigins = tc.allowed
+			srv := httptest.NewServer(http.HandlerFunc(hub.HandleConnections))
+			t.Cleanup(srv.Close)
+
+			header := http.Header{}
+			if tc.origin != "" {
+				header.Set("Origin", tc.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?peer_id=peer-a", header)
+			if err == nil {
+				conn.Close()
+			}
+			if ok := err == nil; ok != tc.ok {
+				t.Fatalf("connected: %v, want %v (%v)", ok, tc.ok, err)
+			}
+			if !tc.ok && resp != nil && resp.StatusCode != http.StatusForbidden {
+				t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+}
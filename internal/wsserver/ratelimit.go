@@ -0,0 +1,78 @@
+package wsserver
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// connLimiter keeps a token bucket per remote IP: each IP may open perMinute
+// connections at once, then regains them at perMinute per minute.
+type connLimiter struct {
+	limit     rate.Limit
+	burst     int
+	limiters  map[string]*rate.Limiter
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+// newConnLimiter allows perMinute connections per IP and minute.
+func newConnLimiter(perMinute int) *connLimiter {
+	return &connLimiter{
+		// A rate per second rather than an interval, which any perMinute
+		// above a minute's nanoseconds would round down to zero
+		limit:    rate.Limit(float64(perMinute) / time.Minute.Seconds()),
+		burst:    perMinute,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// allow reports whether ip may open another connection now, and takes a token if so.
+func (l *connLimiter) allow(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget the IPs whose bucket has refilled, a flood from many addresses
+	// shouldn't grow the map forever
+	if now.Sub(l.lastSweep) > time.Minute {
+		for key, lim := range l.limiters {
+			if lim.TokensAt(now) >= float64(l.burst) {
+				delete(l.limiters, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	lim, ok := l.limiters[ip]
+	if !ok {
+		lim = rate.NewLimiter(l.limit, l.burst)
+		l.limiters[ip] = lim
+	}
+	return lim.AllowN(now, 1)
+}
+
+// remoteIP is the IP address r comes from. Proxy headers are not trusted.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// allowConnection applies ConnectionsPerMinute to r. Loopback is never limited.
+func (h *Hub) allowConnection(r *http.Request) bool {
+	if h.ConnectionsPerMinute <= 0 {
+		return true
+	}
+	ip := remoteIP(r)
+	if ip == nil || ip.IsLoopback() {
+		return true
+	}
+
+	h.limiterOnce.Do(func() { h.limiter = newConnLimiter(h.ConnectionsPerMinute) })
+	return h.limiter.allow(ip.String(), time.Now())
+}
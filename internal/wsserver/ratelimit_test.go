@@ -0,0 +1,91 @@
+package wsserver
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConnLimiter(t *testing.T) {
+	start := time.Now()
+	for _, tc := range []struct {
+		name    string
+		at      []time.Duration // When each connection from the IP is attempted
+		allowed int
+	}{
+		{"burst", []time.Duration{0, 0, 0}, 3},
+		{"over the burst", []time.Duration{0, 0, 0, 0, 0}, 3},
+		{"refilled", []time.Duration{0, 0, 0, 0, 20 * time.Second}, 4},
+		{"fully refilled", []time.Duration{0, 0, 0, time.Minute, time.Minute, time.Minute}, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newConnLimiter(3)
+			allowed := 0
+			for _, at := range tc.at {
+				if l.allow("192.0.2.1", start.Add(at)) {
+					allowed++
+				}
+			}
+			if allowed != tc.allowed {
+				t.Fatalf("allowed %d connections, want %d", allowed, tc.allowed)
+			}
+		})
+	}
+
+	// More per minute than a minute has nanoseconds
+	l := newConnLimiter(math.MaxInt32 * 100)
+	for range 1000 {
+		if !l.allow("192.0.2.1", start) {
+			t.Fatal("a very large limit refused a connection")
+		}
+	}
+}
+
+func TestHubConnectionsPerMinute(t *testing.T) {
+	const limit = 5
+	for _, tc := range []struct {
+		name    string
+		first   string // Floods the hub
+		second  string // Connects once the first was refused
+		limited bool   // Whether the first is refused
+	}{
+		{"other IP unaffected", "192.0.2.1:1000", "192.0.2.2:1000", true},
+		{"same IP on another port", "192.0.2.1:1000", "192.0.2.1:2000", true},
+		{"IPv6", "[2001:db8::1]:1000", "[2001:db8::2]:1000", true},
+		{"loopback", "127.0.0.1:1000", "[::1]:1000", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub, _ := newTestHub(t)
+			hub.ConnectionsPerMinute = limit
+
+			// A request that isn't refused fails the upgrade instead, with 400
+			connect := func(remoteAddr string) int {
+				r := httptest.NewRequest(http.MethodGet, "/ws?peer_id=peer-a", nil)
+				r.RemoteAddr = remoteAddr
+				w := httptest.NewRecorder()
+				hub.HandleConnections(w, r)
+				return w.Code
+			}
+			refused := 0
+			for range 2 * limit {
+				if connect(tc.first) == http.StatusTooManyRequests {
+					refused++
+				}
+			}
+			want := 0
+			if tc.limited {
+				want = limit
+			}
+			if refused != want {
+				t.Fatalf("refused %d of %d connections, want %d", refused, 2*limit, want)
+			}
+
+			sameIP := remoteIP(&http.Request{RemoteAddr: tc.first}).Equal(remoteIP(&http.Request{RemoteAddr: tc.second}))
+			if got := connect(tc.second) == http.StatusTooManyRequests; got != (tc.limited && sameIP) {
+				t.Fatalf("%s refused: %v, want %v", tc.second, got, tc.limited && sameIP)
+			}
+		})
+	}
+}
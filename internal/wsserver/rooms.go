@@ -0,0 +1,65 @@
+package wsserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AdminTokenHeader carries the Hub.AdminToken on requests to HandleRooms.
+const AdminTokenHeader = "X-Admin-Token"
+
+// RoomsResponse is the JSON body served by HandleRooms.
+type RoomsResponse struct {
+	Rooms []RoomInfo `json:"rooms"`
+}
+
+// RoomInfo describes an active room. Peer IDs are left out on purpose, the
+// endpoint is for operating the server, not for finding out who is connected.
+type RoomInfo struct {
+	Room        string      `json:"room"`
+	Peers       int         `json:"peers"`
+	ConnectedAt []time.Time `json:"connected_at"` // When each peer connected, oldest first.
+}
+
+// HandleRooms serves the active rooms and their peer counts as JSON. If
+// AdminToken is set, requests must present it in the AdminTokenHeader header.
+func (h *Hub) HandleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.AdminToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get(AdminTokenHeader)), []byte(h.AdminToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.snapshotRooms()); err != nil {
+		h.logger().Warn("Failed to write the /rooms response", "err", err)
+	}
+}
+
+// snapshotRooms copies what HandleRooms needs while holding h.mu, leaving the
+// sorting and encoding until after it is released.
+func (h *Hub) snapshotRooms() RoomsResponse {
+	h.mu.Lock()
+	resp := RoomsResponse{Rooms: make([]RoomInfo, 0, len(h.rooms))}
+	for roomID, room := range h.rooms {
+		info := RoomInfo{Room: roomID, Peers: len(room), ConnectedAt: make([]time.Time, 0, len(room))}
+		for _, p := range room {
+			info.ConnectedAt = append(info.ConnectedAt, p.connectedAt)
+		}
+		resp.Rooms = append(resp.Rooms, info)
+	}
+	h.mu.Unlock()
+
+	slices.SortFunc(resp.Rooms, func(a, b RoomInfo) int { return strings.Compare(a.Room, b.Room) })
+	for _, info := range resp.Rooms {
+		slices.SortFunc(info.ConnectedAt, time.Time.Compare)
+	}
+	return resp
+}
@@ -0,0 +1,86 @@
+package wsserver
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHubRooms(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		adminToken string
+		method     string
+		header     string // Sent in AdminTokenHeader
+		status     int
+	}{
+		{"open", "", http.MethodGet, "", http.StatusOK},
+		{"token", "admin", http.MethodGet, "admin", http.StatusOK},
+		{"wrong token", "admin", http.MethodGet, "guess", http.StatusUnauthorized},
+		{"missing token", "admin", http.MethodGet, "", http.StatusUnauthorized},
+		{"post", "", http.MethodPost, "", http.StatusMethodNotAllowed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hub, srv := newTestHub(t)
+			hub.AdminToken = tc.adminToken
+			joinWith(t, hub, srv, url.Values{"peer_id": {"peer-a"}, "room": {"room-1"}})
+			joinWith(t, hub, srv, url.Values{"peer_id": {"peer-b"}, "room": {"room-1"}})
+			joinWith(t, hub, srv, url.Values{"peer_id": {"peer-c"}, "room": {"room-2"}})
+
+			req := httptest.NewRequest(tc.method, "/rooms", nil)
+			if tc.header != "" {
+				req.Header.Set(AdminTokenHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			hub.HandleRooms(rec, req)
+			if rec.Code != tc.status {
+				t.Fatalf("status %d, want %d", rec.Code, tc.status)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if strings.Contains(string(body), "peer-") {
+				t.Fatalf("the response names peers: %s", body)
+			}
+
+			var resp struct {
+				Rooms []map[string]json.RawMessage `json:"rooms"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatal(err)
+			}
+			want := []struct {
+				room  string
+				peers int
+			}{{"room-1", 2}, {"room-2", 1}}
+			if len(resp.Rooms) != len(want) {
+				t.Fatalf("%d rooms, want %d: %s", len(resp.Rooms), len(want), body)
+			}
+			for i, w := range want {
+				room := resp.Rooms[i]
+				if len(room) != 3 {
+					t.Fatalf("room %d has fields %s, want room, peers and connected_at", i, body)
+				}
+				var info RoomInfo
+				raw, _ := json.Marshal(room)
+				if err := json.Unmarshal(raw, &info); err != nil {
+					t.Fatal(err)
+				}
+				if info.Room != w.room || info.Peers != w.peers || len(info.ConnectedAt) != w.peers {
+					t.Fatalf("room %d is %+v, want %s with %d peers", i, info, w.room, w.peers)
+				}
+				for _, at := range info.ConnectedAt {
+					if time.Since(at) > time.Minute {
+						t.Fatalf("connection time %v is not recent", at)
+					}
+				}
+			}
+		})
+	}
+}